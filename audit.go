@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Audited actions
+const (
+	AuditWrite      = "write"      // parameter write through xml.cgi
+	AuditSchedule   = "schedule"   // weekly program change
+	AuditNetwork    = "network"    // network settings change
+	AuditSystem     = "system"     // system command such as reset
+	AuditAutomation = "automation" // automation rule action, applied or dry run
+)
+
+// AuditRecord is one change made to the device
+type AuditRecord struct {
+	Time      time.Time `json:"time"`
+	Caller    string    `json:"caller"`
+	Action    string    `json:"action"`
+	Command   string    `json:"command,omitempty"`
+	Parameter string    `json:"parameter,omitempty"`
+	OldValue  string    `json:"old_value,omitempty"`
+	NewValue  string    `json:"new_value"`
+	Result    string    `json:"result"` // "ok", "failed" or "dry_run" for automation
+	Error     string    `json:"error,omitempty"`
+	// Automation is the full action of an automation rule (action "automation")
+	Automation *AuditEntry `json:"automation,omitempty"`
+}
+
+// AuditFilter selects records returned by AuditLog.Query
+type AuditFilter struct {
+	Caller    string
+	Action    string
+	Parameter string
+	Since     time.Time
+	Limit     int
+}
+
+func (f AuditFilter) matches(record AuditRecord) bool {
+	return (f.Caller == "" || record.Caller == f.Caller) &&
+		(f.Action == "" || record.Action == f.Action) &&
+		(f.Parameter == "" || record.Parameter == f.Parameter) &&
+		(f.Since.IsZero() || !record.Time.Before(f.Since))
+}
+
+// AuditLog appends records to a JSONL file that is rotated by size:
+// audit.jsonl is the newest, audit.jsonl.1 the previous one and so on
+type AuditLog struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+
+	mutex sync.Mutex
+}
+
+// NewAuditLog creates an audit log at path keeping at most maxFiles files of maxSize bytes
+func NewAuditLog(path string, maxSize int64, maxFiles int) *AuditLog {
+	if maxFiles < 1 {
+		maxFiles = 1
+	}
+	return &AuditLog{path: path, maxSize: maxSize, maxFiles: maxFiles}
+}
+
+// Record appends a record, rotating the file when it would exceed maxSize
+func (al *AuditLog) Record(record AuditRecord) {
+	if record.Time.IsZero() {
+		record.Time = time.Now()
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		log.Printf("✗ Failed to encode audit record: %v", err)
+		return
+	}
+	line = append(line, '\n')
+
+	al.mutex.Lock()
+	defer al.mutex.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(al.path), 0700); err != nil {
+		log.Printf("✗ Failed to write audit log: %v", err)
+		return
+	}
+	if info, err := os.Stat(al.path); err == nil && al.maxSize > 0 && info.Size()+int64(len(line)) > al.maxSize {
+		al.rotateLocked()
+	}
+
+	f, err := os.OpenFile(al.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Printf("✗ Failed to write audit log: %v", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(line); err != nil {
+		log.Printf("✗ Failed to write audit log: %v", err)
+	}
+}
+
+// rotateLocked shifts audit.jsonl.N-1 -> .N and drops the oldest file
+func (al *AuditLog) rotateLocked() {
+	if al.maxFiles == 1 {
+		os.Remove(al.path)
+		return
+	}
+	os.Remove(al.rotatedPath(al.maxFiles - 1))
+	for i := al.maxFiles - 2; i >= 1; i-- {
+		os.Rename(al.rotatedPath(i), al.rotatedPath(i+1))
+	}
+	if err := os.Rename(al.path, al.rotatedPath(1)); err != nil {
+		log.Printf("✗ Failed to rotate audit log: %v", err)
+	}
+}
+
+func (al *AuditLog) rotatedPath(n int) string {
+	return fmt.Sprintf("%s.%d", al.path, n)
+}
+
+// Query returns matching records across all files, newest first
+// The files are only opened under the lock; rotation renames them, so the
+// open handles stay valid and writes are not held up while they are scanned.
+// Scanning stops at filter.Limit and at files last written before filter.Since.
+func (al *AuditLog) Query(filter AuditFilter) ([]AuditRecord, error) {
+	files, err := al.openFiles()
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	if err != nil {
+		return nil, err
+	}
+
+	records := []AuditRecord{}
+	for _, f := range files {
+		if info, err := f.Stat(); err == nil && !filter.Since.IsZero() && info.ModTime().Before(filter.Since) {
+			break // this file and the older ones hold no record since then
+		}
+		fileRecords, err := readAuditFile(f, filter)
+		if err != nil {
+			return nil, err
+		}
+		for i := len(fileRecords) - 1; i >= 0; i-- {
+			records = append(records, fileRecords[i])
+			if filter.Limit > 0 && len(records) == filter.Limit {
+				return records, nil
+			}
+		}
+	}
+	return records, nil
+}
+
+// openFiles opens the existing files, newest first
+func (al *AuditLog) openFiles() ([]*os.File, error) {
+	al.mutex.Lock()
+	defer al.mutex.Unlock()
+
+	var files []*os.File
+	for n := 0; n < al.maxFiles; n++ {
+		path := al.path
+		if n > 0 {
+			path = al.rotatedPath(n)
+		}
+		f, err := os.Open(path)
+		if os.IsNotExist(err) {
+			break
+		}
+		if err != nil {
+			return files, err
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// readAuditFile reads the matching records of one file in write order, skipping bad lines
+func readAuditFile(f *os.File, filter AuditFilter) ([]AuditRecord, error) {
+	var records []AuditRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var record AuditRecord
+		if json.Unmarshal(scanner.Bytes(), &record) == nil && filter.matches(record) {
+			records = append(records, record)
+		}
+	}
+	return records, scanner.Err()
+}
+
+// SetAuditLog makes the client record every change it sends to the device
+func (wc *WebClient) SetAuditLog(audit *AuditLog) {
+	wc.audit = audit
+}
+
+// WithCaller returns a copy of the client whose changes are audited as caller
+// The copy shares the HTTP client, audit log and current session.
+func (wc *WebClient) WithCaller(caller string) *WebClient {
+	clone := *wc
+	clone.caller = caller
+	return &clone
+}
+
+// auditCaller returns the audited identity of the client
+func (wc *WebClient) auditCaller() string {
+	if wc.caller == "" {
+		return "system"
+	}
+	return wc.caller
+}
+
+// SetSnapshotSource gives the client the latest polled values, used as the
+// old values of audited writes instead of reading xml.xml before every write
+func (wc *WebClient) SetSnapshotSource(snapshot func() *DeviceData) {
+	wc.snapshot = snapshot
+}
+
+// auditPrevious returns the last known values of the written parameters when
+// auditing is enabled; values stay empty before the first poll
+func (wc *WebClient) auditPrevious() map[string]string {
+	if wc.audit == nil {
+		return nil
+	}
+	if wc.snapshot != nil {
+		if data := wc.snapshot(); data != nil {
+			return data.Items
+		}
+	}
+	return map[string]string{}
+}
+
+// auditWrites records one write record per ID=VALUE parameter
+func (wc *WebClient) auditWrites(action, command string, parameters []string, previous map[string]string, err error) {
+	if wc.audit == nil {
+		return
+	}
+	now := time.Now()
+	for _, param := range parameters {
+		id, value := splitParam(param)
+		wc.audit.Record(auditResult(AuditRecord{
+			Time:      now,
+			Caller:    wc.auditCaller(),
+			Action:    action,
+			Command:   command,
+			Parameter: id,
+			OldValue:  previous[id],
+			NewValue:  value,
+		}, err))
+	}
+}
+
+// auditChange records a schedule or network change
+func (wc *WebClient) auditChange(action, target, oldValue, newValue string, err error) {
+	if wc.audit == nil {
+		return
+	}
+	wc.audit.Record(auditResult(AuditRecord{
+		Caller:    wc.auditCaller(),
+		Action:    action,
+		Parameter: target,
+		OldValue:  strings.TrimSpace(oldValue),
+		NewValue:  newValue,
+	}, err))
+}
+
+func auditResult(record AuditRecord, err error) AuditRecord {
+	record.Result = "ok"
+	if err != nil {
+		record.Result = "failed"
+		record.Error = err.Error()
+	}
+	return record
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestAuditWebClientWrites tests that writes are recorded with caller, old and new value
+func TestAuditWebClientWrites(t *testing.T) {
+	device := &fakeDevice{values: map[string]string{"H10714": "50", "H10715": "1"}}
+	reads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/config/xml.xml" {
+			reads++
+		}
+		device.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	client := NewWebClient(server.Listener.Addr().String())
+	client.baseURL = server.URL
+	client.SetSessionID("12345")
+	audit := NewAuditLog(filepath.Join(t.TempDir(), "audit.jsonl"), 1<<20, 2)
+	client.SetAuditLog(audit)
+	client.SetSnapshotSource(func() *DeviceData {
+		return &DeviceData{Items: map[string]string{"H10714": "50", "H10715": "1"}}
+	})
+
+	if err := client.WithCaller("alice").SetMultipleValues([]string{"H10714=80"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reads != 0 {
+		t.Errorf("audited write read xml.xml %d times, want old values from the snapshot", reads)
+	}
+	if _, err := client.WithCaller("bob").SetMultipleValuesVerified([]string{"H10715=2"}, VerifyOptions{Rollback: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := NewSystemControl(client).Reset(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	records, err := audit.Query(AuditFilter{})
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("got %d records, want 3", len(records))
+	}
+
+	reset, bob, alice := records[0], records[1], records[2]
+	if alice.Caller != "alice" || alice.Parameter != "H10714" || alice.OldValue != "50" || alice.NewValue != "80" || alice.Result != "ok" {
+		t.Errorf("alice record: %+v", alice)
+	}
+	if bob.Caller != "bob" || bob.OldValue != "1" || bob.NewValue != "2" {
+		t.Errorf("bob record: %+v", bob)
+	}
+	if reset.Action != AuditSystem || reset.Command != "reset" || reset.Caller != "system" {
+		t.Errorf("reset record: %+v", reset)
+	}
+
+	filtered, _ := audit.Query(AuditFilter{Caller: "bob"})
+	if len(filtered) != 1 || filtered[0].Parameter != "H10715" {
+		t.Errorf("caller filter: got %+v", filtered)
+	}
+}
+
+// TestAuditLogRotation tests size-based rotation and querying across files
+func TestAuditLogRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	audit := NewAuditLog(path, 300, 3)
+
+	for i := 0; i < 20; i++ {
+		audit.Record(AuditRecord{Caller: "alice", Action: AuditWrite, Parameter: "H10714", NewValue: strings.Repeat("9", i%3+1)})
+	}
+
+	if _, err := os.Stat(path + ".3"); err == nil {
+		t.Error("more files kept than configured")
+	}
+	records, err := audit.Query(AuditFilter{Limit: 4})
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("got %d records, want 4", len(records))
+	}
+	// Newest first: the last record written had i=19 -> "99"
+	if records[0].NewValue != "99" {
+		t.Errorf("newest record: got %q, want 99", records[0].NewValue)
+	}
+}
+
+// TestAuditLogQuerySince tests that files last written before Since are not scanned
+func TestAuditLogQuerySince(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	audit := NewAuditLog(path, 300, 3)
+	for i := 0; i < 10; i++ {
+		audit.Record(AuditRecord{Caller: "alice", Action: AuditWrite, Parameter: "H10714", NewValue: "80"})
+	}
+	all, _ := audit.Query(AuditFilter{})
+
+	// The rotated files claim to be old; their records are not read
+	old := time.Now().Add(-time.Hour)
+	for _, rotated := range []string{path + ".1", path + ".2"} {
+		if err := os.Chtimes(rotated, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	since, err := audit.Query(AuditFilter{Since: time.Now().Add(-time.Minute)})
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if len(since) == 0 || len(since) >= len(all) {
+		t.Errorf("got %d of %d records, want only those of the current file", len(since), len(all))
+	}
+}
@@ -0,0 +1,502 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxAuditEntries is how many automation actions are kept in memory
+const maxAuditEntries = 500
+
+// AutomationConfig is the JSON file referenced by AUTOMATION_FILE
+//
+//	{
+//	  "rules": [
+//	    {
+//	      "name": "evening_boost",
+//	      "priority": 10,
+//	      "cooldown": "1h",
+//	      "weekdays": ["mon", "tue", "wed", "thu", "fri"],
+//	      "from": "18:00", "to": "21:00",
+//	      "actions": [{"mode": "ventilation", "power": 80}]
+//	    },
+//	    {
+//	      "name": "frost_protection",
+//	      "priority": 100,
+//	      "conditions": [{"parameter": "I10211", "below": -15}],
+//	      "actions": [{"power": 30}]
+//	    }
+//	  ]
+//	}
+type AutomationConfig struct {
+	DryRun bool             `json:"dry_run"`
+	Rules  []AutomationRule `json:"rules"`
+}
+
+// AutomationRule fires its actions when every condition holds
+// Higher priorities win when several matching rules write the same parameter.
+// After acting a rule stays quiet for Cooldown.
+type AutomationRule struct {
+	Name       string                `json:"name"`
+	Priority   int                   `json:"priority"`
+	Cooldown   Duration              `json:"cooldown"`
+	Weekdays   []string              `json:"weekdays,omitempty"`
+	From       string                `json:"from,omitempty"`
+	To         string                `json:"to,omitempty"`
+	Conditions []AutomationCondition `json:"conditions,omitempty"`
+	Actions    []AutomationAction    `json:"actions"`
+	Disabled   bool                  `json:"disabled,omitempty"`
+}
+
+// AutomationCondition compares a decoded parameter with limits
+// Equals compares the decoded value as text, e.g. "ventilation" for H10715.
+type AutomationCondition struct {
+	Parameter string   `json:"parameter"`
+	Below     *float64 `json:"below,omitempty"`
+	Above     *float64 `json:"above,omitempty"`
+	Equals    string   `json:"equals,omitempty"`
+}
+
+// AutomationAction is a write performed when a rule fires
+type AutomationAction struct {
+	Mode      *VentilationMode `json:"mode,omitempty"`
+	Power     *int             `json:"power,omitempty"`
+	Setpoint  *float64         `json:"setpoint,omitempty"`
+	Parameter string           `json:"parameter,omitempty"`
+	Value     string           `json:"value,omitempty"`
+}
+
+// AuditEntry records one action taken (or simulated) by the automation engine
+type AuditEntry struct {
+	Time     time.Time     `json:"time"`
+	Rule     string        `json:"rule"`
+	Priority int           `json:"priority"`
+	Writes   []string      `json:"writes"`
+	Skipped  []string      `json:"skipped,omitempty"`
+	DryRun   bool          `json:"dry_run"`
+	Result   string        `json:"result"` // "applied", "dry_run" or "failed"
+	Error    string        `json:"error,omitempty"`
+	Details  []WriteResult `json:"details,omitempty"`
+}
+
+// AutomationRuleStatus is a rule as reported by GET /automation
+type AutomationRuleStatus struct {
+	AutomationRule
+	LastFired     *time.Time `json:"last_fired,omitempty"`
+	CooldownUntil *time.Time `json:"cooldown_until,omitempty"`
+}
+
+// LoadAutomationConfig reads and validates an automation rules file
+func LoadAutomationConfig(path string) (*AutomationConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg AutomationConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// Validate checks every rule
+func (c *AutomationConfig) Validate() error {
+	names := make(map[string]bool)
+	for _, rule := range c.Rules {
+		if rule.Name == "" || names[rule.Name] {
+			return fmt.Errorf("rule names must be unique and non-empty (%q)", rule.Name)
+		}
+		names[rule.Name] = true
+
+		if err := rule.validate(); err != nil {
+			return fmt.Errorf("rule %s: %w", rule.Name, err)
+		}
+	}
+	return nil
+}
+
+func (r AutomationRule) validate() error {
+	if r.Cooldown.Duration < 0 {
+		return fmt.Errorf("cooldown must not be negative")
+	}
+	for _, day := range r.Weekdays {
+		if _, ok := weekdayNames[strings.ToLower(day)]; !ok {
+			return fmt.Errorf("unknown weekday %q", day)
+		}
+	}
+	if (r.From == "") != (r.To == "") {
+		return fmt.Errorf("from and to must be set together")
+	}
+	if r.From != "" {
+		if _, err := parseClock(r.From); err != nil {
+			return err
+		}
+		if _, err := parseClock(r.To); err != nil {
+			return err
+		}
+	}
+	for _, cond := range r.Conditions {
+		if cond.Parameter == "" {
+			return fmt.Errorf("condition without parameter")
+		}
+		if cond.Below == nil && cond.Above == nil && cond.Equals == "" {
+			return fmt.Errorf("condition on %s needs below, above or equals", cond.Parameter)
+		}
+	}
+	if len(r.Actions) == 0 {
+		return fmt.Errorf("at least one action is required")
+	}
+	for _, action := range r.Actions {
+		if _, err := action.writes(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writes converts an action to ID=VALUE parameter writes
+func (a AutomationAction) writes() ([]string, error) {
+	var writes []string
+	if a.Mode != nil {
+		if !a.Mode.Settable() {
+			return nil, fmt.Errorf("ventilation mode %s cannot be requested", a.Mode)
+		}
+		writes = append(writes, FormatParam(ParamOperatingMode, int(*a.Mode)))
+	}
+	if a.Power != nil {
+		if err := ValidateFanPower(*a.Power); err != nil {
+			return nil, err
+		}
+		writes = append(writes, FormatParam(ParamFanPower, *a.Power))
+	}
+	if a.Setpoint != nil {
+		if ClampSetpoint(*a.Setpoint) != *a.Setpoint {
+			return nil, fmt.Errorf("setpoint %.1f°C out of range %.0f-%.0f°C", *a.Setpoint, MinSetpoint, MaxSetpoint)
+		}
+		raw, err := encodeTemperature(*a.Setpoint)
+		if err != nil {
+			return nil, err
+		}
+		writes = append(writes, FormatParam(ParamDesiredTemperature, raw))
+	}
+	if a.Parameter != "" {
+		if !strings.HasPrefix(a.Parameter, "H") && !strings.HasPrefix(a.Parameter, "C") {
+			return nil, fmt.Errorf("parameter %s is not writable", a.Parameter)
+		}
+		if command, ok := systemCommandParams[a.Parameter]; ok {
+			return nil, fmt.Errorf("parameter %s issues the %s system command", a.Parameter, command)
+		}
+		if a.Value == "" {
+			return nil, fmt.Errorf("parameter %s needs a value", a.Parameter)
+		}
+		writes = append(writes, FormatParam(a.Parameter, a.Value))
+	}
+	if len(writes) == 0 {
+		return nil, fmt.Errorf("action must set mode, power, setpoint or parameter")
+	}
+	return writes, nil
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// parseClock parses "HH:MM" into minutes after midnight
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q (want HH:MM)", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// matchesTime reports whether now falls on one of the weekdays and within
+// from-to; a window whose end is before its start spans midnight
+func (r AutomationRule) matchesTime(now time.Time) bool {
+	if len(r.Weekdays) > 0 {
+		found := false
+		for _, day := range r.Weekdays {
+			if weekdayNames[strings.ToLower(day)] == now.Weekday() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if r.From == "" {
+		return true
+	}
+	from, _ := parseClock(r.From)
+	to, _ := parseClock(r.To)
+	minute := now.Hour()*60 + now.Minute()
+	if from <= to {
+		return minute >= from && minute < to
+	}
+	return minute >= from || minute < to
+}
+
+// matchesData reports whether every condition holds for the snapshot
+func (r AutomationRule) matchesData(data *DeviceData) bool {
+	for _, cond := range r.Conditions {
+		decoded, ok := data.Decode(cond.Parameter)
+		if !ok {
+			return false
+		}
+		if cond.Equals != "" && !strings.EqualFold(fmt.Sprint(decoded.Value), cond.Equals) && decoded.RawValue != cond.Equals {
+			return false
+		}
+		if cond.Below == nil && cond.Above == nil {
+			continue
+		}
+		value, ok := numericValue(decoded.Value)
+		if !ok {
+			return false
+		}
+		if cond.Below != nil && value >= *cond.Below {
+			return false
+		}
+		if cond.Above != nil && value <= *cond.Above {
+			return false
+		}
+	}
+	return true
+}
+
+// Automation evaluates rules on every polled snapshot and writes through WebClient
+type Automation struct {
+	config   AutomationConfig
+	client   *WebClient
+	verify   VerifyOptions
+	auditLog *AuditLog
+	now      func() time.Time
+
+	mutex     sync.Mutex
+	lastFired map[string]time.Time
+	audit     []AuditEntry
+}
+
+// NewAutomation creates an engine recording its actions in the audit log;
+// audit may be nil, in which case actions are only kept in memory
+func NewAutomation(cfg AutomationConfig, client *WebClient, verify VerifyOptions, audit *AuditLog) *Automation {
+	a := &Automation{
+		config:    cfg,
+		client:    client,
+		verify:    verify,
+		auditLog:  audit,
+		now:       time.Now,
+		lastFired: make(map[string]time.Time),
+	}
+	a.loadAudit()
+	return a
+}
+
+// DryRun reports whether actions are only logged
+func (a *Automation) DryRun() bool {
+	return a.config.DryRun
+}
+
+// Evaluate runs every rule against a snapshot
+// Matching rules act in priority order; a parameter written by a higher
+// priority rule is skipped by lower ones in the same cycle. Writes whose
+// target value is already present are not repeated.
+func (a *Automation) Evaluate(data *DeviceData) {
+	now := a.now()
+
+	rules := make([]AutomationRule, 0, len(a.config.Rules))
+	for _, rule := range a.config.Rules {
+		if !rule.Disabled && rule.matchesTime(now) && rule.matchesData(data) {
+			rules = append(rules, rule)
+		}
+	}
+	sort.SliceStable(rules, func(i, j int) bool { return rules[i].Priority > rules[j].Priority })
+
+	claimed := make(map[string]string)
+	for _, rule := range rules {
+		a.mutex.Lock()
+		last, fired := a.lastFired[rule.Name]
+		a.mutex.Unlock()
+		if fired && now.Sub(last) < rule.Cooldown.Duration {
+			// Keep the parameters of a rule in cooldown claimed so lower
+			// priority rules do not undo what it just did
+			a.claim(rule, claimed)
+			continue
+		}
+
+		var writes, skipped []string
+		for _, action := range rule.Actions {
+			actionWrites, _ := action.writes()
+			for _, write := range actionWrites {
+				id, value := splitParam(write)
+				if owner, ok := claimed[id]; ok && owner != rule.Name {
+					skipped = append(skipped, write)
+					continue
+				}
+				claimed[id] = rule.Name
+				if current, ok := data.Items[id]; ok && sameValue(current, value) {
+					continue
+				}
+				writes = append(writes, write)
+			}
+		}
+		if len(writes) == 0 {
+			continue
+		}
+
+		a.apply(rule, writes, skipped, now)
+	}
+}
+
+// claim marks the parameters written by rule as taken for this cycle
+func (a *Automation) claim(rule AutomationRule, claimed map[string]string) {
+	for _, action := range rule.Actions {
+		actionWrites, _ := action.writes()
+		for _, write := range actionWrites {
+			id, _ := splitParam(write)
+			if _, ok := claimed[id]; !ok {
+				claimed[id] = rule.Name
+			}
+		}
+	}
+}
+
+// apply performs (or simulates) the writes of a rule and records them
+func (a *Automation) apply(rule AutomationRule, writes, skipped []string, now time.Time) {
+	entry := AuditEntry{
+		Time:     now,
+		Rule:     rule.Name,
+		Priority: rule.Priority,
+		Writes:   writes,
+		Skipped:  skipped,
+		DryRun:   a.config.DryRun,
+	}
+
+	if a.config.DryRun {
+		entry.Result = "dry_run"
+		log.Printf("→ Automation %s (dry run): would write %s", rule.Name, strings.Join(writes, ", "))
+	} else {
+		results, err := a.client.WithCaller("automation:"+rule.Name).SetMultipleValuesVerified(writes, a.verify)
+		entry.Details = results
+		if err != nil {
+			entry.Result = "failed"
+			entry.Error = err.Error()
+			log.Printf("✗ Automation %s failed: %v", rule.Name, err)
+		} else {
+			entry.Result = "applied"
+			log.Printf("✓ Automation %s wrote %s", rule.Name, strings.Join(writes, ", "))
+		}
+	}
+
+	a.mutex.Lock()
+	a.lastFired[rule.Name] = now
+	a.audit = append(a.audit, entry)
+	if len(a.audit) > maxAuditEntries {
+		a.audit = a.audit[len(a.audit)-maxAuditEntries:]
+	}
+	a.mutex.Unlock()
+
+	a.recordAudit(entry)
+}
+
+// Rules returns every rule with its cooldown state
+func (a *Automation) Rules() []AutomationRuleStatus {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	rules := make([]AutomationRuleStatus, 0, len(a.config.Rules))
+	for _, rule := range a.config.Rules {
+		status := AutomationRuleStatus{AutomationRule: rule}
+		if last, ok := a.lastFired[rule.Name]; ok {
+			status.LastFired = &last
+			if until := last.Add(rule.Cooldown.Duration); until.After(a.now()) {
+				status.CooldownUntil = &until
+			}
+		}
+		rules = append(rules, status)
+	}
+	return rules
+}
+
+// Audit returns the most recent audit entries, newest first
+func (a *Automation) Audit(limit int) []AuditEntry {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	entries := make([]AuditEntry, 0, len(a.audit))
+	for i := len(a.audit) - 1; i >= 0; i-- {
+		entries = append(entries, a.audit[i])
+		if limit > 0 && len(entries) == limit {
+			break
+		}
+	}
+	return entries
+}
+
+// recordAudit adds the action to the audit log; the individual parameter
+// writes are recorded by the client
+func (a *Automation) recordAudit(entry AuditEntry) {
+	if a.auditLog == nil {
+		return
+	}
+	result := "ok"
+	switch entry.Result {
+	case "dry_run", "failed":
+		result = entry.Result
+	}
+	a.auditLog.Record(AuditRecord{
+		Time:       entry.Time,
+		Caller:     "automation:" + entry.Rule,
+		Action:     AuditAutomation,
+		NewValue:   strings.Join(entry.Writes, ","),
+		Result:     result,
+		Error:      entry.Error,
+		Automation: &entry,
+	})
+}
+
+// loadAudit restores recent entries and cooldowns from the audit log
+func (a *Automation) loadAudit() {
+	if a.auditLog == nil {
+		return
+	}
+	records, err := a.auditLog.Query(AuditFilter{Action: AuditAutomation, Limit: maxAuditEntries})
+	if err != nil {
+		log.Printf("✗ Failed to read automation audit: %v", err)
+		return
+	}
+	for i := len(records) - 1; i >= 0; i-- {
+		entry := records[i].Automation
+		if entry == nil {
+			continue
+		}
+		a.audit = append(a.audit, *entry)
+		a.lastFired[entry.Rule] = entry.Time
+	}
+}
+
+// splitParam splits "ID=VALUE"
+func splitParam(param string) (string, string) {
+	parts := strings.SplitN(param, "=", 2)
+	if len(parts) != 2 {
+		return param, ""
+	}
+	return parts[0], parts[1]
+}
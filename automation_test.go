@@ -0,0 +1,146 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestAutomation creates an engine writing to a fake device at a fixed time
+func newTestAutomation(t *testing.T, device *fakeDevice, rules []AutomationRule, dryRun bool, now time.Time) *Automation {
+	t.Helper()
+	cfg := AutomationConfig{DryRun: dryRun, Rules: rules}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("invalid rules: %v", err)
+	}
+
+	server := httptest.NewServer(device)
+	t.Cleanup(server.Close)
+	client := NewWebClient(server.Listener.Addr().String())
+	client.baseURL = server.URL
+	client.SetSessionID("12345")
+
+	audit := NewAuditLog(filepath.Join(t.TempDir(), "audit.jsonl"), 0, 1)
+	client.SetAuditLog(audit)
+	a := NewAutomation(cfg, client, VerifyOptions{Attempts: 1}, audit)
+	a.now = func() time.Time { return now }
+	return a
+}
+
+func intPtr(v int) *int                          { return &v }
+func floatPtr(v float64) *float64                { return &v }
+func modePtr(m VentilationMode) *VentilationMode { return &m }
+
+// TestAutomationPriorityAndCooldown tests that the higher priority rule wins a
+// conflicting parameter and that cooldowns suppress repeated actions
+func TestAutomationPriorityAndCooldown(t *testing.T) {
+	device := &fakeDevice{values: map[string]string{"H10714": "50", "H10715": "1"}}
+	// Wednesday evening
+	now := time.Date(2025, 11, 19, 19, 30, 0, 0, time.Local)
+	a := newTestAutomation(t, device, []AutomationRule{
+		{
+			Name: "evening_boost", Priority: 10, Cooldown: Duration{time.Hour},
+			Weekdays: []string{"wed"}, From: "18:00", To: "21:00",
+			Actions: []AutomationAction{{Mode: modePtr(ModeVentilation), Power: intPtr(80)}},
+		},
+		{
+			Name: "frost_protection", Priority: 100,
+			Conditions: []AutomationCondition{{Parameter: "I10211", Below: floatPtr(-15)}},
+			Actions:    []AutomationAction{{Power: intPtr(30)}},
+		},
+	}, false, now)
+
+	cold := &DeviceData{Items: map[string]string{"I10211": "65336", "H10714": "50", "H10715": "1"}} // -20.0°C
+	a.Evaluate(cold)
+
+	if device.values["H10714"] != "30" || device.values["H10715"] != "2" {
+		t.Fatalf("got power %s mode %s, want 30 and 2", device.values["H10714"], device.values["H10715"])
+	}
+
+	audit := a.Audit(0)
+	if len(audit) != 2 {
+		t.Fatalf("got %d audit entries, want 2", len(audit))
+	}
+	boost := audit[0]
+	if boost.Rule != "evening_boost" || len(boost.Skipped) != 1 || boost.Skipped[0] != "H10714=80" {
+		t.Errorf("evening_boost entry: %+v", boost)
+	}
+
+	// Within the cooldown the boost rule does not write again
+	device.values["H10715"] = "1"
+	a.Evaluate(&DeviceData{Items: map[string]string{"I10211": "26", "H10714": "30", "H10715": "1"}})
+	if device.values["H10715"] != "1" {
+		t.Errorf("rule in cooldown wrote mode %s", device.values["H10715"])
+	}
+}
+
+// TestAutomationTimeWindow tests weekday and overnight time windows
+func TestAutomationTimeWindow(t *testing.T) {
+	rule := AutomationRule{Weekdays: []string{"sat", "sun"}, From: "22:00", To: "06:00"}
+
+	tests := []struct {
+		time time.Time
+		want bool
+	}{
+		{time.Date(2025, 11, 22, 23, 0, 0, 0, time.Local), true},  // Saturday night
+		{time.Date(2025, 11, 23, 5, 59, 0, 0, time.Local), true},  // Sunday morning
+		{time.Date(2025, 11, 23, 6, 0, 0, 0, time.Local), false},  // window closed
+		{time.Date(2025, 11, 21, 23, 0, 0, 0, time.Local), false}, // Friday
+	}
+	for _, tt := range tests {
+		if got := rule.matchesTime(tt.time); got != tt.want {
+			t.Errorf("matchesTime(%s): got %v, want %v", tt.time.Format("Mon 15:04"), got, tt.want)
+		}
+	}
+}
+
+// TestAutomationDryRun tests that dry-run records actions without writing
+func TestAutomationDryRun(t *testing.T) {
+	device := &fakeDevice{values: map[string]string{"H10714": "50"}}
+	a := newTestAutomation(t, device, []AutomationRule{
+		{Name: "quiet", Actions: []AutomationAction{{Power: intPtr(20)}}},
+	}, true, time.Now())
+
+	a.Evaluate(&DeviceData{Items: map[string]string{"H10714": "50"}})
+
+	if len(device.writes) != 0 {
+		t.Errorf("dry run wrote %v", device.writes)
+	}
+	audit := a.Audit(0)
+	if len(audit) != 1 || audit[0].Result != "dry_run" {
+		t.Fatalf("got audit %+v, want one dry_run entry", audit)
+	}
+
+	records, err := a.auditLog.Query(AuditFilter{Action: AuditAutomation})
+	if err != nil || len(records) != 1 || records[0].Result != "dry_run" || records[0].Caller != "automation:quiet" {
+		t.Fatalf("got audit records %+v, %v, want one dry_run record", records, err)
+	}
+
+	// Recent actions and cooldowns survive a restart
+	reloaded := NewAutomation(a.config, a.client, a.verify, a.auditLog)
+	if audit := reloaded.Audit(0); len(audit) != 1 || audit[0].Rule != "quiet" || audit[0].Writes[0] != "H10714=20" {
+		t.Errorf("after reload: got %+v", audit)
+	}
+	if rules := reloaded.Rules(); rules[0].LastFired == nil {
+		t.Error("after reload: last fired time not restored")
+	}
+}
+
+// TestLoadAutomationConfigValidation tests rejection of invalid rules
+func TestLoadAutomationConfigValidation(t *testing.T) {
+	tests := map[string]string{
+		"transient mode": `{"rules": [{"name": "x", "actions": [{"mode": "defrosting"}]}]}`,
+		"read-only":      `{"rules": [{"name": "x", "actions": [{"parameter": "I10215", "value": "1"}]}]}`,
+		"bad time":       `{"rules": [{"name": "x", "from": "25:00", "to": "06:00", "actions": [{"power": 50}]}]}`,
+		"no actions":     `{"rules": [{"name": "x"}]}`,
+	}
+	for name, content := range tests {
+		path := filepath.Join(t.TempDir(), "automation.json")
+		os.WriteFile(path, []byte(content), 0600)
+		if _, err := LoadAutomationConfig(path); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Redacted values stored in cassettes instead of credentials
+const (
+	redactedValue   = "REDACTED" // auth (session ID) and magic (password hash) query parameters
+	redactedSession = "00000"    // session ID returned by login.cgi, still accepted by LoginMagic
+)
+
+// ErrNoInteraction is returned by ReplayTransport for requests missing from the cassette
+var ErrNoInteraction = errors.New("no recorded interaction")
+
+// loginSession matches the session ID in a login.cgi response
+var loginSession = regexp.MustCompile(`(<root[^>]*>\s*)(\d+)(\s*</root>)`)
+
+// Interaction is one request to the device and its response, as stored in a cassette
+// A cassette is a JSON Lines file with one interaction per line, in request order.
+type Interaction struct {
+	Time       time.Time `json:"time"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Query      string    `json:"query,omitempty"` // redacted and without the rnd nonce
+	Status     int       `json:"status,omitempty"`
+	Body       string    `json:"body,omitempty"`
+	Base64     bool      `json:"base64,omitempty"` // Body is base64 encoded, the response was not UTF-8
+	Error      string    `json:"error,omitempty"`  // transport error instead of a response
+	DurationMs int64     `json:"duration_ms"`
+}
+
+// key identifies the requests an interaction answers
+func (i Interaction) key() string {
+	return i.Method + " " + i.Path + "?" + i.Query
+}
+
+// cassetteQuery canonicalises a query: sorted, credentials redacted, nonce removed
+func cassetteQuery(query url.Values) string {
+	canonical := url.Values{}
+	for key, values := range query {
+		switch key {
+		case "rnd":
+			continue
+		case "auth", "magic":
+			canonical[key] = []string{redactedValue}
+		default:
+			canonical[key] = values
+		}
+	}
+	return canonical.Encode()
+}
+
+// RecordingTransport passes requests to the device and appends each
+// interaction to a cassette file
+type RecordingTransport struct {
+	next http.RoundTripper
+
+	mutex sync.Mutex
+	file  *os.File
+}
+
+// NewRecordingTransport appends interactions to the cassette at path,
+// sending requests through next (http.DefaultTransport when nil)
+func NewRecordingTransport(path string, next http.RoundTripper) (*RecordingTransport, error) {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cassette: %w", err)
+	}
+	return &RecordingTransport{next: next, file: file}, nil
+}
+
+// RoundTrip implements http.RoundTripper
+func (rt *RecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	interaction := Interaction{
+		Time:   start,
+		Method: req.Method,
+		Path:   req.URL.Path,
+		Query:  cassetteQuery(req.URL.Query()),
+	}
+
+	resp, err := rt.next.RoundTrip(req)
+	if err == nil {
+		var body []byte
+		body, err = io.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+
+		if req.URL.Path == "/config/login.cgi" {
+			body = loginSession.ReplaceAll(body, []byte("${1}"+redactedSession+"${3}"))
+		}
+		interaction.Status = resp.StatusCode
+		if utf8.Valid(body) {
+			interaction.Body = string(body)
+		} else {
+			interaction.Body = base64.StdEncoding.EncodeToString(body)
+			interaction.Base64 = true
+		}
+	}
+	if err != nil {
+		interaction.Error = err.Error()
+	}
+	interaction.DurationMs = time.Since(start).Milliseconds()
+
+	if recordErr := rt.record(interaction); recordErr != nil {
+		return nil, recordErr
+	}
+	return resp, err
+}
+
+func (rt *RecordingTransport) record(interaction Interaction) error {
+	line, err := json.Marshal(interaction)
+	if err != nil {
+		return err
+	}
+
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+	if _, err := rt.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	return nil
+}
+
+// Close closes the cassette file
+func (rt *RecordingTransport) Close() error {
+	return rt.file.Close()
+}
+
+// ReplayTransport answers requests from a cassette instead of the device
+// Identical requests are answered in recorded order; once their interactions
+// are used up the last one is repeated, so a cassette can serve a poller forever.
+type ReplayTransport struct {
+	mutex        sync.Mutex
+	interactions map[string][]Interaction
+	served       map[string]int
+}
+
+// LoadCassette reads the interactions recorded at path
+func LoadCassette(path string) ([]Interaction, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cassette: %w", err)
+	}
+	defer file.Close()
+
+	var interactions []Interaction
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 16<<20)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var interaction Interaction
+		if err := json.Unmarshal([]byte(line), &interaction); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+		interactions = append(interactions, interaction)
+	}
+	return interactions, scanner.Err()
+}
+
+// NewReplayTransport serves the given interactions
+func NewReplayTransport(interactions []Interaction) *ReplayTransport {
+	rt := &ReplayTransport{
+		interactions: make(map[string][]Interaction),
+		served:       make(map[string]int),
+	}
+	for _, interaction := range interactions {
+		key := interaction.key()
+		rt.interactions[key] = append(rt.interactions[key], interaction)
+	}
+	return rt
+}
+
+// RoundTrip implements http.RoundTripper
+func (rt *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	key := Interaction{Method: req.Method, Path: req.URL.Path, Query: cassetteQuery(req.URL.Query())}.key()
+
+	rt.mutex.Lock()
+	recorded := rt.interactions[key]
+	n := rt.served[key]
+	if n < len(recorded) {
+		rt.served[key] = n + 1
+	} else {
+		n = len(recorded) - 1
+	}
+	rt.mutex.Unlock()
+
+	if n < 0 {
+		return nil, fmt.Errorf("%w for %s", ErrNoInteraction, key)
+	}
+	interaction := recorded[n]
+	if interaction.Error != "" {
+		return nil, fmt.Errorf("replayed: %s", interaction.Error)
+	}
+
+	body := []byte(interaction.Body)
+	if interaction.Base64 {
+		decoded, err := base64.StdEncoding.DecodeString(interaction.Body)
+		if err != nil {
+			return nil, fmt.Errorf("%w: corrupt cassette body for %s", ErrMalformedResponse, key)
+		}
+		body = decoded
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", interaction.Status, http.StatusText(interaction.Status)),
+		StatusCode:    interaction.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// SetTransport routes the client's device requests through rt, e.g. a
+// RecordingTransport or ReplayTransport
+func (wc *WebClient) SetTransport(rt http.RoundTripper) {
+	wc.httpClient.Transport = rt
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestRecordAndReplay tests that a recorded session replays without the device or credentials
+func TestRecordAndReplay(t *testing.T) {
+	device := &fakeDevice{values: map[string]string{"H10714": "50"}}
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/config/login.cgi" {
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><root lng="0">15736</root>`)
+			return
+		}
+		device.ServeHTTP(w, r)
+	}))
+	defer mock.Close()
+
+	cassette := filepath.Join(t.TempDir(), "session.jsonl")
+	recorder, err := NewRecordingTransport(cassette, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	magic := PasswordMagic("6378")
+
+	client := NewWebClient("unit")
+	client.baseURL = mock.URL
+	client.SetTransport(recorder)
+	if _, err := client.LoginMagic(magic); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	before, _ := client.GetData()
+	if err := client.SetValue("H10714=80"); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	after, _ := client.GetData()
+	recorder.Close()
+
+	recorded, _ := os.ReadFile(cassette)
+	if strings.Contains(string(recorded), "15736") || strings.Contains(string(recorded), magic) {
+		t.Errorf("cassette contains credentials:\n%s", recorded)
+	}
+
+	interactions, err := LoadCassette(cassette)
+	if err != nil || len(interactions) != 4 {
+		t.Fatalf("got %d interactions, %v; want 4", len(interactions), err)
+	}
+	replay := NewWebClient("unit")
+	replay.baseURL = "http://replayed.invalid"
+	replay.SetTransport(NewReplayTransport(interactions))
+
+	if session, err := replay.LoginMagic(PasswordMagic("other")); err != nil || session != redactedSession {
+		t.Errorf("replayed login: got %q, %v", session, err)
+	}
+	if data, _ := replay.GetData(); data != before {
+		t.Errorf("first read: got %q, want %q", data, before)
+	}
+	if err := replay.SetValue("H10714=80"); err != nil {
+		t.Errorf("replayed write: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if data, _ := replay.GetData(); data != after || !strings.Contains(data, `V="80"`) {
+			t.Errorf("read %d after write: got %q, want %q", i, data, after)
+		}
+	}
+
+	if err := replay.SetValue("H10714=90"); !errors.Is(err, ErrNoInteraction) {
+		t.Errorf("unrecorded write: got %v, want ErrNoInteraction", err)
+	}
+}
+
+// TestReplayTransportErrors tests that recorded connection failures are reproduced
+func TestReplayTransportErrors(t *testing.T) {
+	mock := httptest.NewServer(http.NotFoundHandler())
+	mock.Close()
+
+	cassette := filepath.Join(t.TempDir(), "offline.jsonl")
+	recorder, err := NewRecordingTransport(cassette, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewWebClient("unit")
+	client.baseURL = mock.URL
+	client.SetTransport(recorder)
+	client.GetAlarms()
+	recorder.Close()
+
+	interactions, err := LoadCassette(cassette)
+	if err != nil || len(interactions) != 1 || interactions[0].Error == "" {
+		t.Fatalf("got %+v, %v; want one failed interaction", interactions, err)
+	}
+
+	replay := NewWebClient("unit")
+	replay.SetTransport(NewReplayTransport(interactions))
+	if _, err := replay.GetAlarms(); !errors.Is(err, ErrDeviceUnreachable) {
+		t.Errorf("got %v, want ErrDeviceUnreachable", err)
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+	_ "time/tzdata" // CLOCK_TIMEZONE must resolve on hosts without a zoneinfo database
+)
+
+// Device clock parameters
+// The unit keeps local wall-clock time and reports it in I00004-I00009; it is
+// set through the H10905-H10909 registers with minute resolution.
+var (
+	deviceClockParams = []string{"I00004", "I00005", "I00006", "I00007", "I00008", "I00009"}
+	setClockParams    = []string{"H10905", "H10906", "H10907", "H10908", "H10909"}
+)
+
+// DefaultClockMaxDrift is the drift tolerated before the device clock is corrected
+const DefaultClockMaxDrift = 2 * time.Minute
+
+// clockSyncBackoff is the minimum time between two corrections, so a device
+// that ignores the write is not rewritten on every poll
+const clockSyncBackoff = 15 * time.Minute
+
+// ClockStatus compares the device clock with the host clock
+type ClockStatus struct {
+	DeviceTime   string     `json:"device_time"` // device wall clock, "2006-01-02 15:04:05"
+	HostTime     string     `json:"host_time"`   // host wall clock in Timezone
+	Timezone     string     `json:"timezone"`
+	UTCOffset    string     `json:"utc_offset"`
+	DST          bool       `json:"dst"`
+	DriftSeconds float64    `json:"drift_seconds"` // positive when the device is ahead
+	InSync       bool       `json:"in_sync"`
+	SyncEnabled  bool       `json:"sync_enabled"`
+	LastSync     *time.Time `json:"last_sync,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+}
+
+// GetDeviceClock returns the wall-clock time reported by the device
+// The result carries the UTC location; only its fields are meaningful.
+func (d *DeviceData) GetDeviceClock() (time.Time, error) {
+	var fields [6]int
+	for i, id := range deviceClockParams {
+		value, err := d.GetIntValue(id)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("device clock: %w", err)
+		}
+		fields[i] = value
+	}
+	return time.Date(fields[0], time.Month(fields[1]), fields[2], fields[3], fields[4], fields[5], 0, time.UTC), nil
+}
+
+// wallClock returns t's wall-clock fields in loc, carried in UTC so two wall
+// clocks can be subtracted without DST ambiguity
+func wallClock(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
+
+// ClockSync measures the device clock drift and corrects it when enabled
+// Drift is computed between wall clocks in the configured zone, so the device
+// follows DST transitions: after a change the drift is one hour and the next
+// poll writes the new local time.
+type ClockSync struct {
+	loc      *time.Location
+	maxDrift time.Duration
+	enabled  bool
+	client   *WebClient
+	now      func() time.Time
+	after    func(time.Duration) <-chan time.Time
+
+	ctx     context.Context // cancelled by Stop, ends a pending background sync
+	cancel  context.CancelFunc
+	running sync.WaitGroup
+
+	mutex    sync.Mutex
+	syncing  bool
+	lastSync time.Time
+	lastErr  error
+}
+
+// NewClockSync creates a clock sync for the zone named tz ("" or "Local" for the host zone)
+func NewClockSync(tz string, maxDrift time.Duration, enabled bool, client *WebClient) (*ClockSync, error) {
+	loc, err := loadClockZone(tz)
+	if err != nil {
+		return nil, err
+	}
+	if maxDrift <= 0 {
+		maxDrift = DefaultClockMaxDrift
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &ClockSync{
+		loc:      loc,
+		maxDrift: maxDrift,
+		enabled:  enabled,
+		client:   client,
+		now:      time.Now,
+		after:    time.After,
+		ctx:      ctx,
+		cancel:   cancel,
+	}, nil
+}
+
+func loadClockZone(tz string) (*time.Location, error) {
+	if tz == "" || tz == "Local" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q: %w", tz, err)
+	}
+	return loc, nil
+}
+
+// Measure compares the device clock in a snapshot with the host clock
+func (cs *ClockSync) Measure(data *DeviceData) (ClockStatus, error) {
+	device, err := data.GetDeviceClock()
+	if err != nil {
+		return ClockStatus{}, err
+	}
+
+	now := cs.now()
+	host := wallClock(now, cs.loc)
+	zone, offset := now.In(cs.loc).Zone()
+	drift := device.Sub(host)
+
+	status := ClockStatus{
+		DeviceTime:   device.Format("2006-01-02 15:04:05"),
+		HostTime:     host.Format("2006-01-02 15:04:05"),
+		Timezone:     fmt.Sprintf("%s (%s)", cs.loc, zone),
+		UTCOffset:    formatUTCOffset(offset),
+		DST:          now.In(cs.loc).IsDST(),
+		DriftSeconds: drift.Seconds(),
+		InSync:       drift.Abs() <= cs.maxDrift,
+		SyncEnabled:  cs.enabled,
+	}
+
+	cs.mutex.Lock()
+	if !cs.lastSync.IsZero() {
+		lastSync := cs.lastSync
+		status.LastSync = &lastSync
+	}
+	if cs.lastErr != nil {
+		status.LastError = cs.lastErr.Error()
+	}
+	cs.mutex.Unlock()
+	return status, nil
+}
+
+// Observe checks a polled snapshot and corrects the device clock in the
+// background when the drift exceeds the threshold
+func (cs *ClockSync) Observe(data *DeviceData) {
+	status, err := cs.Measure(data)
+	if err != nil || status.InSync || !cs.enabled {
+		return
+	}
+
+	cs.mutex.Lock()
+	if cs.syncing || cs.ctx.Err() != nil || (!cs.lastSync.IsZero() && cs.now().Sub(cs.lastSync) < clockSyncBackoff) {
+		cs.mutex.Unlock()
+		return
+	}
+	cs.syncing = true
+	cs.running.Add(1)
+	cs.mutex.Unlock()
+
+	log.Printf("⚠ Device clock drift %.0fs (device %s, host %s)", status.DriftSeconds, status.DeviceTime, status.HostTime)
+	go func() {
+		defer cs.running.Done()
+		cs.Sync(cs.ctx)
+	}()
+}
+
+// Stop cancels a background sync still waiting for its minute and waits for
+// one already writing, or returns ctx.Err() when ctx ends first
+func (cs *ClockSync) Stop(ctx context.Context) error {
+	cs.mutex.Lock()
+	cs.cancel()
+	cs.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		cs.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Sync writes the host wall-clock time in the configured zone to the device
+// The device only takes minutes, so the write waits for the next full minute;
+// it is not made when ctx ends while waiting.
+func (cs *ClockSync) Sync(ctx context.Context) error {
+	now := cs.now()
+	next := now.Truncate(time.Minute).Add(time.Minute)
+	select {
+	case <-cs.after(next.Sub(now)):
+	case <-ctx.Done():
+	}
+	if err := ctx.Err(); err != nil {
+		cs.mutex.Lock()
+		cs.syncing = false
+		cs.mutex.Unlock()
+		log.Printf("⚠ Device clock sync cancelled before the write")
+		return err
+	}
+
+	err := NewSystemControl(cs.client.WithCaller("clock-sync")).SetSystemTime(next.In(cs.loc))
+
+	cs.mutex.Lock()
+	cs.syncing = false
+	cs.lastSync = cs.now()
+	cs.lastErr = err
+	cs.mutex.Unlock()
+
+	if err != nil {
+		log.Printf("✗ Device clock sync failed: %v", err)
+		return err
+	}
+	log.Printf("✓ Device clock set to %s", next.In(cs.loc).Format("2006-01-02 15:04 MST"))
+	return nil
+}
+
+// formatUTCOffset formats an offset in seconds as "+01:00"
+func formatUTCOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign = "-"
+		seconds = -seconds
+	}
+	return fmt.Sprintf("%s%02d:%02d", sign, seconds/3600, seconds%3600/60)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// deviceClockSnapshot returns a snapshot whose device clock shows the given wall time
+func deviceClockSnapshot(year, month, day, hour, minute, second int) *DeviceData {
+	items := make(map[string]string)
+	for i, value := range []int{year, month, day, hour, minute, second} {
+		items[deviceClockParams[i]] = strconv.Itoa(value)
+	}
+	return &DeviceData{Items: items}
+}
+
+// TestGetDeviceClockWithRealData tests reading the device clock from the captured response
+func TestGetDeviceClockWithRealData(t *testing.T) {
+	configData, err := os.ReadFile(filepath.Join("testdata", "response_config.xml"))
+	if err != nil {
+		t.Skipf("skipping test: cannot load test data (%v)", err)
+	}
+	deviceData, err := ParseXMLData(string(configData))
+	if err != nil {
+		t.Fatalf("failed to parse XML: %v", err)
+	}
+
+	clock, err := deviceData.GetDeviceClock()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := clock.Format("2006-01-02 15:04:05"); got != "2025-11-17 11:34:12" {
+		t.Errorf("got %s, want 2025-11-17 11:34:12", got)
+	}
+}
+
+// TestClockSyncAcrossDST tests that the device is corrected to the new local
+// time after the spring DST transition
+func TestClockSyncAcrossDST(t *testing.T) {
+	device := &fakeDevice{values: map[string]string{}}
+	server := httptest.NewServer(device)
+	defer server.Close()
+	client := NewWebClient(server.Listener.Addr().String())
+	client.baseURL = server.URL
+
+	cs, err := NewClockSync("Europe/Prague", 2*time.Minute, true, client)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// 2025-03-30 03:10:30 CEST, one hour after clocks went forward
+	now := time.Date(2025, 3, 30, 1, 10, 30, 0, time.UTC)
+	cs.now = func() time.Time { return now }
+	cs.after = func(d time.Duration) <-chan time.Time {
+		now = now.Add(d)
+		return time.After(0)
+	}
+
+	// The device still shows winter time
+	status, err := cs.Measure(deviceClockSnapshot(2025, 3, 30, 2, 10, 30))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if status.DriftSeconds != -3600 || status.InSync || !status.DST || status.UTCOffset != "+02:00" {
+		t.Errorf("got %+v, want drift -3600s in CEST", status)
+	}
+
+	if err := cs.Sync(context.Background()); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	want := map[string]string{"H10905": "2025", "H10906": "3", "H10907": "30", "H10908": "3", "H10909": "11"}
+	for id, value := range want {
+		if device.values[id] != value {
+			t.Errorf("%s: got %q, want %q", id, device.values[id], value)
+		}
+	}
+}
+
+// TestClockSyncWithinThreshold tests that small drift is reported but not corrected
+func TestClockSyncWithinThreshold(t *testing.T) {
+	cs, err := NewClockSync("UTC", 2*time.Minute, true, NewWebClient("127.0.0.1"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cs.now = func() time.Time { return time.Date(2025, 11, 17, 11, 34, 0, 0, time.UTC) }
+
+	status, err := cs.Measure(deviceClockSnapshot(2025, 11, 17, 11, 34, 45))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if status.DriftSeconds != 45 || !status.InSync {
+		t.Errorf("got %+v, want drift 45s in sync", status)
+	}
+}
+
+// TestClockSyncStop tests that stopping cancels a sync waiting for its minute
+// before it writes to the device
+func TestClockSyncStop(t *testing.T) {
+	device := &fakeDevice{values: map[string]string{}}
+	server := httptest.NewServer(device)
+	defer server.Close()
+	client := NewWebClient(server.Listener.Addr().String())
+	client.baseURL = server.URL
+
+	cs, err := NewClockSync("UTC", 2*time.Minute, true, client)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cs.now = func() time.Time { return time.Date(2025, 11, 17, 11, 34, 30, 0, time.UTC) }
+	cs.after = func(time.Duration) <-chan time.Time { return nil } // the minute never comes
+
+	cs.Observe(deviceClockSnapshot(2025, 11, 17, 10, 0, 0))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := cs.Stop(ctx); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if len(device.writes) != 0 {
+		t.Errorf("clock written after Stop: %v", device.writes)
+	}
+	if status, _ := cs.Measure(deviceClockSnapshot(2025, 11, 17, 10, 0, 0)); status.LastSync != nil || status.LastError != "" {
+		t.Errorf("cancelled sync recorded: %+v", status)
+	}
+}
@@ -0,0 +1,633 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultConfigFile is read when no --config path is given
+const DefaultConfigFile = "config.env"
+
+// Config holds every runtime setting of the server and the CLI tools
+//
+// Settings are layered with the precedence flags > environment > config file > defaults.
+// The config file uses the same KEY=VALUE names as the environment variables.
+type Config struct {
+	ConfigFile string
+
+	// Device connection
+	DeviceIP      string
+	DeviceTimeout time.Duration
+
+	// Device request resilience: retries of idempotent reads and the circuit
+	// breaker that fails fast while the unit is unreachable
+	DeviceRetries       int           // attempts per read including the first
+	DeviceRetryDelay    time.Duration // wait before the first retry, doubled for each further one
+	DeviceRetryMaxDelay time.Duration
+	BreakerThreshold    int           // consecutive failed requests that open the breaker
+	BreakerCooldown     time.Duration // how long the breaker stays open before probing
+	DeviceConcurrency   int           // requests sent to the unit at once
+
+	// Cassettes of device HTTP traffic (see RecordingTransport and ReplayTransport)
+	DeviceRecord string // append every device request and response to this file
+	DeviceReplay string // answer device requests from this file instead of the unit
+
+	// Device credentials: either the cleartext password or the pre-hashed
+	// login magic (see PasswordMagic), each optionally read from a file
+	DevicePassword     Secret
+	DevicePasswordFile string
+	DeviceMagic        Secret
+	DeviceMagicFile    string
+
+	// HTTP server
+	ServerPort      int
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	IdleTimeout     time.Duration
+	ShutdownTimeout time.Duration
+
+	// Background polling
+	PollInterval time.Duration
+
+	// API authentication: token -> caller name. Empty disables authentication.
+	AuthTokens map[string]string
+
+	// TLS (both files must be set to enable HTTPS)
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// Directory for persistent state (maintenance history, pending overrides, ...)
+	StateDir string
+
+	// Filter maintenance
+	FilterChangeHours  int    // runtime hours between filter changes
+	FilterWarningHours int    // notify when fewer hours remain
+	FilterResetParam   string // ID=VALUE written to acknowledge a change on the device, if supported
+
+	// Webhook notifications (JSON file, see NotifierConfig)
+	NotifyConfigFile string
+
+	// Automation rules (JSON file, see AutomationConfig)
+	AutomationFile   string
+	AutomationDryRun bool // log actions without writing to the device
+
+	// Guarded system commands (reset, clear_mode, network); empty allows none
+	SystemCommands []string
+	ConfirmTimeout time.Duration // how long a confirmation token is valid
+
+	// Device clock
+	ClockTimezone string        // IANA zone the device clock follows ("Local" for the host zone)
+	ClockSync     bool          // correct the device clock when it drifts
+	ClockMaxDrift time.Duration // drift tolerated before correcting
+
+	// Audit log of device changes (STATE_DIR/audit.jsonl, rotated by size)
+	AuditMaxSizeMB int
+	AuditMaxFiles  int
+
+	// Snapshot history (in memory) and export
+	HistorySize       int    // polled snapshots kept for GET /export.csv
+	InfluxURL         string // InfluxDB write endpoint receiving every snapshot; empty disables
+	InfluxToken       Secret // sent as "Authorization: Token <token>"
+	InfluxMeasurement string
+
+	// Readiness checks (GET /health/ready)
+	HealthStalePolls   int           // poll intervals a snapshot may age before it is stale
+	HealthOfflineGrace time.Duration // how long the device may be offline before readiness fails
+	HealthAlarms       string        // active alarms: ignore, warn or fail
+
+	// Device identity (see DeviceInfo)
+	IdentityParams        map[string][]string // field -> registers, e.g. firmware -> I00020, I00021, I00022
+	ParameterProfilesFile string              // JSON array of ParameterProfile selected by firmware version
+
+	// Fixture capture (--capture)
+	CaptureDir         string   // directory receiving the anonymised responses
+	CaptureScrubParams []string // extra parameter IDs replaced with 0, e.g. serial numbers
+}
+
+// DefaultConfig returns the built-in defaults
+func DefaultConfig() *Config {
+	return &Config{
+		DeviceIP:        "192.168.68.106",
+		DeviceTimeout:   10 * time.Second,
+		ServerPort:      8080,
+		ReadTimeout:     15 * time.Second,
+		WriteTimeout:    30 * time.Second,
+		IdleTimeout:     60 * time.Second,
+		ShutdownTimeout: 30 * time.Second,
+		PollInterval:    DefaultPollInterval,
+		AuthTokens:      map[string]string{},
+		IdentityParams:  map[string][]string{"firmware": {"I00020", "I00021", "I00022"}}, // RD5 version registers
+		StateDir:        "state",
+
+		DeviceRetries:       DefaultRetryPolicy.Attempts,
+		DeviceRetryDelay:    DefaultRetryPolicy.BaseDelay,
+		DeviceRetryMaxDelay: DefaultRetryPolicy.MaxDelay,
+		BreakerThreshold:    DefaultBreakerThreshold,
+		BreakerCooldown:     DefaultBreakerCooldown,
+		DeviceConcurrency:   DefaultDeviceConcurrency,
+
+		FilterChangeHours:  2000,
+		FilterWarningHours: 100,
+
+		ConfirmTimeout: DefaultConfirmTimeout,
+
+		ClockTimezone: "Local",
+		ClockMaxDrift: DefaultClockMaxDrift,
+
+		AuditMaxSizeMB: 10,
+		AuditMaxFiles:  5,
+
+		HistorySize:       DefaultHistorySize,
+		InfluxMeasurement: DefaultInfluxMeasurement,
+
+		HealthStalePolls: DefaultHealthStalePolls,
+		HealthAlarms:     HealthAlarmsIgnore,
+
+		CaptureDir: "testdata",
+	}
+}
+
+// configSetting describes one setting: its file/env key, its flag and how to apply a value
+type configSetting struct {
+	key   string
+	flag  string
+	usage string
+	apply func(c *Config, value string) error
+}
+
+var configSettings = []configSetting{
+	{"DEVICE_IP", "device-ip", "IP address or host name of the RD5 unit", func(c *Config, v string) error {
+		c.DeviceIP = v
+		return nil
+	}},
+	{"DEVICE_PASSWORD", "device-password", "device web password (prefer DEVICE_PASSWORD_FILE or DEVICE_MAGIC)", func(c *Config, v string) error {
+		c.DevicePassword = Secret(v)
+		return nil
+	}},
+	{"DEVICE_PASSWORD_FILE", "device-password-file", "file containing the device web password", func(c *Config, v string) error {
+		c.DevicePasswordFile = v
+		return nil
+	}},
+	{"DEVICE_MAGIC", "device-magic", "pre-hashed login magic, see --print-magic", func(c *Config, v string) error {
+		c.DeviceMagic = Secret(v)
+		return nil
+	}},
+	{"DEVICE_MAGIC_FILE", "device-magic-file", "file containing the pre-hashed login magic", func(c *Config, v string) error {
+		c.DeviceMagicFile = v
+		return nil
+	}},
+	{"DEVICE_TIMEOUT", "device-timeout", "timeout for a single device request (e.g. 10s)", durationSetter(func(c *Config) *time.Duration { return &c.DeviceTimeout })},
+	{"DEVICE_RETRIES", "device-retries", "attempts per device read including the first (1 disables retries)", intSetter(func(c *Config) *int { return &c.DeviceRetries })},
+	{"DEVICE_RETRY_DELAY", "device-retry-delay", "wait before the first retry of a device read, doubled for each further one", durationSetter(func(c *Config) *time.Duration { return &c.DeviceRetryDelay })},
+	{"DEVICE_RETRY_MAX_DELAY", "device-retry-max-delay", "upper bound of the wait between device read retries", durationSetter(func(c *Config) *time.Duration { return &c.DeviceRetryMaxDelay })},
+	{"BREAKER_THRESHOLD", "breaker-threshold", "consecutive failed device requests before requests fail fast", intSetter(func(c *Config) *int { return &c.BreakerThreshold })},
+	{"BREAKER_COOLDOWN", "breaker-cooldown", "how long requests fail fast before the device is probed again", durationSetter(func(c *Config) *time.Duration { return &c.BreakerCooldown })},
+	{"DEVICE_CONCURRENCY", "device-concurrency", "device requests sent at once; others wait in a queue", intSetter(func(c *Config) *int { return &c.DeviceConcurrency })},
+	{"SERVER_PORT", "port", "HTTP server port", func(c *Config, v string) error {
+		port, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid port %q", v)
+		}
+		c.ServerPort = port
+		return nil
+	}},
+	{"READ_TIMEOUT", "read-timeout", "HTTP server read timeout", durationSetter(func(c *Config) *time.Duration { return &c.ReadTimeout })},
+	{"WRITE_TIMEOUT", "write-timeout", "HTTP server write timeout", durationSetter(func(c *Config) *time.Duration { return &c.WriteTimeout })},
+	{"IDLE_TIMEOUT", "idle-timeout", "HTTP server idle connection timeout", durationSetter(func(c *Config) *time.Duration { return &c.IdleTimeout })},
+	{"SHUTDOWN_TIMEOUT", "shutdown-timeout", "time allowed to drain requests on shutdown", durationSetter(func(c *Config) *time.Duration { return &c.ShutdownTimeout })},
+	{"POLL_INTERVAL", "poll-interval", "background device polling interval", durationSetter(func(c *Config) *time.Duration { return &c.PollInterval })},
+	{"AUTH_TOKENS", "auth-tokens", "comma-separated API tokens as name:token (empty disables auth)", func(c *Config, v string) error {
+		tokens, err := parseAuthTokens(v)
+		if err != nil {
+			return err
+		}
+		c.AuthTokens = tokens
+		return nil
+	}},
+	{"TLS_CERT_FILE", "tls-cert", "TLS certificate file (enables HTTPS together with --tls-key)", func(c *Config, v string) error {
+		c.TLSCertFile = v
+		return nil
+	}},
+	{"TLS_KEY_FILE", "tls-key", "TLS private key file", func(c *Config, v string) error {
+		c.TLSKeyFile = v
+		return nil
+	}},
+	{"STATE_DIR", "state-dir", "directory for persistent state", stringSetter(func(c *Config) *string { return &c.StateDir })},
+	{"FILTER_CHANGE_HOURS", "filter-change-hours", "runtime hours between filter changes", intSetter(func(c *Config) *int { return &c.FilterChangeHours })},
+	{"FILTER_WARNING_HOURS", "filter-warning-hours", "notify when fewer filter hours remain", intSetter(func(c *Config) *int { return &c.FilterWarningHours })},
+	{"FILTER_RESET_PARAM", "filter-reset-param", "ID=VALUE written to acknowledge a filter change on the device", stringSetter(func(c *Config) *string { return &c.FilterResetParam })},
+	{"NOTIFY_CONFIG_FILE", "notify-config", "JSON file with webhook notification rules", stringSetter(func(c *Config) *string { return &c.NotifyConfigFile })},
+	{"AUTOMATION_FILE", "automation", "JSON file with automation rules", stringSetter(func(c *Config) *string { return &c.AutomationFile })},
+	{"AUTOMATION_DRY_RUN", "automation-dry-run", "log automation actions without writing them (true/false)", boolSetter(func(c *Config) *bool { return &c.AutomationDryRun })},
+	{"SYSTEM_COMMANDS", "system-commands", "comma-separated system commands the API may issue (reset, clear_mode, network)", func(c *Config, v string) error {
+		commands, err := parseSystemCommands(v)
+		if err != nil {
+			return err
+		}
+		c.SystemCommands = commands
+		return nil
+	}},
+	{"CONFIRM_TIMEOUT", "confirm-timeout", "how long a system command confirmation token is valid", durationSetter(func(c *Config) *time.Duration { return &c.ConfirmTimeout })},
+	{"CLOCK_TIMEZONE", "clock-timezone", "IANA time zone of the device clock, e.g. Europe/Prague (default host zone)", stringSetter(func(c *Config) *string { return &c.ClockTimezone })},
+	{"CLOCK_SYNC", "clock-sync", "set the device clock when it drifts (true/false)", boolSetter(func(c *Config) *bool { return &c.ClockSync })},
+	{"CLOCK_MAX_DRIFT", "clock-max-drift", "device clock drift tolerated before correcting", durationSetter(func(c *Config) *time.Duration { return &c.ClockMaxDrift })},
+	{"AUDIT_MAX_SIZE_MB", "audit-max-size", "rotate the audit log when it reaches this size in MB", intSetter(func(c *Config) *int { return &c.AuditMaxSizeMB })},
+	{"AUDIT_MAX_FILES", "audit-max-files", "number of audit log files to keep", intSetter(func(c *Config) *int { return &c.AuditMaxFiles })},
+	{"DEVICE_RECORD", "device-record", "append device requests and responses to this cassette file (credentials redacted)", stringSetter(func(c *Config) *string { return &c.DeviceRecord })},
+	{"DEVICE_REPLAY", "device-replay", "answer device requests from this cassette file instead of the unit", stringSetter(func(c *Config) *string { return &c.DeviceReplay })},
+	{"HISTORY_SIZE", "history-size", "number of polled snapshots kept for CSV export", intSetter(func(c *Config) *int { return &c.HistorySize })},
+	{"INFLUX_URL", "influx-url", "InfluxDB write URL receiving every snapshot in line protocol, e.g. http://influx:8086/api/v2/write?org=home&bucket=atrea", stringSetter(func(c *Config) *string { return &c.InfluxURL })},
+	{"INFLUX_TOKEN", "influx-token", "InfluxDB API token", func(c *Config, v string) error {
+		c.InfluxToken = Secret(v)
+		return nil
+	}},
+	{"INFLUX_MEASUREMENT", "influx-measurement", "InfluxDB measurement name", stringSetter(func(c *Config) *string { return &c.InfluxMeasurement })},
+	{"HEALTH_STALE_POLLS", "health-stale-polls", "poll intervals without a successful poll before readiness fails", intSetter(func(c *Config) *int { return &c.HealthStalePolls })},
+	{"HEALTH_OFFLINE_GRACE", "health-offline-grace", "how long the device may be unreachable before readiness fails (0 fails at once)", durationSetter(func(c *Config) *time.Duration { return &c.HealthOfflineGrace })},
+	{"HEALTH_ALARMS", "health-alarms", "how active alarms affect readiness: ignore, warn or fail", stringSetter(func(c *Config) *string { return &c.HealthAlarms })},
+	{"DEVICE_IDENTITY_PARAMS", "device-identity-params", "registers holding the unit's identity as field:ID[.ID...], e.g. firmware:I00020.I00021.I00022,serial:I00123", func(c *Config, v string) error {
+		identity, err := parseIdentityParams(v)
+		if err != nil {
+			return err
+		}
+		c.IdentityParams = identity
+		return nil
+	}},
+	{"PARAMETER_PROFILES", "parameter-profiles", "JSON file with parameter names and decodings per firmware version", stringSetter(func(c *Config) *string { return &c.ParameterProfilesFile })},
+	{"CAPTURE_DIR", "capture-dir", "directory receiving fixtures written by --capture", stringSetter(func(c *Config) *string { return &c.CaptureDir })},
+	{"CAPTURE_SCRUB_PARAMS", "capture-scrub-params", "comma-separated parameter IDs blanked in captured fixtures, e.g. serial numbers", func(c *Config, v string) error {
+		c.CaptureScrubParams = nil
+		for _, id := range strings.Split(v, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				c.CaptureScrubParams = append(c.CaptureScrubParams, id)
+			}
+		}
+		return nil
+	}},
+}
+
+func stringSetter(field func(c *Config) *string) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		*field(c) = v
+		return nil
+	}
+}
+
+func intSetter(field func(c *Config) *int) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", v)
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+func boolSetter(field func(c *Config) *bool) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", v)
+		}
+		*field(c) = b
+		return nil
+	}
+}
+
+func durationSetter(field func(c *Config) *time.Duration) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", v)
+		}
+		*field(c) = d
+		return nil
+	}
+}
+
+// parseAuthTokens parses "alice:token1,bob:token2"; a bare token is named "api"
+func parseAuthTokens(value string) (map[string]string, error) {
+	tokens := make(map[string]string)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, token := "api", entry
+		if i := strings.Index(entry, ":"); i != -1 {
+			name, token = strings.TrimSpace(entry[:i]), strings.TrimSpace(entry[i+1:])
+		}
+		if name == "" || token == "" {
+			return nil, fmt.Errorf("invalid auth token entry %q (want name:token)", entry)
+		}
+		if _, dup := tokens[token]; dup {
+			return nil, fmt.Errorf("duplicate auth token for %q", name)
+		}
+		tokens[token] = name
+	}
+	return tokens, nil
+}
+
+// LoadConfig registers the configuration flags on fs, parses args and
+// returns the layered configuration (flags > environment > file > defaults)
+func LoadConfig(fs *flag.FlagSet, args []string) (*Config, error) {
+	configPath := fs.String("config", "", "path to the KEY=VALUE configuration file (default "+DefaultConfigFile+")")
+	flagValues := make(map[string]*string)
+	for _, setting := range configSettings {
+		flagValues[setting.flag] = fs.String(setting.flag, "", setting.usage+" ["+setting.key+"]")
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg := DefaultConfig()
+
+	// Layer 1: config file
+	cfg.ConfigFile = *configPath
+	explicit := cfg.ConfigFile != ""
+	if !explicit {
+		cfg.ConfigFile = DefaultConfigFile
+	}
+	if err := cfg.loadFile(cfg.ConfigFile); err != nil {
+		if !explicit && errors.Is(err, os.ErrNotExist) {
+			cfg.ConfigFile = ""
+		} else {
+			return nil, err
+		}
+	}
+
+	// Layer 2: environment
+	for _, setting := range configSettings {
+		if value, ok := os.LookupEnv(setting.key); ok {
+			if err := setting.apply(cfg, strings.TrimSpace(value)); err != nil {
+				return nil, fmt.Errorf("environment %s: %w", setting.key, err)
+			}
+		}
+	}
+
+	// Layer 3: flags that were explicitly set
+	var flagErr error
+	fs.Visit(func(f *flag.Flag) {
+		value, ok := flagValues[f.Name]
+		if !ok || flagErr != nil {
+			return
+		}
+		for _, setting := range configSettings {
+			if setting.flag == f.Name {
+				if err := setting.apply(cfg, *value); err != nil {
+					flagErr = fmt.Errorf("flag --%s: %w", f.Name, err)
+				}
+			}
+		}
+	})
+	if flagErr != nil {
+		return nil, flagErr
+	}
+
+	if err := cfg.resolveSecrets(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// loadFile applies KEY=VALUE lines from path
+func (c *Config) loadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		// Skip empty lines and comments
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("%s:%d: expected KEY=VALUE, got %q", path, lineNo, line)
+		}
+
+		key := strings.TrimSpace(parts[0])
+		value := strings.Trim(strings.TrimSpace(parts[1]), `"'`)
+
+		setting, ok := findConfigSetting(key)
+		if !ok {
+			return fmt.Errorf("%s:%d: unknown setting %q", path, lineNo, key)
+		}
+		if err := setting.apply(c, value); err != nil {
+			return fmt.Errorf("%s:%d: %s: %w", path, lineNo, key, err)
+		}
+	}
+
+	return scanner.Err()
+}
+
+func findConfigSetting(key string) (configSetting, bool) {
+	for _, setting := range configSettings {
+		if setting.key == key {
+			return setting, true
+		}
+	}
+	return configSetting{}, false
+}
+
+// Validate checks the configuration for values the server cannot run with
+func (c *Config) Validate() error {
+	var problems []string
+
+	if c.DeviceIP == "" {
+		problems = append(problems, "DEVICE_IP must not be empty")
+	} else if strings.ContainsAny(c.DeviceIP, "/ ") {
+		problems = append(problems, fmt.Sprintf("DEVICE_IP %q must be a host or IP address, not a URL", c.DeviceIP))
+	}
+	if c.DevicePassword == "" && c.DeviceMagic == "" {
+		problems = append(problems, "no device credentials: set DEVICE_PASSWORD_FILE, DEVICE_MAGIC(_FILE), DEVICE_PASSWORD or a systemd credential")
+	}
+	if c.DeviceMagic != "" && !validMagic(c.DeviceMagic.Reveal()) {
+		problems = append(problems, "DEVICE_MAGIC must be a 32 character hex MD5 digest")
+	}
+	if c.ServerPort < 1 || c.ServerPort > 65535 {
+		problems = append(problems, fmt.Sprintf("SERVER_PORT %d out of range 1-65535", c.ServerPort))
+	}
+
+	durations := map[string]time.Duration{
+		"DEVICE_TIMEOUT":         c.DeviceTimeout,
+		"READ_TIMEOUT":           c.ReadTimeout,
+		"WRITE_TIMEOUT":          c.WriteTimeout,
+		"IDLE_TIMEOUT":           c.IdleTimeout,
+		"SHUTDOWN_TIMEOUT":       c.ShutdownTimeout,
+		"POLL_INTERVAL":          c.PollInterval,
+		"CONFIRM_TIMEOUT":        c.ConfirmTimeout,
+		"DEVICE_RETRY_DELAY":     c.DeviceRetryDelay,
+		"DEVICE_RETRY_MAX_DELAY": c.DeviceRetryMaxDelay,
+		"BREAKER_COOLDOWN":       c.BreakerCooldown,
+	}
+	keys := make([]string, 0, len(durations))
+	for key := range durations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if durations[key] <= 0 {
+			problems = append(problems, fmt.Sprintf("%s must be positive", key))
+		}
+	}
+	if c.PollInterval > 0 && c.PollInterval < time.Second {
+		problems = append(problems, "POLL_INTERVAL must be at least 1s to protect the device")
+	}
+
+	if c.DeviceRetries < 1 {
+		problems = append(problems, "DEVICE_RETRIES must be at least 1")
+	}
+	if c.DeviceRetryMaxDelay < c.DeviceRetryDelay {
+		problems = append(problems, "DEVICE_RETRY_MAX_DELAY must not be shorter than DEVICE_RETRY_DELAY")
+	}
+	if c.DeviceConcurrency < 1 {
+		problems = append(problems, "DEVICE_CONCURRENCY must be at least 1")
+	}
+	if c.BreakerThreshold < 1 {
+		problems = append(problems, "BREAKER_THRESHOLD must be at least 1")
+	}
+
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		problems = append(problems, "TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+
+	if c.StateDir == "" {
+		problems = append(problems, "STATE_DIR must not be empty")
+	}
+	if c.FilterChangeHours <= 0 {
+		problems = append(problems, "FILTER_CHANGE_HOURS must be positive")
+	}
+	if c.FilterWarningHours < 0 || c.FilterWarningHours >= c.FilterChangeHours {
+		problems = append(problems, "FILTER_WARNING_HOURS must be between 0 and FILTER_CHANGE_HOURS")
+	}
+	if c.FilterResetParam != "" && len(strings.Split(c.FilterResetParam, "=")) != 2 {
+		problems = append(problems, fmt.Sprintf("FILTER_RESET_PARAM %q must be ID=VALUE", c.FilterResetParam))
+	}
+	if c.NotifyConfigFile != "" {
+		if _, err := LoadNotifierConfig(c.NotifyConfigFile); err != nil {
+			problems = append(problems, fmt.Sprintf("NOTIFY_CONFIG_FILE: %v", err))
+		}
+	}
+	if _, err := loadClockZone(c.ClockTimezone); err != nil {
+		problems = append(problems, fmt.Sprintf("CLOCK_TIMEZONE: %v", err))
+	}
+	if c.ClockMaxDrift < time.Minute {
+		problems = append(problems, "CLOCK_MAX_DRIFT must be at least 1m (the device clock is set with minute resolution)")
+	}
+	if c.AuditMaxSizeMB <= 0 || c.AuditMaxFiles <= 0 {
+		problems = append(problems, "AUDIT_MAX_SIZE_MB and AUDIT_MAX_FILES must be positive")
+	}
+	if c.DeviceRecord != "" && c.DeviceReplay != "" {
+		problems = append(problems, "DEVICE_RECORD and DEVICE_REPLAY cannot be used together")
+	}
+	if c.DeviceReplay != "" {
+		if _, err := LoadCassette(c.DeviceReplay); err != nil {
+			problems = append(problems, fmt.Sprintf("DEVICE_REPLAY: %v", err))
+		}
+	}
+	if c.HistorySize < 1 {
+		problems = append(problems, "HISTORY_SIZE must be at least 1")
+	}
+	if c.InfluxURL != "" {
+		if u, err := url.Parse(c.InfluxURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("INFLUX_URL %q must be an http(s) URL", c.InfluxURL))
+		}
+	}
+	if c.HealthStalePolls < 1 {
+		problems = append(problems, "HEALTH_STALE_POLLS must be at least 1")
+	}
+	if c.HealthOfflineGrace < 0 {
+		problems = append(problems, "HEALTH_OFFLINE_GRACE must not be negative")
+	}
+	switch c.HealthAlarms {
+	case HealthAlarmsIgnore, HealthAlarmsWarn, HealthAlarmsFail:
+	default:
+		problems = append(problems, fmt.Sprintf("HEALTH_ALARMS %q must be ignore, warn or fail", c.HealthAlarms))
+	}
+	if c.ParameterProfilesFile != "" {
+		if _, err := LoadParameterProfiles(c.ParameterProfilesFile); err != nil {
+			problems = append(problems, fmt.Sprintf("PARAMETER_PROFILES: %v", err))
+		}
+	}
+	if c.CaptureDir == "" {
+		problems = append(problems, "CAPTURE_DIR must not be empty")
+	}
+	if c.InfluxMeasurement == "" {
+		problems = append(problems, "INFLUX_MEASUREMENT must not be empty")
+	}
+	if c.AutomationFile != "" {
+		if _, err := LoadAutomationConfig(c.AutomationFile); err != nil {
+			problems = append(problems, fmt.Sprintf("AUTOMATION_FILE: %v", err))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// RetryPolicy returns the retry policy for device reads
+func (c *Config) RetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		Attempts:  c.DeviceRetries,
+		BaseDelay: c.DeviceRetryDelay,
+		MaxDelay:  c.DeviceRetryMaxDelay,
+		Jitter:    DefaultRetryPolicy.Jitter,
+	}
+}
+
+// TLSEnabled reports whether the server should serve HTTPS
+func (c *Config) TLSEnabled() bool {
+	return c.TLSCertFile != "" && c.TLSKeyFile != ""
+}
+
+// AuthEnabled reports whether API requests must carry a token
+func (c *Config) AuthEnabled() bool {
+	return len(c.AuthTokens) > 0
+}
+
+// Duration is a time.Duration that reads and writes JSON as "30s", "5m", ...
+type Duration struct {
+	time.Duration
+}
+
+// MarshalJSON encodes the duration as a Go duration string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + d.String() + `"`), nil
+}
+
+// UnmarshalJSON accepts a duration string such as "90s"
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	value, err := strconv.Unquote(string(data))
+	if err != nil {
+		return fmt.Errorf("duration must be a string like \"30s\"")
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q", value)
+	}
+	d.Duration = parsed
+	return nil
+}
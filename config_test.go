@@ -0,0 +1,93 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfigFile writes a temporary config file and returns its path
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.env")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	return path
+}
+
+// TestLoadConfigPrecedence tests that flags override env which overrides the file
+func TestLoadConfigPrecedence(t *testing.T) {
+	path := writeConfigFile(t, "# comment\nDEVICE_IP=10.0.0.1\nDEVICE_MAGIC=993278d1925c378ab94a6fe664ea6c60\nSERVER_PORT=9000\nPOLL_INTERVAL=1m\n")
+	t.Setenv("SERVER_PORT", "9100")
+	t.Setenv("POLL_INTERVAL", "45s")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg, err := LoadConfig(fs, []string{"--config", path, "--poll-interval", "2m"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.DeviceIP != "10.0.0.1" {
+		t.Errorf("DeviceIP: got %s, want 10.0.0.1 (file)", cfg.DeviceIP)
+	}
+	if cfg.ServerPort != 9100 {
+		t.Errorf("ServerPort: got %d, want 9100 (env)", cfg.ServerPort)
+	}
+	if cfg.PollInterval != 2*time.Minute {
+		t.Errorf("PollInterval: got %s, want 2m (flag)", cfg.PollInterval)
+	}
+}
+
+// TestLoadConfigErrors tests that malformed input is reported instead of ignored
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		content string
+		args    []string
+		wantErr string
+	}{
+		{"DEVICE_IP 10.0.0.1\n", nil, "config.env:1: expected KEY=VALUE"},
+		{"SERVER_PORT=http\n", nil, "invalid port"},
+		{"SERVER_PORT=70000\n", nil, "out of range"},
+		{"DEVICE_IPP=10.0.0.1\n", nil, "unknown setting"},
+		{"TLS_CERT_FILE=cert.pem\n", nil, "must be set together"},
+		{"", []string{"--poll-interval", "soon"}, "flag --poll-interval"},
+		{"AUTH_TOKENS=alice:\n", nil, "invalid auth token"},
+	}
+
+	for _, tt := range tests {
+		path := writeConfigFile(t, tt.content)
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		_, err := LoadConfig(fs, append([]string{"--config", path}, tt.args...))
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("content %q args %v: got error %v, want %q", tt.content, tt.args, err, tt.wantErr)
+		}
+	}
+}
+
+// TestLoadConfigMissingExplicitFile tests that an explicit --config path must exist
+func TestLoadConfigMissingExplicitFile(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	_, err := LoadConfig(fs, []string{"--config", filepath.Join(t.TempDir(), "missing.env")})
+	if err == nil {
+		t.Error("expected error for missing config file, got nil")
+	}
+}
+
+// TestParseAuthTokens tests the name:token list format
+func TestParseAuthTokens(t *testing.T) {
+	tokens, err := parseAuthTokens("alice:s3cret, bob:t0ken,bare")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := map[string]string{"s3cret": "alice", "t0ken": "bob", "bare": "api"}
+	for token, name := range want {
+		if tokens[token] != name {
+			t.Errorf("token %s: got name %q, want %q", token, tokens[token], name)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"io/fs"
+	"net/http"
+	"time"
+)
+
+// uiFiles holds the dashboard: a static page that talks to the JSON endpoints
+//
+//go:embed ui
+var uiFiles embed.FS
+
+// uiHandler serves the embedded files below /ui/
+var uiHandler = func() http.Handler {
+	root, err := fs.Sub(uiFiles, "ui")
+	if err != nil {
+		panic(err)
+	}
+	return http.StripPrefix("/ui/", http.FileServer(http.FS(root)))
+}()
+
+// GET /ui/ - Web dashboard
+// The files carry no device data, so they are public; the page asks for an
+// API token when the data endpoints require one.
+func (s *Server) handleUI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	uiHandler.ServeHTTP(w, r)
+}
+
+// dashboardAlarmLog is how many recent alarm log entries the dashboard shows
+const dashboardAlarmLog = 5
+
+// DashboardResponse is what the dashboard shows, taken from the latest poll;
+// the alarm list is read once per poll and shared with the poll subscribers
+type DashboardResponse struct {
+	Time        time.Time           `json:"time"` // when the snapshot was polled
+	Temperature TemperatureResponse `json:"temperature"`
+	Ventilation VentilationResponse `json:"ventilation"`
+	Setpoint    SetpointResponse    `json:"setpoint"`
+	Alarms      []int               `json:"alarms"`    // active codes
+	AlarmLog    []AlarmEvent        `json:"alarm_log"` // most recent entries, newest first
+	Maintenance *MaintenanceStatus  `json:"maintenance,omitempty"`
+}
+
+// GET /dashboard - Temperatures, mode, power, setpoint, alarms and filter status from the latest poll
+func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mutex.RLock()
+	poller := s.poller
+	s.mutex.RUnlock()
+	var data *DeviceData
+	var at time.Time
+	if poller != nil {
+		data, at, _ = poller.Latest()
+	}
+	if data == nil {
+		writeFailure(w, http.StatusServiceUnavailable, CodeUnavailable, "No snapshot polled yet")
+		return
+	}
+
+	indoor, errIn := data.GetCurrentTemperature()
+	outdoor, errOut := data.GetOutdoorTemperature()
+	mode, errMode := data.GetVentilationMode()
+	power, errPower := data.GetFanPower()
+	setpoint, errSetpoint := data.GetDesiredTemperature()
+	if err := errors.Join(errIn, errOut, errMode, errPower, errSetpoint); err != nil {
+		writeError(w, err, "Failed to read the latest snapshot")
+		return
+	}
+	alarms, err := s.polledAlarms(data)
+	if err != nil {
+		writeError(w, err, "Failed to read alarms")
+		return
+	}
+
+	dashboard := DashboardResponse{
+		Time:        at,
+		Temperature: TemperatureResponse{Indoor: indoor, Outdoor: outdoor, Timestamp: at},
+		Ventilation: VentilationResponse{Mode: mode, ModeID: int(mode), Power: power, Timestamp: at},
+		Setpoint: SetpointResponse{
+			Setpoint:   setpoint,
+			RawValue:   data.Items[ParamDesiredTemperature],
+			Min:        MinSetpoint,
+			Max:        MaxSetpoint,
+			Resolution: SetpointResolution,
+		},
+		Alarms:   append([]int{}, alarms.ActiveAlarms()...),
+		AlarmLog: []AlarmEvent{},
+	}
+	for i := len(alarms.Events) - 1; i >= 0 && len(dashboard.AlarmLog) < dashboardAlarmLog; i-- {
+		dashboard.AlarmLog = append(dashboard.AlarmLog, alarms.Events[i])
+	}
+	if s.maintenance != nil {
+		if status, ok := s.maintenance.Status(); ok {
+			dashboard.Maintenance = &status
+		}
+	}
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: dashboard})
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestDashboardServed tests that the embedded dashboard is public while its data is not
+func TestDashboardServed(t *testing.T) {
+	server := newTestServer(t, "http://127.0.0.1:1")
+	server.config.AuthTokens = map[string]string{"s3cret": "alice"}
+	handler := server.Handler()
+
+	tests := []struct {
+		method, path string
+		status       int
+		contains     string
+	}{
+		{"GET", "/ui/", http.StatusOK, "<canvas id=\"chart\""},
+		{"GET", "/ui/app.js", http.StatusOK, "../setpoint"},
+		{"GET", "/ui/style.css", http.StatusOK, ".card"},
+		{"GET", "/ui/missing.js", http.StatusNotFound, ""},
+		{"PUT", "/ui/", http.StatusMethodNotAllowed, ""},
+		{"GET", "/temperature", http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != tt.status || !strings.Contains(w.Body.String(), tt.contains) {
+			t.Errorf("%s %s: got %d, want %d containing %q", tt.method, tt.path, w.Code, tt.status, tt.contains)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/ui", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if location := w.Header().Get("Location"); location != "/ui/" {
+		t.Errorf("GET /ui: got redirect to %q, want /ui/", location)
+	}
+}
+
+// TestAlarmsEndpoint tests the active alarms and log returned by GET /alarms
+func TestAlarmsEndpoint(t *testing.T) {
+	alarmsData, err := os.ReadFile(filepath.Join("testdata", "response_alarms.xml"))
+	if err != nil {
+		t.Skipf("skipping test: cannot load test data (%v)", err)
+	}
+	device := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(alarmsData)
+	}))
+	defer device.Close()
+
+	server := newTestServer(t, device.URL)
+	req := httptest.NewRequest(http.MethodGet, "/alarms", nil)
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+
+	var resp struct {
+		Success bool           `json:"success"`
+		Data    AlarmsResponse `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if w.Code != http.StatusOK || !resp.Success {
+		t.Fatalf("got status %d", w.Code)
+	}
+	if active := fmt.Sprint(resp.Data.Active); active != "[55 56 59 95 124]" {
+		t.Errorf("active alarms: got %s, want [55 56 59 95 124]", active)
+	}
+	events := resp.Data.Events
+	if len(events) != 1126 {
+		t.Fatalf("got %d events, want 1126", len(events))
+	}
+	first := AlarmEvent{Time: time.Unix(1663908742, 0), Code: 1, Phase: AlarmPhaseEvent}
+	if !events[0].Time.Equal(first.Time) || events[0].Code != first.Code || events[0].Phase != first.Phase {
+		t.Errorf("first event: got %+v, want %+v", events[0], first)
+	}
+	for i := 1; i < len(events); i++ {
+		if events[i].Time.Before(events[i-1].Time) {
+			t.Fatalf("event %d is older than the one before it", i)
+		}
+	}
+}
+
+// TestDashboardEndpoint tests that GET /dashboard answers from the latest poll
+func TestDashboardEndpoint(t *testing.T) {
+	device := &fakeDevice{values: map[string]string{
+		"I10215": "214", "I10211": "42", "H10714": "50", "H10715": "2", "H11021": "215",
+	}}
+	reads := 0
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reads++
+		if r.URL.Path == "/config/alarms.xml" {
+			fmt.Fprint(w, `<root><errors t="2025-11-17 11:34:12 "><i t="1663908742" i="1" p="2"/><i t="1663908802" i="55" p="0"/></errors></root>`)
+			return
+		}
+		device.ServeHTTP(w, r)
+	}))
+	defer mock.Close()
+
+	server := newTestServer(t, mock.URL)
+	handler := server.Handler()
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/dashboard", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("before polling: got %d, want 503", w.Code)
+	}
+
+	server.poller = NewPoller(time.Minute, server.pollDeviceData)
+	server.poller.poll()
+	polled := reads
+
+	for i := 0; i < 3; i++ {
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/dashboard", nil))
+	}
+	var resp struct {
+		Data DashboardResponse `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("got %d, %v", w.Code, err)
+	}
+	if reads != polled+1 {
+		t.Errorf("dashboard caused %d device requests, want 1 alarm list read per poll", reads-polled)
+	}
+	data := resp.Data
+	if data.Temperature.Indoor != 21.4 || data.Setpoint.Setpoint != 21.5 || data.Ventilation.Power != 50 {
+		t.Errorf("got %+v", data)
+	}
+	if fmt.Sprint(data.Alarms) != "[55]" {
+		t.Errorf("alarms: got %v, want [55]", data.Alarms)
+	}
+	if len(data.AlarmLog) != 2 || data.AlarmLog[0].Code != 55 || data.AlarmLog[1].Code != 1 {
+		t.Errorf("alarm log: got %+v, want codes 55 then 1", data.AlarmLog)
+	}
+}
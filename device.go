@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultDeviceModel is reported when the unit does not identify its model
+const DefaultDeviceModel = "Atrea RD5"
+
+// unknownFirmware is reported when neither the registers nor ip.cgi carry a version
+const unknownFirmware = "unknown"
+
+// Parameters describing the unit itself
+const (
+	ParamUptime      = "H11406" // hours since power-on
+	ParamNetworkDHCP = "H12200"
+	ParamNetworkIPLo = "H12202" // address as a low/high pair, see IPParameterDecoder
+	ParamNetworkIPHi = "H12203"
+)
+
+// identityFields are the DeviceInfo fields that DEVICE_IDENTITY_PARAMS can map to registers
+var identityFields = []string{"model", "firmware", "serial", "mac"}
+
+// networkIdentityKeys are the ip.cgi field names carrying each identity field
+var networkIdentityKeys = map[string][]string{
+	"model":    {"model", "type", "device"},
+	"firmware": {"fw", "firmware", "version", "ver"},
+	"serial":   {"sn", "serial", "serialnumber"},
+	"mac":      {"mac", "macaddr", "hwaddr"},
+}
+
+// DeviceInfo identifies the unit the server talks to
+type DeviceInfo struct {
+	Model       string `json:"model"`
+	Firmware    string `json:"firmware"` // "unknown" when the unit does not report it
+	Serial      string `json:"serial,omitempty"`
+	MAC         string `json:"mac,omitempty"`
+	IP          string `json:"ip,omitempty"` // address configured on the unit
+	DHCP        bool   `json:"dhcp"`
+	UptimeHours int    `json:"uptime_hours"`
+	Profile     string `json:"parameter_profile,omitempty"` // parameter map selected for the firmware
+
+	profile *ParameterProfile // the selected profile, nil for the built-in map
+}
+
+// ExtractDeviceInfo combines the identity data of a snapshot and the ip.cgi
+// settings. identity maps a field to the registers holding it (see
+// parseIdentityParams); registers take precedence over ip.cgi fields.
+func ExtractDeviceInfo(data *DeviceData, network map[string]string, identity map[string][]string) DeviceInfo {
+	info := DeviceInfo{}
+	fields := map[string]*string{"model": &info.Model, "firmware": &info.Firmware, "serial": &info.Serial, "mac": &info.MAC}
+	for _, field := range identityFields {
+		if value, ok := registerIdentity(data, identity[field]); ok {
+			*fields[field] = value
+			continue
+		}
+		for _, key := range networkIdentityKeys[field] {
+			if value := strings.TrimSpace(network[key]); value != "" {
+				*fields[field] = value
+				break
+			}
+		}
+	}
+	if info.Model == "" {
+		info.Model = DefaultDeviceModel
+	}
+	if info.Firmware == "" {
+		info.Firmware = unknownFirmware
+	}
+	info.MAC = strings.ToUpper(strings.ReplaceAll(info.MAC, "-", ":"))
+
+	if data != nil {
+		if hours, err := data.GetIntValue(ParamUptime); err == nil {
+			info.UptimeHours = hours
+		}
+		if dhcp, err := data.GetIntValue(ParamNetworkDHCP); err == nil {
+			info.DHCP = dhcp != 0
+		}
+		low, errLow := data.GetIntValue(ParamNetworkIPLo)
+		high, errHigh := data.GetIntValue(ParamNetworkIPHi)
+		if errLow == nil && errHigh == nil && (low != 0 || high != 0) {
+			info.IP = IPParameterDecoder(low, high)
+		}
+	}
+	return info
+}
+
+// registerIdentity joins the values of ids with dots, e.g. three version
+// registers into "2.3.36"; it fails when any of them is missing
+func registerIdentity(data *DeviceData, ids []string) (string, bool) {
+	if data == nil || len(ids) == 0 {
+		return "", false
+	}
+	values := make([]string, len(ids))
+	for i, id := range ids {
+		value, ok := data.GetValue(id)
+		if !ok {
+			return "", false
+		}
+		values[i] = value
+	}
+	return strings.Join(values, "."), true
+}
+
+// ParseNetworkSettings reads the fields of an ip.cgi response, which is XML
+// on some firmware and key=value pairs on others. Keys are lowercased.
+func ParseNetworkSettings(body string) map[string]string {
+	fields := make(map[string]string)
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return fields
+	}
+
+	if !strings.HasPrefix(body, "<") {
+		body = strings.NewReplacer("\r\n", "&", "\n", "&", ";", "&").Replace(body)
+		values, _ := url.ParseQuery(body)
+		for key, value := range values {
+			fields[strings.ToLower(strings.TrimSpace(key))] = value[0]
+		}
+		return fields
+	}
+
+	decoder := xml.NewDecoder(strings.NewReader(body))
+	var element string
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break // end of input, or malformed: keep the fields read so far
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			element = strings.ToLower(t.Name.Local)
+			for _, attr := range t.Attr {
+				fields[strings.ToLower(attr.Name.Local)] = attr.Value
+			}
+		case xml.CharData:
+			if text := strings.TrimSpace(string(t)); text != "" && element != "" {
+				fields[element] = text
+			}
+		case xml.EndElement:
+			element = ""
+		}
+	}
+	return fields
+}
+
+// parseIdentityParams parses "firmware:I00020.I00021.I00022,serial:I00123"
+func parseIdentityParams(value string) (map[string][]string, error) {
+	identity := make(map[string][]string)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		field, ids, ok := strings.Cut(entry, ":")
+		field = strings.ToLower(strings.TrimSpace(field))
+		if !ok || strings.TrimSpace(ids) == "" || !containsString(identityFields, field) {
+			return nil, fmt.Errorf("invalid identity entry %q (want %s:ID[.ID...])", entry, strings.Join(identityFields, "|"))
+		}
+		for _, id := range strings.Split(ids, ".") {
+			if id = strings.TrimSpace(id); id == "" {
+				return nil, fmt.Errorf("invalid identity entry %q", entry)
+			}
+			identity[field] = append(identity[field], id)
+		}
+	}
+	return identity, nil
+}
+
+func containsString(values []string, s string) bool {
+	for _, value := range values {
+		if value == s {
+			return true
+		}
+	}
+	return false
+}
+
+// identify reads the unit's identity and selects the parameter profile for its
+// firmware; data is fetched when nil
+func (s *Server) identify(client *WebClient, data *DeviceData) (*DeviceInfo, error) {
+	if data == nil {
+		var err error
+		if data, err = s.fetchDeviceDataWith(client); err != nil {
+			return nil, err
+		}
+	}
+	// ip.cgi only adds detail; a unit that refuses it is still identified
+	network, err := client.GetNetworkSettings()
+	if err != nil {
+		network = ""
+	}
+
+	cfg := s.settings()
+	info := ExtractDeviceInfo(data, ParseNetworkSettings(network), cfg.IdentityParams)
+	if info.profile = SelectParameterProfile(s.profiles, info.Firmware); info.profile != nil {
+		info.Profile = info.profile.Name
+	}
+	data.profile = info.profile
+
+	s.mutex.Lock()
+	previous := s.info
+	s.info = &info
+	s.mutex.Unlock()
+	if previous == nil || previous.Firmware != info.Firmware || previous.Profile != info.Profile {
+		log.Printf("🔧 Device identified: %s, firmware %s, parameter profile %q", info.Model, info.Firmware, info.Profile)
+	}
+	return &info, nil
+}
+
+// parameterProfile returns the profile selected for the identified unit, nil
+// for the built-in parameter map or before the unit is identified
+func (s *Server) parameterProfile() *ParameterProfile {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.info == nil {
+		return nil
+	}
+	return s.info.profile
+}
+
+// deviceModel returns the identified model, identifying the unit from data on first use
+func (s *Server) deviceModel(data *DeviceData) string {
+	s.mutex.RLock()
+	info := s.info
+	s.mutex.RUnlock()
+	if info == nil {
+		info, _ = s.identify(s.client, data)
+	}
+	return info.Model
+}
+
+// GET /device - Model, firmware, serial, network identity and uptime of the unit
+func (s *Server) handleDevice(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	info, err := s.identify(s.deviceClient(r), nil)
+	if err != nil {
+		writeError(w, err, "Failed to identify device")
+		return
+	}
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: info})
+}
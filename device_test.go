@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestParseNetworkSettings tests both ip.cgi response formats
+func TestParseNetworkSettings(t *testing.T) {
+	text := ParseNetworkSettings("dhcp=0\r\nMAC=00-1a-2b-3c-4d-5e\r\nsn=AT0001")
+	if text["mac"] != "00-1a-2b-3c-4d-5e" || text["sn"] != "AT0001" || text["dhcp"] != "0" {
+		t.Errorf("key=value: got %v", text)
+	}
+
+	xmlFields := ParseNetworkSettings(`<root><net dhcp="1" mac="00:1A:2B:3C:4D:5E"/><fw>2.3.36</fw></root>`)
+	if xmlFields["mac"] != "00:1A:2B:3C:4D:5E" || xmlFields["fw"] != "2.3.36" || xmlFields["dhcp"] != "1" {
+		t.Errorf("XML: got %v", xmlFields)
+	}
+}
+
+// TestExtractDeviceInfo tests that registers take precedence over ip.cgi fields
+func TestExtractDeviceInfo(t *testing.T) {
+	data := &DeviceData{Items: map[string]string{
+		"I00020": "2", "I00021": "3", "I00022": "36",
+		"H11406": "1520", "H12200": "0", "H12202": "43200", "H12203": "27204",
+	}}
+	network := map[string]string{"fw": "9.9", "mac": "00-1a-2b-3c-4d-5e", "sn": "AT0001"}
+	identity := map[string][]string{"firmware": {"I00020", "I00021", "I00022"}, "serial": {"I09999"}}
+
+	info := ExtractDeviceInfo(data, network, identity)
+	want := DeviceInfo{Model: DefaultDeviceModel, Firmware: "2.3.36", Serial: "AT0001", MAC: "00:1A:2B:3C:4D:5E", IP: "192.168.68.106", UptimeHours: 1520}
+	if info != want {
+		t.Errorf("got  %+v\nwant %+v", info, want)
+	}
+
+	if info := ExtractDeviceInfo(&DeviceData{Items: map[string]string{}}, nil, nil); info.Firmware != "unknown" || info.IP != "" {
+		t.Errorf("without identity data: got %+v", info)
+	}
+
+	if _, err := parseIdentityParams("firmware:I00020.I00021,serial:I00123"); err != nil {
+		t.Errorf("valid identity params: %v", err)
+	}
+	for _, invalid := range []string{"uptime:H11406", "firmware:", "firmware:I00020..I00021", "I00020"} {
+		if _, err := parseIdentityParams(invalid); err == nil {
+			t.Errorf("%q: expected an error", invalid)
+		}
+	}
+}
+
+// TestDeviceEndpointSelectsProfile tests GET /device and the firmware parameter profile
+func TestDeviceEndpointSelectsProfile(t *testing.T) {
+	device := &fakeDevice{values: map[string]string{"I00020": "2", "I00021": "3", "I00022": "36", "H11406": "12", "H12202": "8"}}
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/config/ip.cgi" {
+			fmt.Fprint(w, "model=Duplex 370&mac=00:1A:2B:3C:4D:5E")
+			return
+		}
+		device.ServeHTTP(w, r)
+	}))
+	defer mock.Close()
+
+	server := newTestServer(t, mock.URL)
+	server.profiles = []ParameterProfile{
+		{Name: "rd5-v1", Firmware: []string{"1."}, Names: map[string]string{"H12202": "wrong"}},
+		{Name: "rd5-v2.3", Firmware: []string{"2.3."}, Names: map[string]string{"H12202": "IP Address (low)"}, Kinds: map[string]string{"H12202": "integer"}},
+	}
+	handler := server.Handler()
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/device", nil))
+	var response struct {
+		Data DeviceInfo `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("got %d, %v", w.Code, err)
+	}
+	if info := response.Data; info.Model != "Duplex 370" || info.Firmware != "2.3.36" || info.UptimeHours != 12 || info.Profile != "rd5-v2.3" {
+		t.Errorf("got %+v", info)
+	}
+	if value := DecodeParameter("H12202", "8", server.parameterProfile()); value.Name != "IP Address (low)" || value.Value != 8 {
+		t.Errorf("profile not applied: got %+v", value)
+	}
+	if value := DecodeParameter("H12202", "8", nil); value.Name != ParameterNames["H12202"] || value.Value != "8" {
+		t.Errorf("profile leaked into the built-in map: got %+v", value)
+	}
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/parameter/H12202?decoded=true", nil))
+	var parameter struct {
+		Data DecodedValue `json:"data"`
+	}
+	json.NewDecoder(w.Body).Decode(&parameter)
+	if parameter.Data.Name != "IP Address (low)" || parameter.Data.Value != float64(8) {
+		t.Errorf("GET /parameter did not follow the profile: got %+v", parameter.Data)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/status", nil))
+	var status struct {
+		Data StatusResponse `json:"data"`
+	}
+	json.NewDecoder(w.Body).Decode(&status)
+	if status.Data.Device != "Duplex 370" {
+		t.Errorf("status device: got %q", status.Data.Device)
+	}
+
+	if profile := SelectParameterProfile(server.profiles, "3.0"); profile != nil {
+		t.Errorf("without a matching profile: got %q", profile.Name)
+	}
+}
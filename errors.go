@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Errors returned by the device client and the controls built on it
+// Callers match them with errors.Is; the server maps them to API error codes.
+var (
+	// ErrAuthDenied is returned when the device refuses the login magic
+	ErrAuthDenied = errors.New("device denied the login")
+	// ErrSessionExpired is returned when the device no longer accepts the session ID
+	ErrSessionExpired = errors.New("device session expired")
+	// ErrDeviceUnreachable is returned for connection failures, timeouts and 5xx answers
+	ErrDeviceUnreachable = errors.New("device unreachable")
+	// ErrMalformedResponse is returned when a device answer cannot be parsed
+	ErrMalformedResponse = errors.New("malformed device response")
+	// ErrUnknownParameter is returned for parameter IDs the device does not report or accept
+	ErrUnknownParameter = errors.New("unknown parameter")
+	// ErrReadOnly is returned for writes to input registers (I*) and digital inputs (D*)
+	ErrReadOnly = errors.New("parameter is read-only")
+	// ErrOutOfRange is returned for values the device would reject or misinterpret
+	ErrOutOfRange = errors.New("value out of range")
+	// ErrNotApplied is returned by verified writes when the device ignored a value
+	ErrNotApplied = errors.New("value not applied by device")
+	// ErrRollbackFailed is joined to ErrNotApplied when the previous values could not be restored
+	ErrRollbackFailed = errors.New("rollback failed")
+)
+
+// ParameterError reports a problem with one parameter
+type ParameterError struct {
+	Parameter string
+	Err       error  // one of the errors above
+	Detail    string // e.g. the accepted range or the offending value
+}
+
+func (e *ParameterError) Error() string {
+	msg := fmt.Sprintf("parameter %s: %v", e.Parameter, e.Err)
+	if e.Detail != "" {
+		msg += " (" + e.Detail + ")"
+	}
+	return msg
+}
+
+func (e *ParameterError) Unwrap() error {
+	return e.Err
+}
+
+// checkWritable rejects ID=VALUE writes the device cannot accept
+// Holding registers (H*) and coils (C*) are writable; input registers (I*)
+// and digital inputs (D*) are read-only. The coils behind system commands
+// are only written by SystemControl, which goes through the command guard.
+func checkWritable(parameters []string) error {
+	for _, param := range parameters {
+		id, value, ok := strings.Cut(param, "=")
+		if command, found := systemCommandParams[id]; found {
+			return &ParameterError{Parameter: id, Err: ErrCommandNotAllowed, Detail: "use POST /system/" + command}
+		}
+		switch {
+		case id == "" || !ok:
+			return &ParameterError{Parameter: param, Err: ErrUnknownParameter, Detail: "want ID=VALUE"}
+		case value == "":
+			return &ParameterError{Parameter: id, Err: ErrOutOfRange, Detail: "empty value"}
+		case id[0] == 'H' || id[0] == 'C':
+		case id[0] == 'I' || id[0] == 'D':
+			return &ParameterError{Parameter: id, Err: ErrReadOnly}
+		default:
+			return &ParameterError{Parameter: id, Err: ErrUnknownParameter}
+		}
+	}
+	return nil
+}
+
+// Error codes returned in APIResponse.Code
+const (
+	CodeInvalidRequest    = "invalid_request"
+	CodeUnauthorized      = "unauthorized"
+	CodeNotFound          = "not_found"
+	CodeUnavailable       = "unavailable" // feature not configured
+	CodeInternal          = "internal_error"
+	CodeAuthDenied        = "auth_denied"
+	CodeSessionExpired    = "session_expired"
+	CodeDeviceOffline     = "device_offline"
+	CodeDeviceUnreachable = "device_unreachable"
+	CodeMalformedResponse = "malformed_response"
+	CodeUnknownParameter  = "unknown_parameter"
+	CodeReadOnly          = "read_only"
+	CodeOutOfRange        = "out_of_range"
+	CodeNotApplied        = "not_applied"
+	CodeCommandNotAllowed = "command_not_allowed"
+	CodeInvalidToken      = "invalid_token"
+)
+
+// errorCodes maps errors to API codes and HTTP statuses, most specific first
+var errorCodes = []struct {
+	err    error
+	code   string
+	status int
+}{
+	{ErrDeviceOffline, CodeDeviceOffline, http.StatusServiceUnavailable},
+	{ErrDeviceUnreachable, CodeDeviceUnreachable, http.StatusServiceUnavailable},
+	{ErrSessionExpired, CodeSessionExpired, http.StatusServiceUnavailable},
+	{ErrAuthDenied, CodeAuthDenied, http.StatusBadGateway},
+	{ErrMalformedResponse, CodeMalformedResponse, http.StatusBadGateway},
+	{ErrUnknownParameter, CodeUnknownParameter, http.StatusNotFound},
+	{ErrReadOnly, CodeReadOnly, http.StatusForbidden},
+	{ErrOutOfRange, CodeOutOfRange, http.StatusBadRequest},
+	{ErrNotApplied, CodeNotApplied, http.StatusConflict},
+	{ErrCommandNotAllowed, CodeCommandNotAllowed, http.StatusForbidden},
+	{ErrInvalidToken, CodeInvalidToken, http.StatusForbidden},
+}
+
+// errorStatus returns the API code and HTTP status for err
+func errorStatus(err error) (string, int) {
+	for _, entry := range errorCodes {
+		if errors.Is(err, entry.err) {
+			return entry.code, entry.status
+		}
+	}
+	return CodeInternal, http.StatusInternalServerError
+}
+
+// writeError writes a failed APIResponse for err, its message prefixed with context
+func writeError(w http.ResponseWriter, err error, context string) {
+	code, status := errorStatus(err)
+	message := err.Error()
+	if context != "" {
+		message = context + ": " + message
+	}
+	writeJSON(w, status, APIResponse{Success: false, Code: code, Error: message})
+}
+
+// writeRequestError writes a failed APIResponse for a rejected request;
+// errors without a specific code are reported as invalid_request
+func writeRequestError(w http.ResponseWriter, err error) {
+	code, status := errorStatus(err)
+	if code == CodeInternal {
+		code, status = CodeInvalidRequest, http.StatusBadRequest
+	}
+	writeJSON(w, status, APIResponse{Success: false, Code: code, Error: err.Error()})
+}
+
+// writeFailure writes a failed APIResponse that has no underlying error
+func writeFailure(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, APIResponse{Success: false, Code: code, Error: message})
+}
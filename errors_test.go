@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestClientTypedErrors tests that client failures match the exported sentinels
+func TestClientTypedErrors(t *testing.T) {
+	device := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/config/login.cgi", "/config/xml.xml":
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><root lng="0">denied</root>`)
+		case "/config/alarms.xml":
+			fmt.Fprint(w, `<root><errors`)
+		}
+	}))
+	defer device.Close()
+
+	client := NewWebClient(device.Listener.Addr().String())
+	client.baseURL = device.URL
+	client.SetSessionID("12345")
+
+	_, err := client.Login("wrong")
+	if !errors.Is(err, ErrAuthDenied) {
+		t.Errorf("login: got %v, want ErrAuthDenied", err)
+	}
+	if _, err := client.GetData(); !errors.Is(err, ErrSessionExpired) {
+		t.Errorf("read: got %v, want ErrSessionExpired", err)
+	}
+	alarms, _ := client.GetAlarms()
+	if _, err := ParseAlarmsXML(alarms); !errors.Is(err, ErrMalformedResponse) {
+		t.Errorf("alarms: got %v, want ErrMalformedResponse", err)
+	}
+
+	for param, want := range map[string]error{"I10215=200": ErrReadOnly, "D10001=1": ErrReadOnly, "X1=1": ErrUnknownParameter, "H10714": ErrUnknownParameter, "H10714=": ErrOutOfRange} {
+		var paramErr *ParameterError
+		if err := client.SetValue(param); !errors.Is(err, want) || !errors.As(err, &paramErr) {
+			t.Errorf("write %s: got %v, want %v", param, err, want)
+		}
+	}
+	if err := ValidateFanPower(5); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("power: got %v, want ErrOutOfRange", err)
+	}
+	if _, err := (&DeviceData{Items: map[string]string{}}).GetCurrentTemperature(); !errors.Is(err, ErrUnknownParameter) {
+		t.Errorf("missing indoor sensor: got %v, want ErrUnknownParameter", err)
+	}
+	if _, err := (&DeviceData{Items: map[string]string{"I10215": "201"}}).GetOutdoorTemperature(); !errors.Is(err, ErrUnknownParameter) {
+		t.Errorf("missing outdoor sensor: got %v, want ErrUnknownParameter", err)
+	}
+	if _, err := (&DeviceData{Items: map[string]string{}}).GetFanPower(); !errors.Is(err, ErrUnknownParameter) {
+		t.Errorf("missing parameter: got %v, want ErrUnknownParameter", err)
+	}
+
+	device.Close()
+	if _, err := client.GetData(); !errors.Is(err, ErrDeviceUnreachable) {
+		t.Errorf("closed device: got %v, want ErrDeviceUnreachable", err)
+	}
+}
+
+// TestErrorStatus tests the mapping of wrapped errors to API codes and statuses
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		err    error
+		code   string
+		status int
+	}{
+		{fmt.Errorf("failed to get data: %w", &DeviceOfflineError{}), CodeDeviceOffline, http.StatusServiceUnavailable},
+		{fmt.Errorf("failed to get data: %w: timeout", ErrDeviceUnreachable), CodeDeviceUnreachable, http.StatusServiceUnavailable},
+		{&ParameterError{Parameter: "H10714", Err: ErrUnknownParameter}, CodeUnknownParameter, http.StatusNotFound},
+		{&ParameterError{Parameter: "I10215", Err: ErrReadOnly}, CodeReadOnly, http.StatusForbidden},
+		{fmt.Errorf("%w: 1 of 2 parameters", ErrNotApplied), CodeNotApplied, http.StatusConflict},
+		{fmt.Errorf("reset: %w", ErrCommandNotAllowed), CodeCommandNotAllowed, http.StatusForbidden},
+		{errors.New("disk full"), CodeInternal, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		code, status := errorStatus(tt.err)
+		if code != tt.code || status != tt.status {
+			t.Errorf("%v: got %s/%d, want %s/%d", tt.err, code, status, tt.code, tt.status)
+		}
+	}
+}
+
+// TestAPIErrorCodes tests that handlers report machine-readable codes
+func TestAPIErrorCodes(t *testing.T) {
+	device := &fakeDevice{values: map[string]string{"H10714": "50"}}
+	mock := httptest.NewServer(device)
+	server := newTestServer(t, mock.URL)
+	handler := server.Handler()
+
+	tests := []struct {
+		method, path, body string
+		status             int
+		code               string
+	}{
+		{"GET", "/parameter/H99999", "", http.StatusNotFound, CodeUnknownParameter},
+		{"PUT", "/power", `{"power": 5}`, http.StatusBadRequest, CodeOutOfRange},
+		{"PUT", "/mode", `{"mode": `, http.StatusBadRequest, CodeInvalidRequest},
+		{"DELETE", "/override", "", http.StatusNotFound, CodeNotFound},
+		{"POST", "/system/reset", "", http.StatusForbidden, CodeCommandNotAllowed},
+	}
+	check := func(method, path, body string, status int, code string) {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		var resp APIResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("%s %s: failed to decode response: %v", method, path, err)
+		}
+		if w.Code != status || resp.Code != code || resp.Success {
+			t.Errorf("%s %s: got %d %q (%s), want %d %q", method, path, w.Code, resp.Code, resp.Error, status, code)
+		}
+	}
+	for _, tt := range tests {
+		check(tt.method, tt.path, tt.body, tt.status, tt.code)
+	}
+
+	mock.Close()
+	check("GET", "/temperature", "", http.StatusServiceUnavailable, CodeDeviceUnreachable)
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Event types pushed to live clients
+const (
+	EventParameter = "parameter" // a parameter changed value
+	EventAlarm     = "alarm"     // an alarm was raised or cleared
+	EventSnapshot  = "snapshot"  // current state, sent when a client connects
+)
+
+// eventBuffer is how many events a subscriber may fall behind before it is dropped
+const eventBuffer = 256
+
+// Event is a change pushed to live clients
+type Event struct {
+	Type      string            `json:"type"`
+	Time      time.Time         `json:"time"`
+	Parameter string            `json:"parameter,omitempty"`
+	Name      string            `json:"name,omitempty"`
+	Value     string            `json:"value,omitempty"`
+	Previous  string            `json:"previous,omitempty"`
+	Alarm     int               `json:"alarm,omitempty"`
+	State     string            `json:"state,omitempty"`  // alarm state: "active" or "cleared"
+	Values    map[string]string `json:"values,omitempty"` // snapshot parameters
+	Active    []int             `json:"active,omitempty"` // snapshot alarms
+}
+
+// EventHub turns polled snapshots into change events and fans them out
+// The first snapshot only sets the baseline; later ones publish differences.
+type EventHub struct {
+	mutex       sync.Mutex
+	values      map[string]string
+	alarms      map[int]bool
+	profile     *ParameterProfile // of the last observed snapshot, names the events
+	subscribers map[chan Event]struct{}
+	closed      bool
+}
+
+// NewEventHub creates a hub without subscribers
+func NewEventHub() *EventHub {
+	return &EventHub{subscribers: make(map[chan Event]struct{})}
+}
+
+// Subscribe returns a channel of events and a function that unsubscribes
+// The channel is closed when the subscriber falls behind or the hub closes.
+func (h *EventHub) Subscribe() (<-chan Event, func()) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	ch := make(chan Event, eventBuffer)
+	if h.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	h.subscribers[ch] = struct{}{}
+	return ch, func() {
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+		if _, ok := h.subscribers[ch]; ok {
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribers returns the number of connected subscribers
+func (h *EventHub) Subscribers() int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return len(h.subscribers)
+}
+
+// Snapshot returns the last known parameter values and active alarms
+func (h *EventHub) Snapshot() Event {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	snapshot := Event{Type: EventSnapshot, Time: time.Now(), Values: make(map[string]string, len(h.values))}
+	for id, value := range h.values {
+		snapshot.Values[id] = value
+	}
+	for code := range h.alarms {
+		snapshot.Active = append(snapshot.Active, code)
+	}
+	sort.Ints(snapshot.Active)
+	return snapshot
+}
+
+// ObserveData publishes the parameters that changed since the last snapshot
+func (h *EventHub) ObserveData(data *DeviceData) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.profile = data.profile
+	if h.values == nil {
+		h.values = make(map[string]string, len(data.Items))
+		for id, value := range data.Items {
+			h.values[id] = value
+		}
+		return
+	}
+	h.updateLocked(data.Items)
+}
+
+// Update publishes changes to some parameters, e.g. the verified values of a write
+func (h *EventHub) Update(values map[string]string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.values == nil {
+		h.values = make(map[string]string)
+	}
+	h.updateLocked(values)
+}
+
+func (h *EventHub) updateLocked(values map[string]string) {
+	ids := make([]string, 0, len(values))
+	for id := range values {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	now := time.Now()
+	for _, id := range ids {
+		previous, known := h.values[id]
+		if known && previous == values[id] {
+			continue
+		}
+		h.values[id] = values[id]
+		h.publishLocked(Event{
+			Type:      EventParameter,
+			Time:      now,
+			Parameter: id,
+			Name:      GetParameterName(id, h.profile),
+			Value:     values[id],
+			Previous:  previous,
+		})
+	}
+}
+
+// Alarms returns the active alarm codes last observed; known is false before
+// the first ObserveAlarms
+func (h *EventHub) Alarms() (active []int, known bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for code := range h.alarms {
+		active = append(active, code)
+	}
+	return active, h.alarms != nil
+}
+
+// ObserveAlarms publishes alarms raised or cleared since the last call
+func (h *EventHub) ObserveAlarms(active []int) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	current := make(map[int]bool, len(active))
+	for _, code := range active {
+		current[code] = true
+	}
+	if h.alarms == nil {
+		h.alarms = current
+		return
+	}
+
+	now := time.Now()
+	for _, code := range active {
+		if !h.alarms[code] {
+			h.publishLocked(Event{Type: EventAlarm, Time: now, Alarm: code, State: "active"})
+		}
+	}
+	var cleared []int
+	for code := range h.alarms {
+		if !current[code] {
+			cleared = append(cleared, code)
+		}
+	}
+	sort.Ints(cleared)
+	for _, code := range cleared {
+		h.publishLocked(Event{Type: EventAlarm, Time: now, Alarm: code, State: "cleared"})
+	}
+	h.alarms = current
+}
+
+// publishLocked sends an event to every subscriber, dropping those that fell behind
+func (h *EventHub) publishLocked(event Event) {
+	for ch := range h.subscribers {
+		select {
+		case ch <- event:
+		default:
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Close disconnects every subscriber
+func (h *EventHub) Close() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.closed = true
+	for ch := range h.subscribers {
+		delete(h.subscribers, ch)
+		close(ch)
+	}
+}
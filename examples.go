@@ -6,12 +6,12 @@ import (
 )
 
 // ExampleUsage demonstrates how to use the web interface
-func ExampleUsage() {
+func ExampleUsage(cfg *Config) {
 	// Create a web client
-	webClient := NewWebClient("192.168.68.106")
+	webClient := NewWebClient(cfg.DeviceIP)
 
-	// Authenticate with password
-	sessionID, err := webClient.Login("6378")
+	// Authenticate with the configured credentials (password or pre-hashed magic)
+	sessionID, err := webClient.LoginMagic(cfg.LoginMagic().Reveal())
 	if err != nil {
 		log.Fatalf("Authentication failed: %v", err)
 	}
@@ -47,12 +47,12 @@ func ExampleUsage() {
 
 	tempControl := NewTemperatureControl(webClient)
 
-	// Set desired temperature to 21°C in heating mode
-	err = tempControl.SetDesiredTemperature(21, 1)
+	// Set desired temperature to 21.5°C in heating mode
+	err = tempControl.SetDesiredTemperature(21.5, 1)
 	if err != nil {
 		log.Fatalf("Failed to set temperature: %v", err)
 	}
-	fmt.Println("✓ Temperature set to 21°C")
+	fmt.Println("✓ Temperature set to 21.5°C")
 
 	// ========== SYSTEM CONTROL ==========
 
@@ -87,20 +87,24 @@ func ExampleUsage() {
 }
 
 // ExampleMultipleCommands demonstrates sending multiple commands in sequence
-func ExampleMultipleCommands() {
-	webClient := NewWebClient("192.168.68.106")
+func ExampleMultipleCommands(cfg *Config) {
+	webClient := NewWebClient(cfg.DeviceIP)
 
 	// Login
-	_, err := webClient.Login("6378")
+	_, err := webClient.LoginMagic(cfg.LoginMagic().Reveal())
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	// Set multiple parameters at once
+	setpoint, err := encodeTemperature(22.0)
+	if err != nil {
+		log.Fatal(err)
+	}
 	err = webClient.SetMultipleValues([]string{
-		FormatParam("H11021", 22), // Temperature
-		FormatParam("H11017", 1),  // Mode
-		FormatParam("H11400", 1),  // Timezone
+		FormatParam("H11021", setpoint), // Temperature (tenths of °C)
+		FormatParam("H11017", 1),        // Mode
+		FormatParam("H11400", 1),        // Timezone
 	})
 	if err != nil {
 		log.Fatal(err)
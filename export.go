@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultInfluxMeasurement names the measurement written to InfluxDB
+const DefaultInfluxMeasurement = "atrea"
+
+// influxMaxPending bounds the lines kept while InfluxDB is unreachable
+const influxMaxPending = 1000
+
+// LineProtocol encodes a snapshot as one InfluxDB line protocol point
+// Every parameter becomes a field typed by its kind: temperatures as floats,
+// counters as integers, digital values as booleans, modes and raw values as strings.
+func LineProtocol(measurement string, tags map[string]string, data *DeviceData, t time.Time) string {
+	var line strings.Builder
+	line.WriteString(influxEscape(measurement, ", "))
+
+	tagKeys := make([]string, 0, len(tags))
+	for key := range tags {
+		tagKeys = append(tagKeys, key)
+	}
+	sort.Strings(tagKeys)
+	for _, key := range tagKeys {
+		line.WriteString("," + influxEscape(key, ",= ") + "=" + influxEscape(tags[key], ",= "))
+	}
+
+	ids := make([]string, 0, len(data.Items))
+	for id := range data.Items {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	separator := byte(' ')
+	for _, id := range ids {
+		field, ok := influxField(id, data.Items[id], data.profile)
+		if !ok {
+			continue
+		}
+		line.WriteByte(separator)
+		separator = ','
+		line.WriteString(influxEscape(id, ",= ") + "=" + field)
+	}
+
+	line.WriteString(" " + strconv.FormatInt(t.UnixNano(), 10))
+	return line.String()
+}
+
+// influxField formats a parameter as a line protocol field value. The type
+// follows the parameter kind rather than the value, since InfluxDB rejects a
+// field whose type changes; a value that cannot be decoded is left out.
+func influxField(id, raw string, profile *ParameterProfile) (string, bool) {
+	decoded := DecodeParameter(id, raw, profile)
+	switch GetParameterInfo(id, profile).Kind {
+	case KindTemperature:
+		if v, ok := decoded.Value.(float64); ok {
+			return strconv.FormatFloat(v, 'f', -1, 64), true
+		}
+	case KindPercent, KindHours, KindInteger:
+		if v, ok := decoded.Value.(int); ok {
+			return strconv.Itoa(v) + "i", true
+		}
+	case KindBoolean:
+		if v, ok := decoded.Value.(bool); ok {
+			return strconv.FormatBool(v), true
+		}
+	case KindMode:
+		return influxString(fmt.Sprint(decoded.Value)), true
+	default:
+		return influxString(raw), true
+	}
+	return "", false
+}
+
+// influxString quotes a line protocol string field value
+func influxString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// influxEscape backslash-escapes the given special characters
+func influxEscape(s, special string) string {
+	var escaped strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(special, r) {
+			escaped.WriteByte('\\')
+		}
+		escaped.WriteRune(r)
+	}
+	return escaped.String()
+}
+
+// errInfluxRejected marks a batch InfluxDB refused; sending it again cannot succeed
+var errInfluxRejected = errors.New("batch rejected by InfluxDB")
+
+// InfluxExporter pushes every polled snapshot to an InfluxDB write endpoint
+// Lines that could not be delivered because of a network error, 429 or 5xx
+// are retried with the next snapshot; a batch rejected with 4xx is dropped.
+type InfluxExporter struct {
+	url         string
+	token       Secret
+	measurement string
+	tags        map[string]string
+	httpClient  *http.Client
+
+	queueMutex sync.Mutex // guards started, closed and sends on queue
+	queue      chan string
+	done       chan struct{}
+	started    bool
+	closed     bool
+
+	ctx    context.Context // cancelled when Stop gives up, aborting writes
+	cancel context.CancelFunc
+}
+
+// NewInfluxExporter creates an exporter for the write URL, e.g.
+// http://influx:8086/api/v2/write?org=home&bucket=atrea (nanosecond precision)
+func NewInfluxExporter(url string, token Secret, measurement, deviceIP string) *InfluxExporter {
+	if measurement == "" {
+		measurement = DefaultInfluxMeasurement
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &InfluxExporter{
+		url:         url,
+		token:       token,
+		measurement: measurement,
+		tags:        map[string]string{"device": deviceIP},
+		httpClient:  &http.Client{Timeout: 10 * time.Second},
+		queue:       make(chan string, 64),
+		done:        make(chan struct{}),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+}
+
+// Observe queues a polled snapshot for delivery
+func (e *InfluxExporter) Observe(data *DeviceData) {
+	line := LineProtocol(e.measurement, e.tags, data, time.Now())
+	e.queueMutex.Lock()
+	defer e.queueMutex.Unlock()
+	if e.closed {
+		return
+	}
+	select {
+	case e.queue <- line:
+	default:
+		log.Printf("⚠ InfluxDB export queue full, dropping snapshot")
+	}
+}
+
+// Start launches the delivery worker
+func (e *InfluxExporter) Start() {
+	e.queueMutex.Lock()
+	defer e.queueMutex.Unlock()
+	if e.started || e.closed {
+		return
+	}
+	e.started = true
+	go e.run()
+}
+
+// Stop delivers queued snapshots and stops the worker. When ctx ends first,
+// the write in progress is aborted, the remaining snapshots are dropped and
+// ctx.Err() is returned. It is safe to call before Start and more than once.
+func (e *InfluxExporter) Stop(ctx context.Context) error {
+	e.queueMutex.Lock()
+	if !e.closed {
+		e.closed = true
+		close(e.queue)
+	}
+	started := e.started
+	e.queueMutex.Unlock()
+
+	if !started {
+		return nil
+	}
+	select {
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+	}
+	e.cancel()
+	<-e.done
+	return ctx.Err()
+}
+
+func (e *InfluxExporter) run() {
+	defer close(e.done)
+
+	var pending []string
+	dropped := 0
+	defer func() {
+		if dropped += len(pending); dropped > 0 {
+			log.Printf("✗ InfluxDB exporter stopped, dropped %d unsent snapshots", dropped)
+		}
+	}()
+	for line := range e.queue {
+		if e.ctx.Err() != nil {
+			dropped++
+			continue
+		}
+		pending = append(pending, line)
+		if len(pending) > influxMaxPending {
+			pending = pending[len(pending)-influxMaxPending:]
+		}
+
+		err := e.write(pending)
+		if errors.Is(err, errInfluxRejected) {
+			log.Printf("✗ InfluxDB rejected the batch, dropped %d points: %v", len(pending), err)
+		} else if err != nil {
+			log.Printf("✗ InfluxDB export failed (%d snapshots pending): %v", len(pending), err)
+			continue
+		}
+		pending = nil
+	}
+}
+
+// write posts lines in one request
+func (e *InfluxExporter) write(lines []string) error {
+	req, err := http.NewRequestWithContext(e.ctx, http.MethodPost, e.url, strings.NewReader(strings.Join(lines, "\n")+"\n"))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if e.token != "" {
+		req.Header.Set("Authorization", "Token "+e.token.Reveal())
+	}
+
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 300 {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+		return fmt.Errorf("%w: status %d: %s", errInfluxRejected, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+}
+
+// csvHeader labels a parameter column with its name and unit
+func csvHeader(id string, profile *ParameterProfile) string {
+	info := GetParameterInfo(id, profile)
+	header := id
+	if info.Name != id {
+		header += " " + info.Name
+	}
+	if info.Unit != "" {
+		header += " (" + info.Unit + ")"
+	}
+	return header
+}
+
+// WriteCSV writes history samples with one decoded column per parameter,
+// named and decoded under profile (nil for the built-in map)
+func WriteCSV(out io.Writer, ids []string, samples []HistorySample, profile *ParameterProfile) error {
+	w := csv.NewWriter(out)
+	header := []string{"time"}
+	for _, id := range ids {
+		header = append(header, csvHeader(id, profile))
+	}
+	if err := w.Write(header); err != nil {
+		return err
+	}
+
+	for _, sample := range samples {
+		record := []string{sample.Time.UTC().Format(time.RFC3339)}
+		for _, id := range ids {
+			raw, ok := sample.Values[id]
+			if !ok {
+				record = append(record, "")
+				continue
+			}
+			record = append(record, fmt.Sprint(DecodeParameter(id, raw, profile).Value))
+		}
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// GET /export.csv - Stored history as CSV (?ids=I10215,I10211&from=&to= in RFC 3339)
+func (s *Server) handleExportCSV(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	var from, to time.Time
+	for name, bound := range map[string]*time.Time{"from": &from, "to": &to} {
+		if value := query.Get(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				writeFailure(w, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("Invalid %s: want an RFC 3339 timestamp", name))
+				return
+			}
+			*bound = t
+		}
+	}
+
+	ids := s.history.IDs()
+	if value := query.Get("ids"); value != "" {
+		ids = nil
+		for _, id := range strings.Split(value, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, ids, s.history.Samples(ids, from, to), s.parameterProfile()); err != nil {
+		writeError(w, err, "Failed to write CSV")
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="atrea-export.csv"`)
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestLineProtocol tests field typing and escaping of a snapshot
+func TestLineProtocol(t *testing.T) {
+	data := &DeviceData{Items: map[string]string{
+		"I10215": "201",   // temperature
+		"I10211": "65526", // negative temperature
+		"H10714": "80",    // percent
+		"D10001": "1",     // digital input
+		"H10715": "2",     // mode
+		"H99999": "abc",   // unknown, not numeric
+		"H99998": "7",     // unknown, numeric: still a string
+		"I10212": "n/a",   // undecodable temperature: left out
+	}}
+	at := time.Unix(1700000000, 0)
+
+	got := LineProtocol("atrea", map[string]string{"device": "unit 1"}, data, at)
+	want := `atrea,device=unit\ 1 D10001=true,H10714=80i,H10715="ventilation",H99998="7",H99999="abc",I10211=-1,I10215=20.1 1700000000000000000`
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+// TestInfluxExporterRetriesPending tests that snapshots survive a failed write
+func TestInfluxExporterRetriesPending(t *testing.T) {
+	var mutex sync.Mutex
+	var bodies []string
+	var auth string
+	fail := true
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if fail {
+			fail = false
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		auth = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer stub.Close()
+
+	exporter := NewInfluxExporter(stub.URL+"/api/v2/write?bucket=atrea", "t0ken", "", "10.0.0.5")
+	exporter.Start()
+	exporter.Observe(&DeviceData{Items: map[string]string{"H10714": "50"}})
+	exporter.Observe(&DeviceData{Items: map[string]string{"H10714": "60"}})
+	exporter.Stop(context.Background())
+
+	if len(bodies) != 1 || strings.Count(bodies[0], "\n") != 2 {
+		t.Fatalf("got writes %q, want one write with both snapshots", bodies)
+	}
+	if !strings.HasPrefix(bodies[0], "atrea,device=10.0.0.5 H10714=50i ") || auth != "Token t0ken" {
+		t.Errorf("got %q with auth %q", bodies[0], auth)
+	}
+}
+
+// TestInfluxExporterDropsRejected tests that a batch refused with 4xx is not sent again
+func TestInfluxExporterDropsRejected(t *testing.T) {
+	var mutex sync.Mutex
+	var bodies []string
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if len(bodies) == 1 {
+			http.Error(w, `{"code":"invalid","message":"field type conflict"}`, http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer stub.Close()
+
+	exporter := NewInfluxExporter(stub.URL, "", "", "10.0.0.5")
+	exporter.Start()
+	exporter.Observe(&DeviceData{Items: map[string]string{"H10714": "50"}})
+	exporter.Observe(&DeviceData{Items: map[string]string{"H10714": "60"}})
+	exporter.Stop(context.Background())
+
+	if len(bodies) != 2 || strings.Contains(bodies[1], "H10714=50i") {
+		t.Errorf("got writes %q, want the rejected snapshot dropped", bodies)
+	}
+}
+
+// TestInfluxExporterStopWithoutStart tests Stop before Start and Observe after Stop
+func TestInfluxExporterStopWithoutStart(t *testing.T) {
+	exporter := NewInfluxExporter("http://127.0.0.1:1", "", "", "10.0.0.5")
+	stopped := make(chan struct{})
+	go func() {
+		exporter.Stop(context.Background())
+		exporter.Stop(context.Background())
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Stop blocked without Start")
+	}
+	exporter.Observe(&DeviceData{Items: map[string]string{"H10714": "50"}})
+}
+
+// TestHistoryEviction tests that evicted samples still contribute their values
+func TestHistoryEviction(t *testing.T) {
+	h := NewHistory(2)
+	start := time.Unix(1700000000, 0)
+	h.Record(start, map[string]string{"I10215": "200", "H10714": "50"})
+	h.Record(start.Add(time.Minute), map[string]string{"I10215": "201", "H10714": "50"})
+	h.Record(start.Add(2*time.Minute), map[string]string{"I10215": "202", "H10714": "50"})
+
+	samples := h.Samples([]string{"I10215", "H10714"}, time.Time{}, time.Time{})
+	if len(samples) != 2 || h.Len() != 2 {
+		t.Fatalf("got %d samples, want 2", len(samples))
+	}
+	if samples[0].Values["I10215"] != "201" || samples[0].Values["H10714"] != "50" || samples[1].Values["I10215"] != "202" {
+		t.Errorf("got %+v", samples)
+	}
+
+	samples = h.Samples([]string{"I10215"}, start.Add(2*time.Minute), time.Time{})
+	if len(samples) != 1 || samples[0].Values["I10215"] != "202" {
+		t.Errorf("from filter: got %+v", samples)
+	}
+}
+
+// TestExportCSV tests the CSV endpoint with decoded values and unit headers
+func TestExportCSV(t *testing.T) {
+	server := newTestServer(t, "http://127.0.0.1:1")
+	start := time.Date(2025, 11, 17, 10, 0, 0, 0, time.UTC)
+	server.history.Record(start, map[string]string{"I10215": "201", "H10714": "50"})
+	server.history.Record(start.Add(time.Hour), map[string]string{"I10215": "65526", "H10714": "80"})
+	handler := server.Handler()
+
+	req := httptest.NewRequest(http.MethodGet, "/export.csv?ids=I10215,H10714&from=2025-11-17T10:30:00Z", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/csv") {
+		t.Fatalf("got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid CSV: %v", err)
+	}
+	want := [][]string{
+		{"time", "I10215 " + GetParameterName("I10215", nil) + " (°C)", "H10714 " + GetParameterName("H10714", nil) + " (%)"},
+		{"2025-11-17T11:00:00Z", "-1", "80"},
+	}
+	if len(records) != len(want) || strings.Join(records[0], "|") != strings.Join(want[0], "|") || strings.Join(records[1], "|") != strings.Join(want[1], "|") {
+		t.Errorf("got %q, want %q", records, want)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/export.csv?to=yesterday", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid bound: got %d, want 400", w.Code)
+	}
+}
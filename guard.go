@@ -0,0 +1,258 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// System commands that take the unit offline or change how it is reached
+const (
+	CommandReset     = "reset"
+	CommandClearMode = "clear_mode"
+	CommandNetwork   = "network"
+)
+
+// systemCommands lists every guarded command
+var systemCommands = []string{CommandReset, CommandClearMode, CommandNetwork}
+
+// systemCommandParams are the coils behind the guarded commands; rules and
+// overrides may not write them directly
+var systemCommandParams = map[string]string{
+	"C10005": CommandReset,
+	"C10007": CommandClearMode,
+}
+
+// DefaultConfirmTimeout is how long a confirmation token stays valid
+const DefaultConfirmTimeout = 30 * time.Second
+
+var (
+	// ErrCommandNotAllowed is returned for commands missing from SYSTEM_COMMANDS
+	ErrCommandNotAllowed = errors.New("command not allowed by SYSTEM_COMMANDS")
+	// ErrInvalidToken is returned for unknown, expired or foreign confirmation tokens
+	ErrInvalidToken = errors.New("confirmation token is invalid or expired")
+)
+
+// PendingCommand is a system command waiting for confirmation
+type PendingCommand struct {
+	Token     string    `json:"token"`
+	Command   string    `json:"command"`
+	Settings  string    `json:"settings,omitempty"`
+	Caller    string    `json:"caller"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// CommandGuard issues single-use confirmation tokens for allowed system commands
+type CommandGuard struct {
+	allowed map[string]bool
+	ttl     time.Duration
+	now     func() time.Time
+
+	mutex   sync.Mutex
+	pending map[string]PendingCommand
+}
+
+// NewCommandGuard creates a guard for the allowed commands
+func NewCommandGuard(allowed []string, ttl time.Duration) *CommandGuard {
+	if ttl <= 0 {
+		ttl = DefaultConfirmTimeout
+	}
+	cg := &CommandGuard{
+		allowed: make(map[string]bool),
+		ttl:     ttl,
+		now:     time.Now,
+		pending: make(map[string]PendingCommand),
+	}
+	for _, command := range allowed {
+		cg.allowed[command] = true
+	}
+	return cg
+}
+
+// Allowed returns the commands the server may issue, sorted
+func (cg *CommandGuard) Allowed() []string {
+	commands := make([]string, 0, len(cg.allowed))
+	for command := range cg.allowed {
+		commands = append(commands, command)
+	}
+	sort.Strings(commands)
+	return commands
+}
+
+// Request validates a command and returns the token that confirms it
+func (cg *CommandGuard) Request(command, settings, caller string) (PendingCommand, error) {
+	if err := validateSystemCommand(command, settings); err != nil {
+		return PendingCommand{}, err
+	}
+	if !cg.allowed[command] {
+		return PendingCommand{}, fmt.Errorf("%s: %w", command, ErrCommandNotAllowed)
+	}
+
+	token, err := newConfirmToken()
+	if err != nil {
+		return PendingCommand{}, err
+	}
+	pending := PendingCommand{
+		Token:     token,
+		Command:   command,
+		Settings:  settings,
+		Caller:    caller,
+		ExpiresAt: cg.now().Add(cg.ttl),
+	}
+
+	cg.mutex.Lock()
+	defer cg.mutex.Unlock()
+	cg.expireLocked()
+	cg.pending[token] = pending
+	return pending, nil
+}
+
+// Confirm consumes a token issued to the same caller and returns its command
+func (cg *CommandGuard) Confirm(token, caller string) (PendingCommand, error) {
+	cg.mutex.Lock()
+	defer cg.mutex.Unlock()
+	cg.expireLocked()
+
+	pending, ok := cg.pending[token]
+	if !ok || pending.Caller != caller {
+		return PendingCommand{}, ErrInvalidToken
+	}
+	delete(cg.pending, token)
+	return pending, nil
+}
+
+// expireLocked drops expired tokens; the caller holds cg.mutex
+func (cg *CommandGuard) expireLocked() {
+	now := cg.now()
+	for token, pending := range cg.pending {
+		if !now.Before(pending.ExpiresAt) {
+			delete(cg.pending, token)
+		}
+	}
+}
+
+// validateSystemCommand checks the command name and network settings
+func validateSystemCommand(command, settings string) error {
+	switch command {
+	case CommandReset, CommandClearMode:
+		if settings != "" {
+			return fmt.Errorf("%s takes no settings", command)
+		}
+	case CommandNetwork:
+		values, err := url.ParseQuery(settings)
+		if err != nil || len(values) == 0 {
+			return fmt.Errorf("network settings must be a non-empty query string such as \"dhcp=1\"")
+		}
+	default:
+		return fmt.Errorf("unknown system command %q (want %s)", command, strings.Join(systemCommands, ", "))
+	}
+	return nil
+}
+
+// parseSystemCommands parses the SYSTEM_COMMANDS allow-list
+func parseSystemCommands(value string) ([]string, error) {
+	var commands []string
+	for _, command := range strings.Split(value, ",") {
+		command = strings.TrimSpace(command)
+		if command == "" {
+			continue
+		}
+		known := false
+		for _, name := range systemCommands {
+			known = known || name == command
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown system command %q (want %s)", command, strings.Join(systemCommands, ", "))
+		}
+		commands = append(commands, command)
+	}
+	return commands, nil
+}
+
+// executeSystemCommand runs a confirmed command through client
+func executeSystemCommand(client *WebClient, pending PendingCommand) error {
+	switch pending.Command {
+	case CommandReset:
+		return NewSystemControl(client).Reset()
+	case CommandClearMode:
+		return NewSystemControl(client).ClearMode()
+	case CommandNetwork:
+		return client.SetNetworkSettings(pending.Settings)
+	}
+	return fmt.Errorf("unknown system command %q", pending.Command)
+}
+
+func newConfirmToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// ServiceMode is the maintenance-mode flag set while someone works on the unit
+type ServiceMode struct {
+	Enabled bool       `json:"enabled"`
+	Reason  string     `json:"reason,omitempty"`
+	Caller  string     `json:"caller,omitempty"`
+	Since   *time.Time `json:"since,omitempty"`
+}
+
+// ServiceModeSwitch holds the maintenance-mode flag, persisted in
+// <StateDir>/maintenance_mode.json so it survives restarts
+type ServiceModeSwitch struct {
+	path string
+
+	mutex sync.RWMutex
+	state ServiceMode
+}
+
+// NewServiceModeSwitch loads the persisted maintenance-mode flag
+func NewServiceModeSwitch(stateDir string) (*ServiceModeSwitch, error) {
+	sm := &ServiceModeSwitch{path: filepath.Join(stateDir, "maintenance_mode.json")}
+	if err := loadState(sm.path, &sm.state); err != nil {
+		return nil, fmt.Errorf("failed to load maintenance mode: %w", err)
+	}
+	return sm, nil
+}
+
+// Get returns the current flag
+func (sm *ServiceModeSwitch) Get() ServiceMode {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+	return sm.state
+}
+
+// Enabled reports whether maintenance mode is on
+func (sm *ServiceModeSwitch) Enabled() bool {
+	return sm.Get().Enabled
+}
+
+// Set turns maintenance mode on or off
+func (sm *ServiceModeSwitch) Set(enabled bool, reason, caller string) ServiceMode {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	sm.state = ServiceMode{Enabled: enabled}
+	if enabled {
+		sm.state.Reason = reason
+		sm.state.Caller = caller
+		now := time.Now()
+		sm.state.Since = &now
+		log.Printf("🔧 Maintenance mode enabled by %s: %s", caller, reason)
+	} else {
+		log.Printf("🔧 Maintenance mode disabled by %s", caller)
+	}
+	if err := saveState(sm.path, sm.state); err != nil {
+		log.Printf("✗ Failed to save maintenance mode: %v", err)
+	}
+	return sm.state
+}
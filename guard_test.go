@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestCommandGuardConfirmation tests the allow-list and single-use, caller-bound tokens
+func TestCommandGuardConfirmation(t *testing.T) {
+	guard := NewCommandGuard([]string{CommandReset}, time.Minute)
+
+	if _, err := guard.Request(CommandNetwork, "dhcp=1", "alice"); !errors.Is(err, ErrCommandNotAllowed) {
+		t.Errorf("network: got %v, want ErrCommandNotAllowed", err)
+	}
+	if _, err := guard.Request("shutdown", "", "alice"); err == nil {
+		t.Error("unknown command accepted")
+	}
+
+	pending, err := guard.Request(CommandReset, "", "alice")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := guard.Confirm(pending.Token, "bob"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("confirm by another caller: got %v, want ErrInvalidToken", err)
+	}
+	if confirmed, err := guard.Confirm(pending.Token, "alice"); err != nil || confirmed.Command != CommandReset {
+		t.Errorf("confirm: got %+v, %v", confirmed, err)
+	}
+	if _, err := guard.Confirm(pending.Token, "alice"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("second confirm: got %v, want ErrInvalidToken", err)
+	}
+}
+
+// TestCommandGuardExpiry tests that tokens cannot be confirmed after the timeout
+func TestCommandGuardExpiry(t *testing.T) {
+	guard := NewCommandGuard([]string{CommandClearMode}, 30*time.Second)
+	now := time.Now()
+	guard.now = func() time.Time { return now }
+
+	pending, _ := guard.Request(CommandClearMode, "", "alice")
+	now = now.Add(31 * time.Second)
+	if _, err := guard.Confirm(pending.Token, "alice"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("got %v, want ErrInvalidToken", err)
+	}
+}
+
+// TestSystemCommandEndpoints tests the request/confirm flow through the API
+func TestSystemCommandEndpoints(t *testing.T) {
+	device := &fakeDevice{values: map[string]string{}}
+	deviceServer := httptest.NewServer(device)
+	defer deviceServer.Close()
+
+	server := newTestServer(t, deviceServer.URL)
+	server.guard = NewCommandGuard([]string{CommandReset}, time.Minute)
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	post := func(path string, body interface{}) (*http.Response, APIResponse) {
+		data, _ := json.Marshal(body)
+		resp, err := http.Post(ts.URL+path, "application/json", bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("POST %s: %v", path, err)
+		}
+		defer resp.Body.Close()
+		var response APIResponse
+		json.NewDecoder(resp.Body).Decode(&response)
+		return resp, response
+	}
+
+	resp, _ := post("/system/network", SystemCommandRequest{Settings: "dhcp=1"})
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("network: got status %d, want 403", resp.StatusCode)
+	}
+
+	resp, response := post("/system/reset", nil)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("reset request: got status %d, want 202", resp.StatusCode)
+	}
+	if len(device.writes) != 0 {
+		t.Fatal("reset sent before confirmation")
+	}
+	token := response.Data.(map[string]interface{})["token"].(string)
+
+	resp, _ = post("/system/confirm", SystemCommandRequest{Token: token})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("confirm: got status %d, want 200", resp.StatusCode)
+	}
+	if len(device.writes) != 1 || device.writes[0][0] != "C10005=1" {
+		t.Errorf("device writes: got %v, want [[C10005=1]]", device.writes)
+	}
+}
+
+// TestMaintenanceModePausesAutomation tests that automation does not write in maintenance mode
+func TestMaintenanceModePausesAutomation(t *testing.T) {
+	device := &fakeDevice{values: map[string]string{"H10714": "50"}}
+	deviceServer := httptest.NewServer(device)
+	defer deviceServer.Close()
+
+	server := newTestServer(t, deviceServer.URL)
+	server.automation = NewAutomation(AutomationConfig{Rules: []AutomationRule{
+		{Name: "boost", Actions: []AutomationAction{{Power: intPtr(80)}}},
+	}}, server.client, VerifyOptions{Attempts: 1}, nil)
+
+	server.serviceMode.Set(true, "filter swap", "alice")
+	server.runAutomation(&DeviceData{Items: map[string]string{"H10714": "50"}})
+	if len(device.writes) != 0 {
+		t.Errorf("automation wrote in maintenance mode: %v", device.writes)
+	}
+
+	server.serviceMode.Set(false, "", "alice")
+	server.runAutomation(&DeviceData{Items: map[string]string{"H10714": "50"}})
+	if device.values["H10714"] != "80" {
+		t.Errorf("automation did not resume: power %s", device.values["H10714"])
+	}
+}
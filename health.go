@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Readiness check results; the worst one is the overall status
+const (
+	CheckPass = "pass"
+	CheckWarn = "warn" // reported, still ready
+	CheckFail = "fail" // not ready, /health/ready answers 503
+)
+
+// HEALTH_ALARMS settings
+const (
+	HealthAlarmsIgnore = "ignore"
+	HealthAlarmsWarn   = "warn"
+	HealthAlarmsFail   = "fail"
+)
+
+// DefaultHealthStalePolls is how many poll intervals a snapshot may age before it is stale
+const DefaultHealthStalePolls = 3
+
+// HealthCheck is the result of one readiness check
+type HealthCheck struct {
+	Status     string     `json:"status"`
+	Message    string     `json:"message,omitempty"`
+	Since      *time.Time `json:"since,omitempty"`       // device: offline since
+	AgeSeconds *float64   `json:"age_seconds,omitempty"` // snapshot: time since the last successful poll
+	Alarms     []int      `json:"alarms,omitempty"`      // alarms: active codes
+}
+
+// ReadinessResponse reports whether the server can serve device data
+type ReadinessResponse struct {
+	Status string                 `json:"status"`
+	Time   string                 `json:"time"`
+	Checks map[string]HealthCheck `json:"checks"`
+}
+
+// Readiness runs the device, session, snapshot and alarm checks
+func (s *Server) Readiness() ReadinessResponse {
+	cfg := s.settings()
+	checks := map[string]HealthCheck{
+		"device":   s.checkDevice(cfg),
+		"session":  s.checkSession(),
+		"snapshot": s.checkSnapshot(cfg),
+	}
+	if cfg.HealthAlarms != HealthAlarmsIgnore {
+		checks["alarms"] = s.checkAlarms(cfg)
+	}
+
+	status := CheckPass
+	for _, check := range checks {
+		if check.Status == CheckFail || (check.Status == CheckWarn && status == CheckPass) {
+			status = check.Status
+		}
+	}
+	return ReadinessResponse{Status: status, Time: time.Now().Format(time.RFC3339), Checks: checks}
+}
+
+// checkDevice fails once the circuit breaker has been open for HEALTH_OFFLINE_GRACE
+func (s *Server) checkDevice(cfg *Config) HealthCheck {
+	breaker := s.client.DeviceStatus()
+	if breaker == nil {
+		return HealthCheck{Status: CheckPass, Message: "circuit breaker disabled"}
+	}
+
+	switch breaker.State {
+	case BreakerOpen:
+		check := HealthCheck{Status: CheckFail, Since: breaker.OfflineSince, Message: "device unreachable: " + breaker.LastError}
+		if breaker.OfflineSince != nil && time.Since(*breaker.OfflineSince) < cfg.HealthOfflineGrace {
+			check.Status = CheckWarn
+		}
+		return check
+	case BreakerHalfOpen:
+		return HealthCheck{Status: CheckWarn, Since: breaker.OfflineSince, Message: "probing device after an outage"}
+	}
+	if breaker.Failures > 0 {
+		return HealthCheck{Status: CheckWarn, Message: fmt.Sprintf("%d recent failed requests: %s", breaker.Failures, breaker.LastError)}
+	}
+	return HealthCheck{Status: CheckPass}
+}
+
+// checkSession fails without a device session or when the device rejected it
+// on the last poll, after the client already tried to log in again
+func (s *Server) checkSession() HealthCheck {
+	if !s.client.IsAuthenticated() {
+		return HealthCheck{Status: CheckFail, Message: "not logged in to the device"}
+	}
+	s.mutex.RLock()
+	poller := s.poller
+	s.mutex.RUnlock()
+	if poller != nil {
+		if _, _, err := poller.Latest(); errors.Is(err, ErrSessionExpired) {
+			return HealthCheck{Status: CheckFail, Message: "device rejected the session: " + err.Error()}
+		}
+	}
+	return HealthCheck{Status: CheckPass}
+}
+
+// checkSnapshot fails when no poll succeeded within HEALTH_STALE_POLLS intervals
+func (s *Server) checkSnapshot(cfg *Config) HealthCheck {
+	s.mutex.RLock()
+	poller := s.poller
+	s.mutex.RUnlock()
+	if poller == nil {
+		return HealthCheck{Status: CheckFail, Message: "background polling not started"}
+	}
+
+	_, at, err := poller.Latest()
+	if at.IsZero() {
+		check := HealthCheck{Status: CheckFail, Message: "no snapshot polled yet"}
+		if err != nil {
+			check.Message += ": " + err.Error()
+		}
+		return check
+	}
+
+	age := time.Since(at)
+	seconds := age.Seconds()
+	check := HealthCheck{Status: CheckPass, AgeSeconds: &seconds}
+	maxAge := time.Duration(cfg.HealthStalePolls) * cfg.PollInterval
+	switch {
+	case age > maxAge:
+		check.Status = CheckFail
+		check.Message = fmt.Sprintf("last snapshot older than %s", maxAge)
+	case err != nil:
+		check.Status = CheckWarn
+		check.Message = "last poll failed: " + err.Error()
+	}
+	return check
+}
+
+// checkAlarms reports active alarms as HEALTH_ALARMS (warn or fail)
+func (s *Server) checkAlarms(cfg *Config) HealthCheck {
+	active, known := s.events.Alarms()
+	if !known {
+		return HealthCheck{Status: CheckPass, Message: "alarms not polled yet"}
+	}
+	if len(active) == 0 {
+		return HealthCheck{Status: CheckPass}
+	}
+	sort.Ints(active)
+	status := CheckWarn
+	if cfg.HealthAlarms == HealthAlarmsFail {
+		status = CheckFail
+	}
+	return HealthCheck{Status: status, Message: fmt.Sprintf("%d active alarm(s)", len(active)), Alarms: active}
+}
+
+// GET /health/live - Liveness: the process serves HTTP
+func (s *Server) handleLive(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Server is running",
+		Data:    HealthResponse{Status: "ok", Time: time.Now().Format(time.RFC3339)},
+	})
+}
+
+// GET /health/ready - Readiness: device reachable, session valid, data fresh (503 otherwise)
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	readiness := s.Readiness()
+	if readiness.Status == CheckFail {
+		writeJSON(w, http.StatusServiceUnavailable, APIResponse{Success: false, Code: CodeUnavailable, Error: "Not ready", Data: readiness})
+		return
+	}
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Message: "Ready", Data: readiness})
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// readiness requests GET /health/ready and decodes the checks
+func readiness(t *testing.T, handler http.Handler) (int, ReadinessResponse) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+	var response struct {
+		Data ReadinessResponse `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	return w.Code, response.Data
+}
+
+// TestHealthReadiness tests the readiness checks and their thresholds
+func TestHealthReadiness(t *testing.T) {
+	device := &fakeDevice{values: map[string]string{"I10215": "201"}}
+	var mutex sync.Mutex
+	alarmReads, denied := 0, false
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		switch {
+		case denied && r.URL.Path != "/config/login.cgi":
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><root>denied</root>`)
+		case r.URL.Path == "/config/alarms.xml":
+			alarmReads++
+			fmt.Fprint(w, `<root><errors t="2025-11-17 11:34:12 "><i t="1663908802" i="55" p="0"/></errors></root>`)
+		default:
+			device.ServeHTTP(w, r)
+		}
+	}))
+	defer mock.Close()
+
+	server := newTestServer(t, mock.URL)
+	server.config.AuthTokens = map[string]string{"secret": "api"}
+	handler := server.Handler()
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health/live", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("live: got %d, want 200 without a token", w.Code)
+	}
+
+	code, ready := readiness(t, handler)
+	if code != http.StatusServiceUnavailable || ready.Checks["session"].Status != CheckFail || ready.Checks["snapshot"].Status != CheckFail {
+		t.Errorf("before polling: got %d %+v", code, ready)
+	}
+
+	server.client.SetSessionID("12345")
+	server.poller = NewPoller(time.Minute, server.pollDeviceData)
+	server.poller.Subscribe(server.publishEvents)
+	server.poller.poll()
+	code, ready = readiness(t, handler)
+	if _, checked := ready.Checks["alarms"]; code != http.StatusOK || ready.Status != CheckPass || checked || alarmReads != 0 {
+		t.Errorf("HEALTH_ALARMS=ignore by default: got %d %+v after %d alarm reads", code, ready, alarmReads)
+	}
+
+	server.config.HealthAlarms = HealthAlarmsWarn
+	server.poller.Subscribe(server.publishEvents) // a second subscriber shares the read
+	server.poller.poll()
+	code, ready = readiness(t, handler)
+	if alarmReads != 1 {
+		t.Errorf("alarms.xml read %d times for one poll, want 1", alarmReads)
+	}
+	if alarms := ready.Checks["alarms"]; code != http.StatusOK || ready.Status != CheckWarn || len(alarms.Alarms) != 1 || alarms.Alarms[0] != 55 {
+		t.Errorf("with an active alarm: got %d %+v", code, ready)
+	}
+	if ready.Checks["snapshot"].AgeSeconds == nil || ready.Checks["device"].Status != CheckPass {
+		t.Errorf("snapshot and device: got %+v", ready.Checks)
+	}
+
+	server.config.HealthAlarms = HealthAlarmsFail
+	if code, _ := readiness(t, handler); code != http.StatusServiceUnavailable {
+		t.Errorf("HEALTH_ALARMS=fail: got %d, want 503", code)
+	}
+	server.config.HealthAlarms = HealthAlarmsIgnore
+	if code, ready := readiness(t, handler); code != http.StatusOK || ready.Status != CheckPass {
+		t.Errorf("HEALTH_ALARMS=ignore: got %d %+v", code, ready)
+	}
+
+	mutex.Lock()
+	denied = true
+	mutex.Unlock()
+	server.poller.poll()
+	if code, ready := readiness(t, handler); code != http.StatusServiceUnavailable || ready.Checks["session"].Status != CheckFail {
+		t.Errorf("rejected session: got %d %+v", code, ready.Checks["session"])
+	}
+	mutex.Lock()
+	denied = false
+	mutex.Unlock()
+
+	server.config.PollInterval = time.Millisecond
+	server.config.HealthStalePolls = 2
+	time.Sleep(5 * time.Millisecond)
+	if code, ready := readiness(t, handler); code != http.StatusServiceUnavailable || ready.Checks["snapshot"].Status != CheckFail {
+		t.Errorf("stale snapshot: got %d %+v", code, ready.Checks["snapshot"])
+	}
+}
+
+// TestHealthReadinessDeviceOffline tests the offline grace period
+func TestHealthReadinessDeviceOffline(t *testing.T) {
+	mock := httptest.NewServer(http.NotFoundHandler())
+	mock.Close()
+
+	server := newTestServer(t, mock.URL)
+	server.client.SetRetryPolicy(RetryPolicy{Attempts: 1})
+	server.client.SetCircuitBreaker(NewCircuitBreaker(1, time.Minute))
+	server.client.GetAlarms()
+
+	check := server.checkDevice(server.config)
+	if check.Status != CheckFail || check.Since == nil {
+		t.Errorf("offline: got %+v", check)
+	}
+
+	server.config.HealthOfflineGrace = time.Hour
+	if check := server.checkDevice(server.config); check.Status != CheckWarn {
+		t.Errorf("offline within grace: got %+v", check)
+	}
+}
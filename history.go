@@ -0,0 +1,125 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultHistorySize is how many polled snapshots are kept, 24 hours at the default poll interval
+const DefaultHistorySize = 2880
+
+// HistorySample is one polled snapshot
+type HistorySample struct {
+	Time   time.Time
+	Values map[string]string
+}
+
+// History keeps the most recent polled snapshots in memory
+// Most parameters are settings that rarely change, so each sample stores only
+// the values that differ from the previous one.
+type History struct {
+	mutex   sync.RWMutex
+	size    int
+	base    map[string]string // values before the oldest sample
+	latest  map[string]string // values after the newest sample
+	samples []historySample   // oldest first
+}
+
+type historySample struct {
+	time    time.Time
+	changes map[string]string
+}
+
+// NewHistory creates a history holding up to size snapshots
+func NewHistory(size int) *History {
+	if size < 1 {
+		size = DefaultHistorySize
+	}
+	return &History{
+		size:   size,
+		base:   make(map[string]string),
+		latest: make(map[string]string),
+	}
+}
+
+// Observe records a polled snapshot
+func (h *History) Observe(data *DeviceData) {
+	h.Record(time.Now(), data.Items)
+}
+
+// Record stores the values of a snapshot taken at t
+// Parameters missing from a snapshot keep their previous value.
+func (h *History) Record(t time.Time, values map[string]string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	changes := make(map[string]string)
+	for id, value := range values {
+		if previous, ok := h.latest[id]; !ok || previous != value {
+			changes[id] = value
+			h.latest[id] = value
+		}
+	}
+	h.samples = append(h.samples, historySample{time: t, changes: changes})
+
+	if len(h.samples) > h.size {
+		for id, value := range h.samples[0].changes {
+			h.base[id] = value
+		}
+		h.samples = h.samples[1:]
+	}
+}
+
+// Len returns the number of stored snapshots
+func (h *History) Len() int {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return len(h.samples)
+}
+
+// IDs returns every parameter seen in the stored snapshots, sorted
+func (h *History) IDs() []string {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	ids := make([]string, 0, len(h.latest))
+	for id := range h.latest {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Samples returns the snapshots taken between from and to (inclusive), oldest
+// first, limited to the given parameters. Zero times leave a bound open.
+func (h *History) Samples(ids []string, from, to time.Time) []HistorySample {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	current := make(map[string]string, len(ids))
+	for _, id := range ids {
+		if value, ok := h.base[id]; ok {
+			current[id] = value
+		}
+	}
+
+	var samples []HistorySample
+	for _, sample := range h.samples {
+		for _, id := range ids {
+			if value, ok := sample.changes[id]; ok {
+				current[id] = value
+			}
+		}
+		if (!from.IsZero() && sample.time.Before(from)) || (!to.IsZero() && sample.time.After(to)) {
+			continue
+		}
+
+		values := make(map[string]string, len(current))
+		for id, value := range current {
+			values[id] = value
+		}
+		samples = append(samples, HistorySample{Time: sample.time, Values: values})
+	}
+	return samples
+}
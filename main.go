@@ -2,84 +2,93 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 )
 
-var (
-	atreaIP       = "192.168.68.106"
-	atreaPassword = "6378"
-	serverPort    = 8080
-)
+func main() {
+	// Check for --capture flag
+	captureFlag := flag.Bool("capture", false, "Capture anonymised device responses from every endpoint into CAPTURE_DIR")
+	flag.Bool("print-magic", false, "Read the device password from stdin and print its login magic for DEVICE_MAGIC")
 
-func loadConfig() error {
-	file, err := os.Open("config.env")
-	if err != nil {
-		// If config.env doesn't exist, use defaults
-		if os.IsNotExist(err) {
-			fmt.Println("Note: config.env not found, using default configuration")
-			return nil
+	// --print-magic runs before configuration is loaded since it needs no credentials
+	for _, arg := range os.Args[1:] {
+		if arg == "--print-magic" || arg == "-print-magic" {
+			if err := printMagic(os.Stdin); err != nil {
+				log.Fatalf("Failed to read password: %v", err)
+			}
+			os.Exit(0)
 		}
-		return err
 	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		// Skip empty lines and comments
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-
-		parts := strings.SplitN(line, "=", 2)
-		if len(parts) != 2 {
-			continue
-		}
-
-		key := strings.TrimSpace(parts[0])
-		value := strings.TrimSpace(parts[1])
 
-		switch key {
-		case "DEVICE_IP":
-			atreaIP = value
-		case "DEVICE_PASSWORD":
-			atreaPassword = value
-		case "SERVER_PORT":
-			fmt.Sscanf(value, "%d", &serverPort)
-		}
+	// Load layered configuration (flags > environment > config file)
+	cfg, err := LoadConfig(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	if cfg.ConfigFile == "" {
+		fmt.Println("Note: config.env not found, using defaults and environment")
 	}
-
-	return scanner.Err()
-}
-
-func main() {
-	// Check for --capture flag
-	captureFlag := flag.Bool("capture", false, "Capture real device responses and save to testdata/")
-	flag.Parse()
 
 	if *captureFlag {
-		if err := CaptureTestData(); err != nil {
+		if err := CaptureTestData(cfg); err != nil {
 			log.Fatalf("Error capturing test data: %v", err)
 		}
 		os.Exit(0)
 	}
 
-	// Load configuration from config.env
-	if err := loadConfig(); err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
-	}
-
 	fmt.Println("=== Atrea RD5 Web API Server ===")
-	fmt.Printf("Device IP: %s\n", atreaIP)
-	fmt.Printf("Server Port: %d\n", serverPort)
+	fmt.Printf("Device IP: %s\n", cfg.DeviceIP)
+	fmt.Printf("Server Port: %d\n", cfg.ServerPort)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	// Create and start server
-	server := NewServer(atreaIP, atreaPassword)
-	if err := server.StartServer(serverPort); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	server := NewServerWithConfig(cfg)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.StartServer(cfg.ServerPort)
+	}()
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	case <-ctx.Done():
+		log.Printf("Shutting down, draining in-flight requests...")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Graceful shutdown failed: %v", err)
+		}
+		if err := <-errCh; err != nil {
+			log.Printf("Server error: %v", err)
+		}
+		log.Printf("Server stopped")
+	}
+}
+
+// printMagic reads a password line from r and prints the login magic,
+// so the cleartext password never has to be stored in configuration
+func printMagic(r io.Reader) error {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return errors.New("empty password")
 	}
+	fmt.Println(PasswordMagic(password))
+	return nil
 }
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Filter parameters reported by the unit
+const (
+	ParamFilterStatus = "I12015" // non-zero when the unit requests a filter change
+	ParamFilterHours  = "I12020" // filter runtime counter in hours
+)
+
+// runtimeWindow is how much runtime history is used to predict the next change
+const runtimeWindow = 14 * 24 * time.Hour
+
+// FilterChange records one filter replacement
+type FilterChange struct {
+	Time          time.Time `json:"time"`
+	HoursAtChange int       `json:"hours_at_change"`
+	Caller        string    `json:"caller"`
+	DeviceReset   bool      `json:"device_reset"`
+}
+
+// runtimeSample is one observation of the filter hour counter
+type runtimeSample struct {
+	Time  time.Time `json:"time"`
+	Hours int       `json:"hours"`
+}
+
+// MaintenanceStatus is the filter maintenance view returned by GET /maintenance
+type MaintenanceStatus struct {
+	FilterHours         int            `json:"filter_hours"`
+	FilterStatus        int            `json:"filter_status"`
+	HoursSinceChange    int            `json:"hours_since_change"`
+	ChangeIntervalHours int            `json:"change_interval_hours"`
+	RemainingHours      int            `json:"remaining_hours"`
+	ChangeDue           bool           `json:"change_due"`
+	RuntimeHoursPerDay  float64        `json:"runtime_hours_per_day"`
+	PredictedChange     *time.Time     `json:"predicted_change,omitempty"`
+	LastChange          *FilterChange  `json:"last_change,omitempty"`
+	Changes             []FilterChange `json:"changes"`
+	UpdatedAt           time.Time      `json:"updated_at"`
+}
+
+// maintenanceState is what the tracker persists between restarts
+type maintenanceState struct {
+	Changes  []FilterChange  `json:"changes"`
+	Samples  []runtimeSample `json:"samples"`
+	Notified bool            `json:"notified"` // the current crossing was passed to OnThreshold
+}
+
+// MaintenanceTracker follows the filter hour counter and predicts the next change
+type MaintenanceTracker struct {
+	path          string
+	intervalHours int
+	warningHours  int
+	resetParam    string
+	client        *WebClient
+
+	// OnThreshold is called once per crossing when the remaining hours drop to
+	// the warning level; the server hands it to the Notifier, which retries
+	OnThreshold func(MaintenanceStatus)
+
+	mutex    sync.Mutex
+	state    maintenanceState
+	latest   *DeviceData
+	latestAt time.Time
+}
+
+// NewMaintenanceTracker creates a tracker persisting to <StateDir>/maintenance.json
+func NewMaintenanceTracker(cfg *Config, client *WebClient) (*MaintenanceTracker, error) {
+	mt := &MaintenanceTracker{
+		path:          filepath.Join(cfg.StateDir, "maintenance.json"),
+		intervalHours: cfg.FilterChangeHours,
+		warningHours:  cfg.FilterWarningHours,
+		resetParam:    cfg.FilterResetParam,
+		client:        client,
+	}
+	if err := loadState(mt.path, &mt.state); err != nil {
+		return nil, fmt.Errorf("failed to load maintenance state: %w", err)
+	}
+	return mt, nil
+}
+
+// Observe records a polled snapshot and fires the threshold notification
+// once per crossing; it is re-armed once the change is no longer due.
+func (mt *MaintenanceTracker) Observe(data *DeviceData) {
+	hours, ok := filterHours(data)
+	if !ok {
+		return
+	}
+
+	mt.mutex.Lock()
+	now := time.Now()
+	mt.latest = data
+	mt.latestAt = now
+
+	// Keep one sample per hour of wall time within the prediction window
+	changed := false
+	samples := mt.state.Samples
+	if len(samples) == 0 || now.Sub(samples[len(samples)-1].Time) >= time.Hour {
+		samples = append(samples, runtimeSample{Time: now, Hours: hours})
+		changed = true
+	}
+	for len(samples) > 0 && now.Sub(samples[0].Time) > runtimeWindow {
+		samples = samples[1:]
+		changed = true
+	}
+	mt.state.Samples = samples
+
+	status := mt.statusLocked()
+	due := status.RemainingHours <= mt.warningHours || status.ChangeDue
+	if !due && mt.state.Notified {
+		// The counter was reset on the device or a change was recorded
+		mt.state.Notified = false
+		changed = true
+	}
+	notify := due && !mt.state.Notified
+	if notify {
+		mt.state.Notified = true
+		changed = true
+	}
+	if changed {
+		mt.saveLocked()
+	}
+	mt.mutex.Unlock()
+
+	if notify {
+		log.Printf("⚠ Filter change due in %dh (%dh since last change)", status.RemainingHours, status.HoursSinceChange)
+		if mt.OnThreshold != nil {
+			mt.OnThreshold(status)
+		}
+	}
+}
+
+// Status returns the maintenance view from the most recent snapshot
+func (mt *MaintenanceTracker) Status() (MaintenanceStatus, bool) {
+	mt.mutex.Lock()
+	defer mt.mutex.Unlock()
+	if mt.latest == nil {
+		return MaintenanceStatus{}, false
+	}
+	return mt.statusLocked(), true
+}
+
+// RecordChange records a filter change and acknowledges it on the device when
+// a reset parameter is configured
+func (mt *MaintenanceTracker) RecordChange(caller string) (FilterChange, error) {
+	change := FilterChange{Time: time.Now(), Caller: caller}
+
+	if mt.resetParam != "" {
+		if err := mt.client.WithCaller(caller).SetValue(mt.resetParam); err != nil {
+			return change, fmt.Errorf("failed to reset filter counter on device: %w", err)
+		}
+		change.DeviceReset = true
+	}
+
+	mt.mutex.Lock()
+	defer mt.mutex.Unlock()
+
+	if hours, ok := filterHours(mt.latest); ok && !change.DeviceReset {
+		change.HoursAtChange = hours
+	}
+	mt.state.Changes = append(mt.state.Changes, change)
+	mt.state.Notified = false
+	mt.saveLocked()
+
+	log.Printf("✓ Filter change recorded by %s (counter at %dh)", caller, change.HoursAtChange)
+	return change, nil
+}
+
+// statusLocked computes the status; the caller holds mt.mutex
+func (mt *MaintenanceTracker) statusLocked() MaintenanceStatus {
+	hours, _ := filterHours(mt.latest)
+	filterStatus, _ := mt.latest.GetIntValue(ParamFilterStatus)
+
+	status := MaintenanceStatus{
+		FilterHours:         hours,
+		FilterStatus:        filterStatus,
+		HoursSinceChange:    hours,
+		ChangeIntervalHours: mt.intervalHours,
+		Changes:             append([]FilterChange{}, mt.state.Changes...),
+		UpdatedAt:           mt.latestAt,
+	}
+
+	if n := len(mt.state.Changes); n > 0 {
+		last := mt.state.Changes[n-1]
+		status.LastChange = &last
+		// A counter below the recorded value means the device reset it itself
+		if hours >= last.HoursAtChange {
+			status.HoursSinceChange = hours - last.HoursAtChange
+		}
+	}
+
+	status.RemainingHours = mt.intervalHours - status.HoursSinceChange
+	status.ChangeDue = filterStatus != 0 || status.RemainingHours <= 0
+
+	status.RuntimeHoursPerDay = mt.runtimePerDayLocked()
+	if status.RemainingHours > 0 && status.RuntimeHoursPerDay > 0 {
+		days := float64(status.RemainingHours) / status.RuntimeHoursPerDay
+		predicted := mt.latestAt.Add(time.Duration(days * float64(24*time.Hour)))
+		status.PredictedChange = &predicted
+	}
+
+	return status
+}
+
+// runtimePerDayLocked estimates runtime hours per calendar day from recent samples
+// It assumes continuous operation until enough history has been collected.
+func (mt *MaintenanceTracker) runtimePerDayLocked() float64 {
+	samples := mt.state.Samples
+	if len(samples) < 2 {
+		return 24
+	}
+	first, last := samples[0], samples[len(samples)-1]
+	elapsed := last.Time.Sub(first.Time)
+	if elapsed < 6*time.Hour || last.Hours < first.Hours {
+		return 24
+	}
+	perDay := float64(last.Hours-first.Hours) / elapsed.Hours() * 24
+	if perDay > 24 {
+		perDay = 24
+	}
+	return perDay
+}
+
+func (mt *MaintenanceTracker) saveLocked() {
+	if err := saveState(mt.path, mt.state); err != nil {
+		log.Printf("✗ Failed to save maintenance state: %v", err)
+	}
+}
+
+// filterHours reads the filter hour counter from a snapshot
+func filterHours(data *DeviceData) (int, bool) {
+	if data == nil {
+		return 0, false
+	}
+	val, ok := data.Items[ParamFilterHours]
+	if !ok {
+		return 0, false
+	}
+	hours, err := strconv.Atoi(val)
+	return hours, err == nil
+}
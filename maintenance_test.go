@@ -0,0 +1,166 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// filterSnapshot builds a snapshot with the given filter counter and status
+func filterSnapshot(hours int, status int) *DeviceData {
+	return &DeviceData{Items: map[string]string{
+		ParamFilterHours:  strconv.Itoa(hours),
+		ParamFilterStatus: strconv.Itoa(status),
+	}}
+}
+
+// newTestTracker creates a tracker with state in a temp dir
+func newTestTracker(t *testing.T, client *WebClient) (*MaintenanceTracker, *Config) {
+	t.Helper()
+	cfg := DefaultConfig()
+	cfg.StateDir = t.TempDir()
+	cfg.FilterChangeHours = 1000
+	cfg.FilterWarningHours = 100
+
+	mt, err := NewMaintenanceTracker(cfg, client)
+	if err != nil {
+		t.Fatalf("failed to create tracker: %v", err)
+	}
+	return mt, cfg
+}
+
+// TestMaintenanceHoursSinceChange tests tracking runtime since the last recorded change
+func TestMaintenanceHoursSinceChange(t *testing.T) {
+	mt, cfg := newTestTracker(t, NewWebClient("127.0.0.1"))
+
+	mt.Observe(filterSnapshot(857, 0))
+	if _, err := mt.RecordChange("alice"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	mt.Observe(filterSnapshot(957, 0))
+
+	status, ok := mt.Status()
+	if !ok {
+		t.Fatal("expected status after observing a snapshot")
+	}
+	if status.HoursSinceChange != 100 || status.RemainingHours != 900 || status.ChangeDue {
+		t.Errorf("got since=%d remaining=%d due=%v, want 100/900/false", status.HoursSinceChange, status.RemainingHours, status.ChangeDue)
+	}
+	if status.LastChange == nil || status.LastChange.Caller != "alice" || status.LastChange.HoursAtChange != 857 {
+		t.Errorf("unexpected last change: %+v", status.LastChange)
+	}
+
+	// Changes survive a restart
+	reloaded, err := NewMaintenanceTracker(cfg, NewWebClient("127.0.0.1"))
+	if err != nil {
+		t.Fatalf("failed to reload tracker: %v", err)
+	}
+	reloaded.Observe(filterSnapshot(957, 0))
+	if status, _ := reloaded.Status(); status.HoursSinceChange != 100 {
+		t.Errorf("after reload: got since=%d, want 100", status.HoursSinceChange)
+	}
+}
+
+// TestMaintenancePrediction tests the replacement date prediction from recent runtime
+func TestMaintenancePrediction(t *testing.T) {
+	mt, _ := newTestTracker(t, NewWebClient("127.0.0.1"))
+
+	now := time.Now()
+	mt.state.Samples = []runtimeSample{
+		{Time: now.Add(-48 * time.Hour), Hours: 476},
+		{Time: now.Add(-30 * time.Minute), Hours: 500},
+	}
+	mt.Observe(filterSnapshot(500, 0))
+
+	status, _ := mt.Status()
+	if status.RuntimeHoursPerDay < 11.5 || status.RuntimeHoursPerDay > 12.5 {
+		t.Errorf("got %.2f runtime hours per day, want ~12", status.RuntimeHoursPerDay)
+	}
+	if status.PredictedChange == nil {
+		t.Fatal("expected predicted change date")
+	}
+	days := status.PredictedChange.Sub(now).Hours() / 24
+	if days < 40 || days > 43 {
+		t.Errorf("predicted change in %.1f days, want ~41.7 (500h at 12h/day)", days)
+	}
+}
+
+// TestMaintenanceThresholdNotification tests a single notification when the threshold is crossed
+func TestMaintenanceThresholdNotification(t *testing.T) {
+	mt, _ := newTestTracker(t, NewWebClient("127.0.0.1"))
+	var announced []MaintenanceStatus
+	mt.OnThreshold = func(status MaintenanceStatus) { announced = append(announced, status) }
+
+	mt.Observe(filterSnapshot(800, 0))
+	mt.Observe(filterSnapshot(950, 0))
+	mt.Observe(filterSnapshot(960, 0))
+
+	if len(announced) != 1 || announced[0].RemainingHours != 50 {
+		t.Errorf("got %+v, want a single notification with 50h remaining", announced)
+	}
+}
+
+// TestMaintenanceNotificationRearm tests that a crossing is announced once,
+// also across restarts, and again after the counter was reset
+func TestMaintenanceNotificationRearm(t *testing.T) {
+	mt, cfg := newTestTracker(t, NewWebClient("127.0.0.1"))
+	announced := 0
+	mt.OnThreshold = func(MaintenanceStatus) { announced++ }
+
+	mt.Observe(filterSnapshot(950, 0))
+	if !mt.state.Notified || announced != 1 {
+		t.Errorf("after crossing: notified=%v announced=%d, want true/1", mt.state.Notified, announced)
+	}
+
+	// No notification while notified, and an unchanged state is not rewritten
+	os.Remove(filepath.Join(cfg.StateDir, "maintenance.json"))
+	mt.Observe(filterSnapshot(960, 0))
+	if _, err := os.Stat(filepath.Join(cfg.StateDir, "maintenance.json")); !os.IsNotExist(err) {
+		t.Errorf("state saved on an unchanged poll: %v", err)
+	}
+	mt.saveLocked()
+
+	// A restarted tracker remembers the crossing was announced
+	restarted, err := NewMaintenanceTracker(cfg, NewWebClient("127.0.0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	restarted.OnThreshold = mt.OnThreshold
+	restarted.Observe(filterSnapshot(965, 0))
+
+	// The device reset its counter: the next crossing notifies again
+	restarted.Observe(filterSnapshot(10, 0))
+	if restarted.state.Notified {
+		t.Error("expected the notification to re-arm after a counter reset")
+	}
+	restarted.Observe(filterSnapshot(970, 0))
+	if announced != 2 {
+		t.Errorf("got %d announcements, want 2", announced)
+	}
+}
+
+// TestFilterChangeDeviceReset tests acknowledging a change on the device
+func TestFilterChangeDeviceReset(t *testing.T) {
+	device := &fakeDevice{values: map[string]string{}}
+	server := httptest.NewServer(device)
+	defer server.Close()
+
+	client := NewWebClient(server.Listener.Addr().String())
+	client.baseURL = server.URL
+	client.SetSessionID("12345")
+
+	mt, _ := newTestTracker(t, client)
+	mt.resetParam = "C10200=1"
+	mt.Observe(filterSnapshot(1200, 1))
+
+	change, err := mt.RecordChange("bob")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !change.DeviceReset || device.values["C10200"] != "1" {
+		t.Errorf("expected device reset write, got change %+v and values %v", change, device.values)
+	}
+}
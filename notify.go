@@ -0,0 +1,474 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// NotifierConfig is the JSON file referenced by NOTIFY_CONFIG_FILE
+//
+//	{
+//	  "webhooks": [{"url": "https://hooks.example.com/atrea"}],
+//	  "rules": [
+//	    {"name": "unit_fault", "alarm": true},
+//	    {"name": "indoor_cold", "parameter": "I10215", "below": 18, "hysteresis": 0.5}
+//	  ],
+//	  "retry": {"attempts": 5, "initial_backoff": "1s", "max_backoff": "1m"}
+//	}
+type NotifierConfig struct {
+	Webhooks []Webhook    `json:"webhooks"`
+	Rules    []NotifyRule `json:"rules"`
+	Retry    WebhookRetry `json:"retry"`
+	Timeout  Duration     `json:"timeout"`
+}
+
+// Webhook is a delivery target
+type Webhook struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// WebhookRetry controls redelivery of failed webhooks
+type WebhookRetry struct {
+	Attempts       int      `json:"attempts"`
+	InitialBackoff Duration `json:"initial_backoff"`
+	MaxBackoff     Duration `json:"max_backoff"`
+}
+
+// NotifyRule is a condition evaluated against every polled snapshot
+// A rule either watches alarms (Alarm or AlarmCodes) or a decoded parameter
+// compared with Below and/or Above. Hysteresis is the margin the value must
+// recover by before the rule resolves, so a value hovering at the limit does
+// not flap.
+type NotifyRule struct {
+	Name       string   `json:"name"`
+	Alarm      bool     `json:"alarm,omitempty"`
+	AlarmCodes []int    `json:"alarm_codes,omitempty"`
+	Parameter  string   `json:"parameter,omitempty"`
+	Below      *float64 `json:"below,omitempty"`
+	Above      *float64 `json:"above,omitempty"`
+	Hysteresis float64  `json:"hysteresis,omitempty"`
+}
+
+// watchesAlarms reports whether the rule is evaluated against the alarm list
+func (r NotifyRule) watchesAlarms() bool {
+	return r.Alarm || len(r.AlarmCodes) > 0
+}
+
+// Notification is the JSON body delivered to webhooks
+type Notification struct {
+	Event     string      `json:"event"` // "firing", "resolved" or a custom event such as "filter_change_due"
+	Rule      string      `json:"rule,omitempty"`
+	Parameter string      `json:"parameter,omitempty"`
+	Value     interface{} `json:"value,omitempty"`
+	Unit      string      `json:"unit,omitempty"`
+	Threshold *float64    `json:"threshold,omitempty"`
+	Alarms    []int       `json:"alarms,omitempty"`
+	Message   string      `json:"message"`
+	Device    string      `json:"device"`
+	Time      time.Time   `json:"time"`
+	Details   interface{} `json:"details,omitempty"`
+}
+
+// LoadNotifierConfig reads and validates a notifier configuration file
+func LoadNotifierConfig(path string) (*NotifierConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg NotifierConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// Validate checks rules and webhooks and fills retry defaults
+func (c *NotifierConfig) Validate() error {
+	if len(c.Webhooks) == 0 {
+		return fmt.Errorf("at least one webhook is required")
+	}
+	for _, hook := range c.Webhooks {
+		if hook.URL == "" {
+			return fmt.Errorf("webhook without url")
+		}
+	}
+
+	names := make(map[string]bool)
+	for _, rule := range c.Rules {
+		if rule.Name == "" || names[rule.Name] {
+			return fmt.Errorf("rule names must be unique and non-empty (%q)", rule.Name)
+		}
+		names[rule.Name] = true
+
+		if rule.watchesAlarms() == (rule.Parameter != "") {
+			return fmt.Errorf("rule %s: set either alarm/alarm_codes or parameter", rule.Name)
+		}
+		if rule.Parameter != "" && rule.Below == nil && rule.Above == nil {
+			return fmt.Errorf("rule %s: parameter rules need below and/or above", rule.Name)
+		}
+		if rule.Hysteresis < 0 {
+			return fmt.Errorf("rule %s: hysteresis must not be negative", rule.Name)
+		}
+	}
+
+	if c.Retry.Attempts <= 0 {
+		c.Retry.Attempts = 5
+	}
+	if c.Retry.InitialBackoff.Duration <= 0 {
+		c.Retry.InitialBackoff.Duration = time.Second
+	}
+	if c.Retry.MaxBackoff.Duration < c.Retry.InitialBackoff.Duration {
+		c.Retry.MaxBackoff.Duration = time.Minute
+	}
+	if c.Timeout.Duration <= 0 {
+		c.Timeout.Duration = 10 * time.Second
+	}
+	return nil
+}
+
+// Notifier evaluates rules on every snapshot and delivers webhooks in the background
+type Notifier struct {
+	config     NotifierConfig
+	device     string
+	httpClient *http.Client
+
+	mutex  sync.Mutex
+	firing map[string]bool
+
+	queueMutex sync.Mutex // guards started, closed and sends on queue
+	queue      chan Notification
+	done       chan struct{}
+	started    bool
+	closed     bool
+
+	ctx    context.Context // cancelled when Stop gives up, aborting deliveries
+	cancel context.CancelFunc
+}
+
+// NewNotifier creates a notifier for the device at deviceIP
+func NewNotifier(cfg NotifierConfig, deviceIP string) *Notifier {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Notifier{
+		config:     cfg,
+		device:     deviceIP,
+		httpClient: &http.Client{Timeout: cfg.Timeout.Duration},
+		firing:     make(map[string]bool),
+		queue:      make(chan Notification, 64),
+		done:       make(chan struct{}),
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+}
+
+// Start launches the delivery worker
+func (n *Notifier) Start() {
+	n.queueMutex.Lock()
+	defer n.queueMutex.Unlock()
+	if n.started || n.closed {
+		return
+	}
+	n.started = true
+	go n.run()
+}
+
+// Stop delivers queued notifications and stops the worker. When ctx ends
+// first, the delivery in progress is aborted, the rest are dropped and
+// ctx.Err() is returned. It is safe to call before Start and more than once.
+func (n *Notifier) Stop(ctx context.Context) error {
+	n.queueMutex.Lock()
+	if !n.closed {
+		n.closed = true
+		close(n.queue)
+	}
+	started := n.started
+	n.queueMutex.Unlock()
+
+	if !started {
+		return nil
+	}
+	select {
+	case <-n.done:
+		return nil
+	case <-ctx.Done():
+	}
+	n.cancel()
+	<-n.done
+	return ctx.Err()
+}
+
+// WatchesAlarms reports whether any rule needs the alarm list
+func (n *Notifier) WatchesAlarms() bool {
+	for _, rule := range n.config.Rules {
+		if rule.watchesAlarms() {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate checks every rule against a snapshot and the active alarm codes
+// Only state changes are delivered: one "firing" when a rule trips and one
+// "resolved" when it recovers, so repeated polls do not produce duplicates.
+func (n *Notifier) Evaluate(data *DeviceData, activeAlarms []int) {
+	for _, rule := range n.config.Rules {
+		var notification Notification
+		var firing, known bool
+
+		if rule.watchesAlarms() {
+			firing, known, notification = n.evaluateAlarms(rule, activeAlarms)
+		} else {
+			firing, known, notification = n.evaluateParameter(rule, data)
+		}
+		if !known {
+			continue
+		}
+
+		n.mutex.Lock()
+		changed := n.firing[rule.Name] != firing
+		n.firing[rule.Name] = firing
+		n.mutex.Unlock()
+
+		if !changed {
+			continue
+		}
+
+		notification.Rule = rule.Name
+		if firing {
+			notification.Event = "firing"
+		} else {
+			notification.Event = "resolved"
+			notification.Message = "Resolved: " + notification.Message
+		}
+		n.Send(notification)
+	}
+}
+
+// evaluateAlarms returns whether an alarm rule fires
+func (n *Notifier) evaluateAlarms(rule NotifyRule, activeAlarms []int) (bool, bool, Notification) {
+	var matched []int
+	for _, code := range activeAlarms {
+		if rule.Alarm || containsInt(rule.AlarmCodes, code) {
+			matched = append(matched, code)
+		}
+	}
+
+	notification := Notification{
+		Alarms:  matched,
+		Message: fmt.Sprintf("Unit reports %d active alarm(s)", len(matched)),
+	}
+	if len(matched) == 0 {
+		notification.Message = "No active alarms"
+	}
+	return len(matched) > 0, true, notification
+}
+
+// evaluateParameter returns whether a threshold rule fires, applying hysteresis
+func (n *Notifier) evaluateParameter(rule NotifyRule, data *DeviceData) (bool, bool, Notification) {
+	if data == nil {
+		return false, false, Notification{}
+	}
+	decoded, ok := data.Decode(rule.Parameter)
+	if !ok {
+		return false, false, Notification{}
+	}
+	value, ok := numericValue(decoded.Value)
+	if !ok {
+		return false, false, Notification{}
+	}
+
+	n.mutex.Lock()
+	wasFiring := n.firing[rule.Name]
+	n.mutex.Unlock()
+
+	firing := false
+	var threshold *float64
+	if rule.Below != nil {
+		limit := *rule.Below
+		if wasFiring {
+			limit += rule.Hysteresis
+		}
+		if value < limit {
+			firing, threshold = true, rule.Below
+		}
+	}
+	if rule.Above != nil && !firing {
+		limit := *rule.Above
+		if wasFiring {
+			limit -= rule.Hysteresis
+		}
+		if value > limit {
+			firing, threshold = true, rule.Above
+		}
+	}
+	if threshold == nil {
+		threshold = rule.Below
+		if threshold == nil {
+			threshold = rule.Above
+		}
+	}
+
+	return firing, true, Notification{
+		Parameter: rule.Parameter,
+		Value:     decoded.Value,
+		Unit:      decoded.Unit,
+		Threshold: threshold,
+		Message:   fmt.Sprintf("%s is %v%s (limit %v%s)", decoded.Name, decoded.Value, decoded.Unit, *threshold, decoded.Unit),
+	}
+}
+
+// Send queues a notification for delivery to every webhook
+func (n *Notifier) Send(notification Notification) {
+	notification.Device = n.device
+	if notification.Time.IsZero() {
+		notification.Time = time.Now()
+	}
+
+	log.Printf("🔔 Notification %s %s: %s", notification.Event, notification.Rule, notification.Message)
+	n.queueMutex.Lock()
+	defer n.queueMutex.Unlock()
+	if n.closed {
+		log.Printf("✗ Notifier stopped, dropping %s %s", notification.Event, notification.Rule)
+		return
+	}
+	select {
+	case n.queue <- notification:
+	default:
+		log.Printf("✗ Notification queue full, dropping %s %s", notification.Event, notification.Rule)
+	}
+}
+
+func (n *Notifier) run() {
+	defer close(n.done)
+	dropped := 0
+	for notification := range n.queue {
+		if n.ctx.Err() != nil {
+			dropped++
+			continue
+		}
+		for _, hook := range n.config.Webhooks {
+			if err := n.deliver(hook, notification); err != nil {
+				log.Printf("✗ Webhook %s failed: %v", hook.URL, err)
+			}
+		}
+	}
+	if dropped > 0 {
+		log.Printf("✗ Notifier stopped before delivery, dropped %d queued notifications", dropped)
+	}
+}
+
+// deliver posts a notification, retrying with exponential backoff on
+// network errors, 429 and 5xx responses
+func (n *Notifier) deliver(hook Webhook, notification Notification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	backoff := n.config.Retry.InitialBackoff.Duration
+	var lastErr error
+	for attempt := 1; attempt <= n.config.Retry.Attempts; attempt++ {
+		retry, err := n.post(hook, body)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if !retry || attempt == n.config.Retry.Attempts {
+			break
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-n.ctx.Done():
+			return fmt.Errorf("%w (last error: %v)", n.ctx.Err(), lastErr)
+		}
+		backoff *= 2
+		if backoff > n.config.Retry.MaxBackoff.Duration {
+			backoff = n.config.Retry.MaxBackoff.Duration
+		}
+	}
+	return lastErr
+}
+
+// post sends one request and reports whether a failure is worth retrying
+func (n *Notifier) post(hook Webhook, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(n.ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range hook.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := n.httpClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("status %d", resp.StatusCode)
+	default:
+		return false, fmt.Errorf("status %d", resp.StatusCode)
+	}
+}
+
+// FiringRules returns the names of rules currently firing
+func (n *Notifier) FiringRules() []string {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	var names []string
+	for name, firing := range n.firing {
+		if firing {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// numericValue converts a decoded value to float64
+func numericValue(v interface{}) (float64, bool) {
+	switch value := v.(type) {
+	case float64:
+		return value, true
+	case int:
+		return float64(value), true
+	case bool:
+		if value {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		f, err := strconv.ParseFloat(value, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func containsInt(values []int, v int) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookReceiver collects notifications posted to a local HTTP server
+type webhookReceiver struct {
+	mutex    sync.Mutex
+	received []Notification
+	failures int // number of initial requests answered with 503
+}
+
+func (wr *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	wr.mutex.Lock()
+	defer wr.mutex.Unlock()
+	if wr.failures > 0 {
+		wr.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	var n Notification
+	json.NewDecoder(r.Body).Decode(&n)
+	wr.received = append(wr.received, n)
+}
+
+func (wr *webhookReceiver) events() []string {
+	wr.mutex.Lock()
+	defer wr.mutex.Unlock()
+	var events []string
+	for _, n := range wr.received {
+		events = append(events, n.Event+":"+n.Rule)
+	}
+	return events
+}
+
+// newTestNotifier creates a started notifier posting to url with fast retries
+func newTestNotifier(t *testing.T, url string, rules []NotifyRule) *Notifier {
+	t.Helper()
+	cfg := NotifierConfig{
+		Webhooks: []Webhook{{URL: url}},
+		Rules:    rules,
+		Retry:    WebhookRetry{Attempts: 3, InitialBackoff: Duration{time.Millisecond}, MaxBackoff: Duration{5 * time.Millisecond}},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	n := NewNotifier(cfg, "127.0.0.1")
+	n.Start()
+	return n
+}
+
+func indoorSnapshot(celsius float64) *DeviceData {
+	raw, err := encodeTemperature(celsius)
+	if err != nil {
+		panic(err)
+	}
+	return &DeviceData{Items: map[string]string{"I10215": strconv.Itoa(raw)}}
+}
+
+// TestNotifierThresholdHysteresis tests dedup, hysteresis and the resolved message
+func TestNotifierThresholdHysteresis(t *testing.T) {
+	receiver := &webhookReceiver{}
+	ts := httptest.NewServer(receiver)
+	defer ts.Close()
+
+	below := 18.0
+	n := newTestNotifier(t, ts.URL, []NotifyRule{{Name: "indoor_cold", Parameter: "I10215", Below: &below, Hysteresis: 0.5}})
+
+	for _, celsius := range []float64{20, 17.5, 17.0, 18.2, 18.6, 18.4} {
+		n.Evaluate(indoorSnapshot(celsius), nil)
+	}
+	n.Stop(context.Background())
+
+	events := receiver.events()
+	want := []string{"firing:indoor_cold", "resolved:indoor_cold"}
+	if len(events) != len(want) || events[0] != want[0] || events[1] != want[1] {
+		t.Errorf("got events %v, want %v", events, want)
+	}
+	if len(receiver.received) > 0 && receiver.received[0].Value != 17.5 {
+		t.Errorf("firing value: got %v, want 17.5", receiver.received[0].Value)
+	}
+}
+
+// TestNotifierAlarmsAndRetry tests alarm rules and redelivery after 503 responses
+func TestNotifierAlarmsAndRetry(t *testing.T) {
+	receiver := &webhookReceiver{failures: 2}
+	ts := httptest.NewServer(receiver)
+	defer ts.Close()
+
+	n := newTestNotifier(t, ts.URL, []NotifyRule{
+		{Name: "any_fault", Alarm: true},
+		{Name: "frost", AlarmCodes: []int{66}},
+	})
+
+	n.Evaluate(nil, []int{55})
+	n.Evaluate(nil, []int{55})
+	n.Evaluate(nil, nil)
+	n.Stop(context.Background())
+
+	events := receiver.events()
+	want := []string{"firing:any_fault", "resolved:any_fault"}
+	if len(events) != len(want) || events[0] != want[0] || events[1] != want[1] {
+		t.Errorf("got events %v, want %v", events, want)
+	}
+}
+
+// TestLoadNotifierConfigValidation tests rejection of incomplete rules
+func TestLoadNotifierConfigValidation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notify.json")
+	os.WriteFile(path, []byte(`{"webhooks": [{"url": "http://localhost"}], "rules": [{"name": "x", "parameter": "I10215"}]}`), 0600)
+
+	if _, err := LoadNotifierConfig(path); err == nil {
+		t.Error("expected error for parameter rule without threshold")
+	}
+}
+
+// TestParseAlarmsXMLWithRealData tests alarm log parsing with the captured response
+func TestParseAlarmsXMLWithRealData(t *testing.T) {
+	alarmsData, err := os.ReadFile(filepath.Join("testdata", "response_alarms.xml"))
+	if err != nil {
+		t.Skipf("skipping test: cannot load test data (%v)", err)
+	}
+
+	alarms, err := ParseAlarmsXML(string(alarmsData))
+	if err != nil {
+		t.Fatalf("failed to parse alarms: %v", err)
+	}
+	if len(alarms.Events) == 0 {
+		t.Fatal("no alarm events parsed")
+	}
+	if len(alarms.Events) != 1126 {
+		t.Errorf("got %d events, want 1126 without the empty ring-buffer slots", len(alarms.Events))
+	}
+	if alarms.Alarms["66"] != "cleared" {
+		t.Errorf("alarm 66: got %q, want cleared", alarms.Alarms["66"])
+	}
+	if _, ok := alarms.Alarms["0"]; ok {
+		t.Error("empty slots parsed as alarm 0")
+	}
+	if active := fmt.Sprint(alarms.ActiveAlarms()); active != "[55 56 59 95 124]" {
+		t.Errorf("active alarms: got %s, want [55 56 59 95 124]", active)
+	}
+}
+
+// TestParseAlarmsXMLWrapped tests that state follows time, not the ring-buffer position
+func TestParseAlarmsXMLWrapped(t *testing.T) {
+	// The newest entries were written over the start of the buffer
+	alarms, err := ParseAlarmsXML(`<root><errors>` +
+		`<i t="1700000300" i="55" p="1"/><i t="1700000400" i="66" p="0"/>` +
+		`<i t="1700000100" i="55" p="0"/><i t="1700000200" i="66" p="1"/>` +
+		`<i t="0" i="0" p="0"/></errors></root>`)
+	if err != nil {
+		t.Fatalf("failed to parse alarms: %v", err)
+	}
+	if alarms.Alarms["55"] != "cleared" || alarms.Alarms["66"] != "active" {
+		t.Errorf("got %v, want 55 cleared and 66 active", alarms.Alarms)
+	}
+	if len(alarms.Events) != 4 || alarms.Events[0].Code != 55 || alarms.Events[3].Code != 66 {
+		t.Errorf("events not ordered by time: %+v", alarms.Events)
+	}
+}
+
+// TestNotifierStopWithoutStart tests that Stop does not wait for a worker that never ran
+// and that Send after Stop drops the notification
+func TestNotifierStopWithoutStart(t *testing.T) {
+	n := NewNotifier(NotifierConfig{}, "127.0.0.1")
+	stopped := make(chan struct{})
+	go func() {
+		n.Stop(context.Background())
+		n.Stop(context.Background())
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Stop blocked without Start")
+	}
+
+	n.Send(Notification{Event: "firing", Rule: "after-stop"})
+	n.Start()
+}
+
+// TestNotifierStopDeadline tests that Stop gives up on a failing webhook when
+// its context ends and drops the queued notifications
+func TestNotifierStopDeadline(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	cfg := NotifierConfig{
+		Webhooks: []Webhook{{URL: ts.URL}},
+		Retry:    WebhookRetry{Attempts: 10, InitialBackoff: Duration{time.Second}, MaxBackoff: Duration{time.Minute}},
+	}
+	n := NewNotifier(cfg, "127.0.0.1")
+	n.Start()
+	for i := 0; i < 3; i++ {
+		n.Send(Notification{Event: "firing", Rule: fmt.Sprintf("rule-%d", i)})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := n.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Stop took %s past its deadline", elapsed)
+	}
+}
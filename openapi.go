@@ -0,0 +1,388 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// apiParam is a path or query parameter of an operation
+type apiParam struct {
+	Name        string
+	In          string // "path" or "query"
+	Type        string // "string", "integer" or "boolean"
+	Description string
+	Enum        []string
+}
+
+// apiOperation documents one method of a route
+type apiOperation struct {
+	Method   string
+	Summary  string
+	Params   []apiParam
+	Request  interface{} // request body type, nil without a body
+	Response interface{} // type of APIResponse.Data, nil without data; oneOf for alternatives
+	Status   int         // success status, 200 when zero
+	Raw      bool        // response is not wrapped in APIResponse
+	Content  string      // media type of a raw response, JSON when empty
+	Public   bool        // served without an API token
+}
+
+// oneOf documents alternative data types of one response
+type oneOf []interface{}
+
+var limitParam = apiParam{Name: "limit", In: "query", Type: "integer", Description: "Maximum number of entries"}
+
+// apiPaths documents every route served by Server.routes
+// A "{name}" segment is served by the route pattern ending before it.
+var apiPaths = map[string][]apiOperation{
+	"/health": {
+		{Method: http.MethodGet, Summary: "Server health, device circuit breaker and request queue", Response: HealthResponse{}, Public: true},
+	},
+	"/health/live": {
+		{Method: http.MethodGet, Summary: "Liveness of the server process", Response: HealthResponse{}, Public: true},
+	},
+	"/health/ready": {
+		{Method: http.MethodGet, Summary: "Readiness: device, session, snapshot age and alarms; 503 when a check fails", Response: ReadinessResponse{}, Public: true},
+	},
+	"/status": {
+		{Method: http.MethodGet, Summary: "Device status, temperatures and clock", Response: StatusResponse{}},
+	},
+	"/temperature": {
+		{Method: http.MethodGet, Summary: "Indoor and outdoor temperature", Response: TemperatureResponse{}},
+	},
+	"/alarms": {
+		{Method: http.MethodGet, Summary: "Active alarms and the device alarm log", Response: AlarmsResponse{}},
+	},
+	"/dashboard": {
+		{Method: http.MethodGet, Summary: "Dashboard data from the latest poll", Response: DashboardResponse{}},
+	},
+	"/device": {
+		{Method: http.MethodGet, Summary: "Model, firmware, serial, network identity and uptime of the unit", Response: DeviceInfo{}},
+	},
+	"/parameters": {
+		{Method: http.MethodGet, Summary: "All parameters reported by the device", Params: []apiParam{
+			limitParam,
+			{Name: "decoded", In: "query", Type: "boolean", Description: "Decode values into engineering units"},
+		}, Response: oneOf{ParametersResponse{}, DecodedParametersResponse{}}},
+	},
+	"/parameter/{id}": {
+		{Method: http.MethodGet, Summary: "One parameter", Params: []apiParam{
+			{Name: "id", In: "path", Type: "string", Description: "Parameter ID, e.g. I10215"},
+			{Name: "decoded", In: "query", Type: "boolean", Description: "Decode the value into engineering units"},
+		}, Response: oneOf{ParameterResponse{}, DecodedValue{}}},
+	},
+	"/mode": {
+		{Method: http.MethodGet, Summary: "Operating mode with fan power", Response: VentilationResponse{}},
+		{Method: http.MethodPut, Summary: "Request an operating mode", Request: ModeRequest{}, Response: []WriteResult{}},
+	},
+	"/power": {
+		{Method: http.MethodGet, Summary: "Fan power with operating mode", Response: VentilationResponse{}},
+		{Method: http.MethodPut, Summary: "Request a fan power in percent", Request: PowerRequest{}, Response: []WriteResult{}},
+	},
+	"/setpoint": {
+		{Method: http.MethodGet, Summary: "Temperature setpoint", Response: SetpointResponse{}},
+		{Method: http.MethodPut, Summary: "Set the temperature setpoint", Request: SetpointRequest{}, Response: []WriteResult{}},
+	},
+	"/maintenance": {
+		{Method: http.MethodGet, Summary: "Filter hours and predicted filter change", Response: MaintenanceStatus{}},
+	},
+	"/maintenance/filter-change": {
+		{Method: http.MethodPost, Summary: "Record a filter change", Response: FilterChange{}},
+	},
+	"/maintenance/mode": {
+		{Method: http.MethodGet, Summary: "Maintenance mode", Response: ServiceMode{}},
+		{Method: http.MethodPut, Summary: "Turn maintenance mode on or off", Request: ServiceModeRequest{}, Response: ServiceMode{}},
+	},
+	"/automation": {
+		{Method: http.MethodGet, Summary: "Automation rules with last run and cooldown", Response: AutomationResponse{}},
+	},
+	"/automation/audit": {
+		{Method: http.MethodGet, Summary: "Actions taken by automation rules", Params: []apiParam{limitParam}, Response: []AuditEntry{}},
+	},
+	"/override": {
+		{Method: http.MethodGet, Summary: "Active temporary override", Response: &Override{}},
+		{Method: http.MethodPost, Summary: "Start a temporary override", Request: OverrideRequest{}, Response: Override{}},
+		{Method: http.MethodDelete, Summary: "Cancel the override and restore the previous values", Response: Override{}},
+	},
+	"/audit": {
+		{Method: http.MethodGet, Summary: "Changes made to the device, newest first", Params: []apiParam{
+			{Name: "caller", In: "query", Type: "string"},
+			{Name: "action", In: "query", Type: "string", Enum: []string{AuditWrite, AuditSchedule, AuditNetwork, AuditSystem, AuditAutomation}},
+			{Name: "parameter", In: "query", Type: "string"},
+			{Name: "since", In: "query", Type: "string", Description: "RFC 3339 timestamp"},
+			limitParam,
+		}, Response: []AuditRecord{}},
+	},
+	"/system": {
+		{Method: http.MethodGet, Summary: "Allowed system commands and maintenance mode", Response: SystemResponse{}},
+	},
+	"/system/{command}": {
+		{Method: http.MethodPost, Summary: "Request a confirmation token for a system command", Params: []apiParam{
+			{Name: "command", In: "path", Type: "string", Enum: systemCommands},
+		}, Request: SystemCommandRequest{}, Response: PendingCommand{}, Status: http.StatusAccepted},
+	},
+	"/system/confirm": {
+		{Method: http.MethodPost, Summary: "Execute the command of a confirmation token", Request: SystemCommandRequest{}, Response: PendingCommand{}},
+	},
+	"/openapi.json": {
+		{Method: http.MethodGet, Summary: "This OpenAPI document", Raw: true, Public: true},
+	},
+	"/export.csv": {
+		{Method: http.MethodGet, Summary: "Polled history as CSV with decoded values", Params: []apiParam{
+			{Name: "ids", In: "query", Type: "string", Description: "Comma-separated parameter IDs, all by default"},
+			{Name: "from", In: "query", Type: "string", Description: "RFC 3339 timestamp"},
+			{Name: "to", In: "query", Type: "string", Description: "RFC 3339 timestamp"},
+		}, Raw: true, Content: "text/csv"},
+	},
+	"/ws": {
+		{Method: http.MethodGet, Summary: "WebSocket channel pushing change events and accepting commands, see API.md", Params: []apiParam{
+			{Name: "access_token", In: "query", Type: "string", Description: "API token, for browsers that cannot send the Authorization header"},
+		}, Raw: true, Status: http.StatusSwitchingProtocols},
+	},
+	"/ui/": {
+		{Method: http.MethodGet, Summary: "Web dashboard", Raw: true, Content: "text/html", Public: true},
+	},
+}
+
+// openAPIDocument is built once, the documented types do not change at run time
+var openAPIDocument = sync.OnceValue(OpenAPISpec)
+
+// GET /openapi.json - OpenAPI 3 description of the API
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(openAPIDocument())
+}
+
+// OpenAPISpec builds the OpenAPI 3 document from apiPaths and the Go types
+func OpenAPISpec() map[string]interface{} {
+	schemas := &schemaRegistry{defs: make(map[string]interface{})}
+	errorSchema := schemas.of(APIResponse{})
+
+	paths := make(map[string]interface{})
+	for path, operations := range apiPaths {
+		item := make(map[string]interface{})
+		for _, op := range operations {
+			item[strings.ToLower(op.Method)] = schemas.operation(op, errorSchema)
+		}
+		paths[path] = item
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "Atrea RD5 API",
+			"version":     "1.0.0",
+			"description": "REST API for the Atrea RD5 ventilation unit. Errors carry a machine-readable code, see API.md.",
+		},
+		"paths":    paths,
+		"security": []interface{}{map[string]interface{}{"bearer": []string{}}},
+		"components": map[string]interface{}{
+			"schemas": schemas.defs,
+			"securitySchemes": map[string]interface{}{
+				"bearer": map[string]interface{}{"type": "http", "scheme": "bearer", "description": "API token from AUTH_TOKENS"},
+			},
+		},
+	}
+}
+
+// schemaRegistry turns Go types into JSON schemas, collecting named structs
+// under components/schemas
+type schemaRegistry struct {
+	defs map[string]interface{}
+}
+
+func (sr *schemaRegistry) operation(op apiOperation, errorSchema interface{}) map[string]interface{} {
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	var schema interface{} = map[string]interface{}{"type": "object"}
+	if op.Content != "" {
+		schema = map[string]interface{}{"type": "string"}
+	}
+	if !op.Raw {
+		schema = errorSchema
+		if op.Response != nil {
+			schema = map[string]interface{}{"allOf": []interface{}{
+				errorSchema,
+				map[string]interface{}{
+					"type":       "object",
+					"properties": map[string]interface{}{"data": sr.of(op.Response)},
+				},
+			}}
+		}
+	}
+
+	operation := map[string]interface{}{
+		"summary":     op.Summary,
+		"operationId": operationID(op.Method, op.Summary),
+		"responses": map[string]interface{}{
+			strconv.Itoa(status): content(http.StatusText(status), op.Content, schema),
+			"default":            jsonContent("Error; see the code field", errorSchema),
+		},
+	}
+	if status == http.StatusSwitchingProtocols {
+		// The connection leaves HTTP, there is no response body to describe
+		operation["responses"].(map[string]interface{})[strconv.Itoa(status)] = map[string]interface{}{"description": http.StatusText(status)}
+	}
+	if op.Public {
+		operation["security"] = []interface{}{}
+	}
+	if op.Request != nil {
+		body := jsonContent("", sr.of(op.Request))
+		delete(body, "description")
+		body["required"] = true
+		operation["requestBody"] = body
+	}
+	if len(op.Params) > 0 {
+		var params []interface{}
+		for _, p := range op.Params {
+			schema := map[string]interface{}{"type": p.Type}
+			if len(p.Enum) > 0 {
+				schema["enum"] = p.Enum
+			}
+			param := map[string]interface{}{
+				"name":     p.Name,
+				"in":       p.In,
+				"required": p.In == "path",
+				"schema":   schema,
+			}
+			if p.Description != "" {
+				param["description"] = p.Description
+			}
+			params = append(params, param)
+		}
+		operation["parameters"] = params
+	}
+	return operation
+}
+
+func jsonContent(description string, schema interface{}) map[string]interface{} {
+	return content(description, "", schema)
+}
+
+func content(description, mediaType string, schema interface{}) map[string]interface{} {
+	if mediaType == "" {
+		mediaType = "application/json"
+	}
+	return map[string]interface{}{
+		"description": description,
+		"content": map[string]interface{}{
+			mediaType: map[string]interface{}{"schema": schema},
+		},
+	}
+}
+
+// operationID derives an identifier such as "getOperatingModeAndFanPower"
+func operationID(method, summary string) string {
+	id := strings.ToLower(method)
+	for _, word := range strings.FieldsFunc(summary, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	}) {
+		id += strings.ToUpper(word[:1]) + word[1:]
+	}
+	return id
+}
+
+// of returns the schema of a value's type; oneOf lists alternatives
+func (sr *schemaRegistry) of(v interface{}) interface{} {
+	if alternatives, ok := v.(oneOf); ok {
+		var schemas []interface{}
+		for _, alternative := range alternatives {
+			schemas = append(schemas, sr.of(alternative))
+		}
+		return map[string]interface{}{"oneOf": schemas}
+	}
+	return sr.typeSchema(reflect.TypeOf(v))
+}
+
+// Types whose JSON form differs from their Go structure
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(Duration{})
+	modeType     = reflect.TypeOf(VentilationMode(0))
+)
+
+func (sr *schemaRegistry) typeSchema(t reflect.Type) interface{} {
+	switch t {
+	case timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case durationType:
+		return map[string]interface{}{"type": "string", "description": "Go duration such as \"30m\""}
+	case modeType:
+		var names []string
+		for mode := ModeOff; mode <= ModeHPDefrosting; mode++ {
+			names = append(names, mode.String())
+		}
+		return map[string]interface{}{"type": "string", "enum": names, "description": "Mode name; requests also accept the numeric ID"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return sr.typeSchema(t.Elem())
+	case reflect.Struct:
+		return sr.structSchema(t)
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": sr.typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": sr.typeSchema(t.Elem())}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	}
+	return map[string]interface{}{} // interface{}: any value
+}
+
+// structSchema registers a named struct and returns a reference to it
+func (sr *schemaRegistry) structSchema(t reflect.Type) interface{} {
+	ref := map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	if _, done := sr.defs[t.Name()]; done {
+		return ref
+	}
+	sr.defs[t.Name()] = nil // guards against recursive types
+
+	properties := make(map[string]interface{})
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = sr.typeSchema(field.Type)
+		if !strings.Contains(options, "omitempty") && field.Type.Kind() != reflect.Ptr {
+			required = append(required, name)
+		}
+	}
+
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		sort.Strings(required)
+		schema["required"] = required
+	}
+	sr.defs[t.Name()] = schema
+	return ref
+}
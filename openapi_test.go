@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// routeFor returns the route pattern that serves a documented path
+// A "{name}" segment is served by the pattern ending before it, other
+// paths by an exact pattern or the longest subtree pattern ("/x/").
+func routeFor(path string, patterns map[string]bool) string {
+	if i := strings.Index(path, "{"); i >= 0 {
+		path = path[:i]
+	}
+	if patterns[path] {
+		return path
+	}
+	best := ""
+	for pattern := range patterns {
+		if strings.HasSuffix(pattern, "/") && strings.HasPrefix(path, pattern) && len(pattern) > len(best) {
+			best = pattern
+		}
+	}
+	return best
+}
+
+// TestOpenAPICoversRoutes tests that the spec and the registered routes match
+func TestOpenAPICoversRoutes(t *testing.T) {
+	device := &fakeDevice{values: map[string]string{"H10714": "50"}}
+	mock := httptest.NewServer(device)
+	defer mock.Close()
+	server := newTestServer(t, mock.URL)
+	handler := server.Handler()
+
+	patterns := make(map[string]bool)
+	for _, rt := range server.routes() {
+		patterns[rt.pattern] = true
+	}
+
+	covered := make(map[string]bool)
+	for path, operations := range apiPaths {
+		pattern := routeFor(path, patterns)
+		if pattern == "" {
+			t.Errorf("%s is documented but no route serves it", path)
+			continue
+		}
+		covered[pattern] = true
+
+		// Documented methods must be handled, others rejected
+		url := strings.NewReplacer("{id}", "H10714", "{command}", "reset").Replace(path)
+		documented := make(map[string]bool)
+		for _, op := range operations {
+			documented[op.Method] = true
+		}
+		for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodPost, http.MethodDelete} {
+			req := httptest.NewRequest(method, url, strings.NewReader("{}"))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if documented[method] && w.Code == http.StatusMethodNotAllowed {
+				t.Errorf("%s %s is documented but not allowed", method, path)
+			}
+			if !documented[method] && w.Code != http.StatusMethodNotAllowed {
+				t.Errorf("%s %s is served (%d) but not documented", method, path, w.Code)
+			}
+		}
+	}
+	for pattern := range patterns {
+		if !covered[pattern] {
+			t.Errorf("route %s is missing from the spec", pattern)
+		}
+	}
+}
+
+// TestOpenAPIEndpoint tests the served document and that its references resolve
+func TestOpenAPIEndpoint(t *testing.T) {
+	server := newTestServer(t, "http://127.0.0.1:1")
+	req := httptest.NewRequest(http.MethodGet, "/openapi.json", nil)
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200", w.Code)
+	}
+	body := w.Body.String()
+	var spec struct {
+		OpenAPI    string                                             `json:"openapi"`
+		Paths      map[string]map[string]struct{ OperationID string } `json:"paths"`
+		Components struct {
+			Schemas map[string]json.RawMessage `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal([]byte(body), &spec); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if spec.OpenAPI != "3.0.3" {
+		t.Errorf("got openapi %q, want 3.0.3", spec.OpenAPI)
+	}
+	for _, name := range []string{"APIResponse", "StatusResponse", "ParametersResponse", "WriteResult", "HealthResponse"} {
+		if _, ok := spec.Components.Schemas[name]; !ok {
+			t.Errorf("schema %s is missing", name)
+		}
+	}
+
+	operations := make(map[string]string)
+	for path, methods := range spec.Paths {
+		for method, op := range methods {
+			if op.OperationID == "" {
+				t.Errorf("%s %s has no operationId", method, path)
+			} else if other, ok := operations[op.OperationID]; ok {
+				t.Errorf("operationId %s used by %s and %s %s", op.OperationID, other, method, path)
+			}
+			operations[op.OperationID] = method + " " + path
+		}
+	}
+
+	for _, part := range strings.Split(body, `"$ref":"#/components/schemas/`)[1:] {
+		name := part[:strings.IndexByte(part, '"')]
+		if _, ok := spec.Components.Schemas[name]; !ok {
+			t.Errorf("unresolved reference to %s", name)
+		}
+	}
+}
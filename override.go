@@ -0,0 +1,286 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MaxOverrideDuration limits how long a temporary override may last
+const MaxOverrideDuration = 24 * time.Hour
+
+// overrideRetryInterval is how long to wait before retrying a failed revert
+const overrideRetryInterval = time.Minute
+
+// OverrideRequest is the body of POST /override
+type OverrideRequest struct {
+	Mode     *VentilationMode `json:"mode,omitempty"`
+	Power    *int             `json:"power,omitempty"`
+	Setpoint *float64         `json:"setpoint,omitempty"`
+	Duration Duration         `json:"duration"`
+}
+
+// Override is a temporary change that is reverted when it expires
+type Override struct {
+	Mode      *VentilationMode  `json:"mode,omitempty"`
+	Power     *int              `json:"power,omitempty"`
+	Setpoint  *float64          `json:"setpoint,omitempty"`
+	Writes    []string          `json:"writes"`
+	Previous  map[string]string `json:"previous"`
+	Caller    string            `json:"caller"`
+	StartedAt time.Time         `json:"started_at"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// Remaining returns the time left until the override is reverted
+func (o *Override) Remaining() time.Duration {
+	remaining := time.Until(o.ExpiresAt)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// restoreWrites returns the ID=VALUE writes that restore the previous state
+func (o *Override) restoreWrites() []string {
+	ids := make([]string, 0, len(o.Previous))
+	for id := range o.Previous {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	writes := make([]string, 0, len(ids))
+	for _, id := range ids {
+		writes = append(writes, FormatParam(id, o.Previous[id]))
+	}
+	return writes
+}
+
+// Validate checks the requested targets and duration and returns the writes
+func (req OverrideRequest) Validate() ([]string, error) {
+	if req.Duration.Duration <= 0 || req.Duration.Duration > MaxOverrideDuration {
+		return nil, fmt.Errorf("duration must be positive and at most %s", MaxOverrideDuration)
+	}
+	action := AutomationAction{Mode: req.Mode, Power: req.Power, Setpoint: req.Setpoint}
+	writes, err := action.writes()
+	if err != nil {
+		return nil, fmt.Errorf("override: %w", err)
+	}
+	return writes, nil
+}
+
+// OverrideManager applies temporary overrides and reverts them when they
+// expire, persisting the pending revert in <StateDir>/override.json
+type OverrideManager struct {
+	path   string
+	client *WebClient
+
+	writeMutex sync.Mutex // serialises the device I/O of Apply, Cancel and reverts
+
+	mutex      sync.Mutex // guards the fields below; never held during device I/O
+	current    *Override
+	generation uint64 // bumped whenever current changes, so a stale revert timer can tell
+	timer      *time.Timer
+	started    bool
+}
+
+// NewOverrideManager creates a manager and restores a pending override
+func NewOverrideManager(cfg *Config, client *WebClient) (*OverrideManager, error) {
+	om := &OverrideManager{
+		path:   filepath.Join(cfg.StateDir, "override.json"),
+		client: client,
+	}
+	var pending Override
+	if err := loadState(om.path, &pending); err != nil {
+		return nil, fmt.Errorf("failed to load override state: %w", err)
+	}
+	if !pending.ExpiresAt.IsZero() {
+		om.current = &pending
+	}
+	return om, nil
+}
+
+// Start schedules the revert of a restored override; one that expired
+// while the server was down is reverted immediately
+func (om *OverrideManager) Start() {
+	om.mutex.Lock()
+	defer om.mutex.Unlock()
+	om.started = true
+	if om.current != nil {
+		log.Printf("→ Restored override by %s, reverting in %s", om.current.Caller, om.current.Remaining().Round(time.Second))
+		om.scheduleLocked(om.current.Remaining())
+	}
+}
+
+// Stop cancels the revert timer; the pending override stays persisted
+// A revert already writing finishes, but none is started afterwards.
+func (om *OverrideManager) Stop() {
+	om.mutex.Lock()
+	defer om.mutex.Unlock()
+	om.started = false
+	if om.timer != nil {
+		om.timer.Stop()
+		om.timer = nil
+	}
+}
+
+// Active returns the current override, if any
+func (om *OverrideManager) Active() (*Override, bool) {
+	om.mutex.Lock()
+	defer om.mutex.Unlock()
+	if om.current == nil {
+		return nil, false
+	}
+	current := *om.current
+	return &current, true
+}
+
+// Apply captures the current values, writes the override and schedules the revert
+// Replacing an active override keeps the values captured by the first one, so
+// the unit always returns to the state from before any override.
+func (om *OverrideManager) Apply(req OverrideRequest, caller string) (*Override, error) {
+	writes, err := req.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	// No other override can be applied or reverted until this one is in place
+	om.writeMutex.Lock()
+	defer om.writeMutex.Unlock()
+
+	previous := make(map[string]string)
+	om.mutex.Lock()
+	if om.current != nil {
+		for id, value := range om.current.Previous {
+			previous[id] = value
+		}
+	}
+	om.mutex.Unlock()
+
+	data, err := om.client.readParameters()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read current values: %w", err)
+	}
+	for _, write := range writes {
+		id, _ := splitParam(write)
+		if _, captured := previous[id]; captured {
+			continue
+		}
+		value, ok := data.Items[id]
+		if !ok {
+			return nil, fmt.Errorf("parameter %s not reported by the device", id)
+		}
+		previous[id] = value
+	}
+
+	if err := om.client.WithCaller(caller).SetMultipleValues(writes); err != nil {
+		return nil, fmt.Errorf("failed to apply override: %w", err)
+	}
+
+	now := time.Now()
+	override := &Override{
+		Mode:      req.Mode,
+		Power:     req.Power,
+		Setpoint:  req.Setpoint,
+		Writes:    writes,
+		Previous:  previous,
+		Caller:    caller,
+		StartedAt: now,
+		ExpiresAt: now.Add(req.Duration.Duration),
+	}
+
+	om.mutex.Lock()
+	defer om.mutex.Unlock()
+	om.current = override
+	om.generation++
+	om.saveLocked()
+	if om.started {
+		om.scheduleLocked(req.Duration.Duration)
+	}
+
+	log.Printf("✓ Override by %s: %v for %s", caller, writes, req.Duration.Duration)
+	current := *override
+	return &current, nil
+}
+
+// Cancel restores the previous values immediately on behalf of caller
+func (om *OverrideManager) Cancel(caller string) (*Override, error) {
+	om.writeMutex.Lock()
+	defer om.writeMutex.Unlock()
+
+	cancelled, ok := om.Active()
+	if !ok {
+		return nil, nil
+	}
+	if err := om.restore(cancelled, caller); err != nil {
+		return nil, err
+	}
+	return cancelled, nil
+}
+
+// scheduleLocked (re)arms the revert timer for the current generation; the
+// caller holds om.mutex
+func (om *OverrideManager) scheduleLocked(after time.Duration) {
+	if om.timer != nil {
+		om.timer.Stop()
+	}
+	generation := om.generation
+	om.timer = time.AfterFunc(after, func() { om.expire(generation) })
+}
+
+// expire reverts the override of a generation, retrying later if the device
+// is unreachable; an override replaced or reverted in the meantime is left alone
+func (om *OverrideManager) expire(generation uint64) {
+	om.writeMutex.Lock()
+	defer om.writeMutex.Unlock()
+
+	om.mutex.Lock()
+	if om.current == nil || !om.started || om.generation != generation {
+		om.mutex.Unlock()
+		return
+	}
+	expired := *om.current
+	om.mutex.Unlock()
+
+	if err := om.restore(&expired, "override:"+expired.Caller); err != nil {
+		log.Printf("✗ Override revert failed, retrying in %s: %v", overrideRetryInterval, err)
+		om.mutex.Lock()
+		if om.started && om.generation == generation {
+			om.scheduleLocked(overrideRetryInterval)
+		}
+		om.mutex.Unlock()
+	}
+}
+
+// restore writes the previous values of o as caller and clears the override;
+// the caller holds om.writeMutex, so o is still the current override
+func (om *OverrideManager) restore(o *Override, caller string) error {
+	writes := o.restoreWrites()
+	if err := om.client.WithCaller(caller).SetMultipleValues(writes); err != nil {
+		return fmt.Errorf("failed to restore previous values: %w", err)
+	}
+
+	om.mutex.Lock()
+	defer om.mutex.Unlock()
+	log.Printf("✓ Override by %s reverted: %v", o.Caller, writes)
+	om.current = nil
+	om.generation++
+	if om.timer != nil {
+		om.timer.Stop()
+		om.timer = nil
+	}
+	if err := os.Remove(om.path); err != nil && !os.IsNotExist(err) {
+		log.Printf("✗ Failed to remove override state: %v", err)
+	}
+	return nil
+}
+
+func (om *OverrideManager) saveLocked() {
+	if err := saveState(om.path, om.current); err != nil {
+		log.Printf("✗ Failed to save override state: %v", err)
+	}
+}
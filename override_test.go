@@ -0,0 +1,142 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTestOverrides creates an override manager for a fake device and state dir
+func newTestOverrides(t *testing.T, device *fakeDevice, stateDir string) *OverrideManager {
+	t.Helper()
+	server := httptest.NewServer(device)
+	t.Cleanup(server.Close)
+	client := NewWebClient(server.Listener.Addr().String())
+	client.baseURL = server.URL
+	client.SetSessionID("12345")
+
+	om, err := NewOverrideManager(&Config{StateDir: stateDir}, client)
+	if err != nil {
+		t.Fatalf("failed to create override manager: %v", err)
+	}
+	return om
+}
+
+// waitFor polls cond until it holds or a second has passed
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestOverrideRevertsOnExpiry tests that the previous values return when the timer fires
+func TestOverrideRevertsOnExpiry(t *testing.T) {
+	device := &fakeDevice{values: map[string]string{"H10714": "50", "H10715": "1"}}
+	om := newTestOverrides(t, device, t.TempDir())
+	om.Start()
+	defer om.Stop()
+
+	override, err := om.Apply(OverrideRequest{Power: intPtr(100), Duration: Duration{50 * time.Millisecond}}, "alice")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if override.Previous["H10714"] != "50" || device.values["H10714"] != "100" {
+		t.Fatalf("got previous %v and device power %s", override.Previous, device.values["H10714"])
+	}
+
+	waitFor(t, func() bool {
+		_, active := om.Active()
+		return !active
+	})
+	if device.values["H10714"] != "50" {
+		t.Errorf("power after expiry: got %s, want 50", device.values["H10714"])
+	}
+}
+
+// TestOverrideReplaceKeepsOriginal tests that a second override reverts to the state before the first
+func TestOverrideReplaceKeepsOriginal(t *testing.T) {
+	device := &fakeDevice{values: map[string]string{"H10714": "50", "H10715": "1"}}
+	om := newTestOverrides(t, device, t.TempDir())
+
+	om.Apply(OverrideRequest{Power: intPtr(100), Duration: Duration{time.Hour}}, "alice")
+	om.Apply(OverrideRequest{Power: intPtr(80), Mode: modePtr(ModeVentilation), Duration: Duration{time.Hour}}, "bob")
+
+	cancelled, err := om.Cancel("alice")
+	if err != nil || cancelled == nil {
+		t.Fatalf("cancel: got %v, %v", cancelled, err)
+	}
+	if device.values["H10714"] != "50" || device.values["H10715"] != "1" {
+		t.Errorf("after cancel: got power %s mode %s, want 50 and 1", device.values["H10714"], device.values["H10715"])
+	}
+}
+
+// TestOverrideStaleRevertIgnored tests that the timer of a replaced override does not revert its successor
+func TestOverrideStaleRevertIgnored(t *testing.T) {
+	device := &fakeDevice{values: map[string]string{"H10714": "50"}}
+	om := newTestOverrides(t, device, t.TempDir())
+	om.Start()
+	defer om.Stop()
+
+	om.Apply(OverrideRequest{Power: intPtr(100), Duration: Duration{time.Hour}}, "alice")
+	om.mutex.Lock()
+	stale := om.generation
+	om.mutex.Unlock()
+	om.Apply(OverrideRequest{Power: intPtr(80), Duration: Duration{time.Hour}}, "bob")
+
+	om.expire(stale)
+	if override, active := om.Active(); !active || override.Caller != "bob" {
+		t.Fatalf("after stale expiry: got %v, %v, want bob's override", override, active)
+	}
+	if device.values["H10714"] != "80" {
+		t.Errorf("power after stale expiry: got %s, want 80", device.values["H10714"])
+	}
+}
+
+// TestOverridePersistsAcrossRestart tests that a pending revert survives a restart
+func TestOverridePersistsAcrossRestart(t *testing.T) {
+	device := &fakeDevice{values: map[string]string{"H10714": "50"}}
+	stateDir := t.TempDir()
+
+	first := newTestOverrides(t, device, stateDir)
+	if _, err := first.Apply(OverrideRequest{Power: intPtr(100), Duration: Duration{20 * time.Millisecond}}, "alice"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The first server stopped before the override expired
+	time.Sleep(30 * time.Millisecond)
+	second := newTestOverrides(t, device, stateDir)
+	if _, active := second.Active(); !active {
+		t.Fatal("override not restored from state")
+	}
+	second.Start()
+	defer second.Stop()
+
+	waitFor(t, func() bool {
+		_, active := second.Active()
+		return !active
+	})
+	if device.values["H10714"] != "50" {
+		t.Errorf("power after restart: got %s, want 50", device.values["H10714"])
+	}
+}
+
+// TestOverrideRequestValidate tests rejection of invalid overrides
+func TestOverrideRequestValidate(t *testing.T) {
+	tests := map[string]OverrideRequest{
+		"no target":      {Duration: Duration{time.Minute}},
+		"no duration":    {Power: intPtr(100)},
+		"too long":       {Power: intPtr(100), Duration: Duration{48 * time.Hour}},
+		"invalid power":  {Power: intPtr(5), Duration: Duration{time.Minute}},
+		"transient mode": {Mode: modePtr(ModeDefrosting), Duration: Duration{time.Minute}},
+	}
+	for name, req := range tests {
+		if _, err := req.Validate(); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
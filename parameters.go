@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ParameterKind describes how a raw parameter value is decoded
+type ParameterKind int
+
+const (
+	KindRaw         ParameterKind = iota // passed through unchanged
+	KindTemperature                      // tenths of °C, two's complement for negatives
+	KindPercent                          // integer percent
+	KindHours                            // integer hours
+	KindMode                             // VentilationMode
+	KindBoolean                          // 0/1 digital input or coil
+	KindInteger                          // plain integer without unit
+)
+
+// ParameterInfo is the metadata used to decode a parameter
+type ParameterInfo struct {
+	ID   string
+	Name string
+	Kind ParameterKind
+	Unit string
+}
+
+// parameterKinds assigns a decoding to known parameters; everything else is KindRaw
+// (or KindBoolean for D*/C* digital parameters)
+var parameterKinds = map[string]ParameterKind{
+	"I10211": KindTemperature,
+	"I10212": KindTemperature,
+	"I10213": KindTemperature,
+	"I10214": KindTemperature,
+	"I10215": KindTemperature,
+	"I10222": KindTemperature,
+	"I10224": KindTemperature,
+	"I10225": KindTemperature,
+	"I10249": KindTemperature,
+	"I10275": KindTemperature,
+	"I10281": KindTemperature,
+	"I10282": KindTemperature,
+	"H11010": KindTemperature,
+	"H11021": KindTemperature,
+
+	"I10230": KindPercent,
+	"I10244": KindPercent,
+	"H10714": KindPercent,
+
+	"H10715": KindMode,
+
+	"I12020": KindHours,
+	"H11406": KindHours,
+
+	"I00004": KindInteger,
+	"I00005": KindInteger,
+	"I00006": KindInteger,
+	"I00007": KindInteger,
+	"I00008": KindInteger,
+	"I00009": KindInteger,
+	"H10905": KindInteger,
+	"H10906": KindInteger,
+	"H10907": KindInteger,
+	"H10908": KindInteger,
+	"H10909": KindInteger,
+	"H11017": KindInteger,
+	"H11400": KindInteger,
+}
+
+var kindUnits = map[ParameterKind]string{
+	KindTemperature: "°C",
+	KindPercent:     "%",
+	KindHours:       "h",
+}
+
+// parameterKindNames are the kind names used in parameter profiles
+var parameterKindNames = map[string]ParameterKind{
+	"raw":         KindRaw,
+	"temperature": KindTemperature,
+	"percent":     KindPercent,
+	"hours":       KindHours,
+	"mode":        KindMode,
+	"boolean":     KindBoolean,
+	"integer":     KindInteger,
+}
+
+// ParameterProfile overrides parameter names and decodings for firmware
+// versions whose register map differs from the built-in one
+type ParameterProfile struct {
+	Name     string            `json:"name"`
+	Firmware []string          `json:"firmware"`        // version prefixes, e.g. "2.3." or an exact "2.3.36"; "*" matches any
+	Names    map[string]string `json:"names,omitempty"` // parameter ID -> name
+	Kinds    map[string]string `json:"kinds,omitempty"` // parameter ID -> kind name, see parameterKindNames
+}
+
+// LoadParameterProfiles reads a JSON array of profiles
+func LoadParameterProfiles(path string) ([]ParameterProfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var profiles []ParameterProfile
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, profile := range profiles {
+		if profile.Name == "" || len(profile.Firmware) == 0 {
+			return nil, fmt.Errorf("%s: every profile needs a name and firmware versions", path)
+		}
+		for id, kind := range profile.Kinds {
+			if _, ok := parameterKindNames[kind]; !ok {
+				return nil, fmt.Errorf("%s: profile %q: unknown kind %q for %s", path, profile.Name, kind, id)
+			}
+		}
+	}
+	return profiles, nil
+}
+
+// matches reports whether the profile applies to a firmware version
+func (p *ParameterProfile) matches(firmware string) bool {
+	for _, pattern := range p.Firmware {
+		if pattern == "*" || firmware == pattern || (strings.HasSuffix(pattern, ".") && strings.HasPrefix(firmware, pattern)) {
+			return true
+		}
+	}
+	return false
+}
+
+// SelectParameterProfile returns the first profile matching the firmware
+// version, nil (the built-in parameter map) without a match
+func SelectParameterProfile(profiles []ParameterProfile, firmware string) *ParameterProfile {
+	for i := range profiles {
+		if profiles[i].matches(firmware) {
+			profile := profiles[i]
+			return &profile
+		}
+	}
+	return nil
+}
+
+// GetParameterInfo returns the decoding metadata for a parameter ID under a
+// profile; a nil profile uses the built-in parameter map
+func GetParameterInfo(id string, profile *ParameterProfile) ParameterInfo {
+	kind, ok := parameterKinds[id]
+	if profile != nil {
+		if name, found := profile.Kinds[id]; found {
+			kind, ok = parameterKindNames[name], true
+		}
+	}
+	if !ok && (strings.HasPrefix(id, "D") || strings.HasPrefix(id, "C")) {
+		kind = KindBoolean
+	}
+	return ParameterInfo{
+		ID:   id,
+		Name: GetParameterName(id, profile),
+		Kind: kind,
+		Unit: kindUnits[kind],
+	}
+}
+
+// DecodedValue is a parameter value in engineering units next to its raw form
+type DecodedValue struct {
+	ID       string      `json:"id"`
+	Name     string      `json:"name"`
+	Value    interface{} `json:"value"`
+	Unit     string      `json:"unit,omitempty"`
+	RawValue string      `json:"raw_value"`
+}
+
+// DecodeParameter converts a raw value according to the parameter metadata
+// under a profile (nil for the built-in map). Values that do not parse for
+// their kind are returned raw.
+func DecodeParameter(id, raw string, profile *ParameterProfile) DecodedValue {
+	info := GetParameterInfo(id, profile)
+	decoded := DecodedValue{
+		ID:       id,
+		Name:     info.Name,
+		Value:    raw,
+		Unit:     info.Unit,
+		RawValue: raw,
+	}
+
+	if info.Kind == KindRaw {
+		return decoded
+	}
+
+	number, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		decoded.Unit = ""
+		return decoded
+	}
+
+	switch info.Kind {
+	case KindTemperature:
+		decoded.Value = decodeTemperature(number)
+	case KindPercent, KindHours, KindInteger:
+		decoded.Value = int(number)
+	case KindMode:
+		decoded.Value = VentilationMode(int(number)).String()
+	case KindBoolean:
+		decoded.Value = number != 0
+	}
+	return decoded
+}
+
+// Decode returns the decoded value of a parameter present in the snapshot,
+// following the profile of the unit it was read from
+func (d *DeviceData) Decode(id string) (DecodedValue, bool) {
+	raw, ok := d.Items[id]
+	if !ok {
+		return DecodedValue{}, false
+	}
+	return DecodeParameter(id, raw, d.profile), true
+}
+
+// decodedTemperature returns the first present temperature parameter among ids
+func (d *DeviceData) decodedTemperature(ids []string) (float64, bool) {
+	for _, id := range ids {
+		if value, ok := d.Decode(id); ok {
+			if celsius, ok := value.Value.(float64); ok {
+				return celsius, true
+			}
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// DefaultPollInterval is how often the server refreshes device data in the background
+const DefaultPollInterval = 30 * time.Second
+
+// Poller periodically fetches device data and keeps the latest snapshot
+type Poller struct {
+	interval time.Duration
+	fetch    func() (*DeviceData, error)
+
+	mutex       sync.RWMutex
+	latest      *DeviceData
+	latestAt    time.Time
+	lastErr     error
+	subscribers []func(*DeviceData)
+
+	stop    chan struct{}
+	done    chan struct{}
+	started bool
+}
+
+// NewPoller creates a poller that calls fetch every interval
+func NewPoller(interval time.Duration, fetch func() (*DeviceData, error)) *Poller {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	return &Poller{
+		interval: interval,
+		fetch:    fetch,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Subscribe registers a callback invoked with every successfully polled snapshot
+func (p *Poller) Subscribe(fn func(*DeviceData)) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.subscribers = append(p.subscribers, fn)
+}
+
+// Start launches the polling loop in the background
+func (p *Poller) Start() {
+	p.mutex.Lock()
+	if p.started {
+		p.mutex.Unlock()
+		return
+	}
+	p.started = true
+	p.mutex.Unlock()
+
+	go p.run()
+}
+
+// Stop terminates the polling loop and waits for an in-flight poll to
+// finish, or returns ctx.Err() when ctx ends first
+func (p *Poller) Stop(ctx context.Context) error {
+	p.mutex.Lock()
+	started := p.started
+	select {
+	case <-p.stop:
+	default:
+		close(p.stop)
+	}
+	p.mutex.Unlock()
+
+	if !started {
+		return nil
+	}
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		log.Printf("⚠ Shutdown deadline reached during a background poll, not waiting for it")
+		return ctx.Err()
+	}
+}
+
+// Latest returns the most recent snapshot, when it was taken and the last poll error
+func (p *Poller) Latest() (*DeviceData, time.Time, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.latest, p.latestAt, p.lastErr
+}
+
+func (p *Poller) run() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	p.poll()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.poll()
+		}
+	}
+}
+
+// poll fetches one snapshot and notifies subscribers
+func (p *Poller) poll() {
+	data, err := p.fetch()
+
+	p.mutex.Lock()
+	p.lastErr = err
+	if err == nil {
+		p.latest = data
+		p.latestAt = time.Now()
+	}
+	subscribers := append([]func(*DeviceData){}, p.subscribers...)
+	p.mutex.Unlock()
+
+	if err != nil {
+		log.Printf("✗ Background poll failed: %v", err)
+		return
+	}
+
+	for _, fn := range subscribers {
+		fn(data)
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Priority orders requests waiting for the device; higher runs first
+type Priority int
+
+// Request priorities
+const (
+	PriorityBackground Priority = -1 // background polls and alarm checks
+	PriorityRead       Priority = 0  // API reads (the default)
+	PriorityWrite      Priority = 1  // writes and system commands
+)
+
+// DefaultDeviceConcurrency is how many requests the RD5 web server gets at once
+const DefaultDeviceConcurrency = 1
+
+// QueueStats reports the state of the device request queue
+type QueueStats struct {
+	Concurrency int     `json:"concurrency"`
+	Depth       int     `json:"depth"`     // requests waiting for a slot
+	InFlight    int     `json:"in_flight"` // requests being sent
+	Served      uint64  `json:"served"`
+	Coalesced   uint64  `json:"coalesced"` // reads answered by an identical queued read
+	LastWaitMs  float64 `json:"last_wait_ms"`
+	AvgWaitMs   float64 `json:"avg_wait_ms"`
+	MaxWaitMs   float64 `json:"max_wait_ms"`
+}
+
+// queuedRequest is a request waiting for a slot
+type queuedRequest struct {
+	priority Priority
+	seq      uint64
+	ready    chan struct{}
+}
+
+// flight is a queued or running read that identical reads wait for
+type flight struct {
+	request *queuedRequest
+	done    chan struct{}
+	status  int
+	body    []byte
+	err     error
+}
+
+// DeviceQueue serialises requests to one device
+// The RD5's embedded web server drops connections under concurrent load, so
+// every request of a client and its WithCaller copies passes through one
+// queue that runs at most concurrency requests at a time, highest priority
+// first and FIFO within a priority.
+type DeviceQueue struct {
+	concurrency int
+
+	mutex     sync.Mutex
+	running   int
+	waiting   []*queuedRequest
+	seq       uint64
+	flights   map[string]*flight
+	served    uint64
+	coalesced uint64
+	lastWait  time.Duration
+	totalWait time.Duration
+	maxWait   time.Duration
+}
+
+// NewDeviceQueue creates a queue running at most concurrency requests at once
+func NewDeviceQueue(concurrency int) *DeviceQueue {
+	if concurrency < 1 {
+		concurrency = DefaultDeviceConcurrency
+	}
+	return &DeviceQueue{
+		concurrency: concurrency,
+		flights:     make(map[string]*flight),
+	}
+}
+
+// Do runs fn once a slot is free
+// A call with a non-empty key joins an identical read that is waiting or
+// running; a higher-priority caller moves a waiting one up the queue. A call
+// without a key is a write: once it is done, reads from before it are no
+// longer joined, so the read-back of a verified write sees the written value.
+func (q *DeviceQueue) Do(priority Priority, key string, fn func() (int, []byte, error)) (int, []byte, error) {
+	q.mutex.Lock()
+	if f, ok := q.flights[key]; ok && key != "" {
+		q.coalesced++
+		if f.request.priority < priority {
+			f.request.priority = priority
+		}
+		q.mutex.Unlock()
+		<-f.done
+		return f.status, f.body, f.err
+	}
+
+	var f *flight
+	if key != "" {
+		f = &flight{done: make(chan struct{})}
+		q.flights[key] = f
+	}
+	request := q.enqueueLocked(priority)
+	if f != nil {
+		f.request = request
+	}
+	q.mutex.Unlock()
+
+	start := time.Now()
+	<-request.ready
+	q.started(time.Since(start))
+
+	status, body, err := fn()
+
+	q.mutex.Lock()
+	if f != nil {
+		f.status, f.body, f.err = status, body, err
+		if q.flights[key] == f {
+			delete(q.flights, key)
+		}
+		close(f.done)
+	} else {
+		// Reads queued or running until now may predate the write
+		clear(q.flights)
+	}
+	q.running--
+	q.dispatchLocked()
+	q.mutex.Unlock()
+	return status, body, err
+}
+
+// enqueueLocked adds a request and starts it if a slot is free; the caller holds q.mutex
+func (q *DeviceQueue) enqueueLocked(priority Priority) *queuedRequest {
+	q.seq++
+	request := &queuedRequest{priority: priority, seq: q.seq, ready: make(chan struct{})}
+	q.waiting = append(q.waiting, request)
+	q.dispatchLocked()
+	return request
+}
+
+// dispatchLocked hands free slots to the most urgent waiting requests; the caller holds q.mutex
+func (q *DeviceQueue) dispatchLocked() {
+	for q.running < q.concurrency && len(q.waiting) > 0 {
+		next := 0
+		for i, request := range q.waiting {
+			best := q.waiting[next]
+			if request.priority > best.priority || (request.priority == best.priority && request.seq < best.seq) {
+				next = i
+			}
+		}
+		request := q.waiting[next]
+		q.waiting = append(q.waiting[:next], q.waiting[next+1:]...)
+		q.running++
+		close(request.ready)
+	}
+}
+
+// started records the wait of a request that got a slot
+func (q *DeviceQueue) started(wait time.Duration) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.served++
+	q.lastWait = wait
+	q.totalWait += wait
+	if wait > q.maxWait {
+		q.maxWait = wait
+	}
+}
+
+// Stats returns the current queue metrics
+func (q *DeviceQueue) Stats() QueueStats {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	stats := QueueStats{
+		Concurrency: q.concurrency,
+		Depth:       len(q.waiting),
+		InFlight:    q.running,
+		Served:      q.served,
+		Coalesced:   q.coalesced,
+		LastWaitMs:  milliseconds(q.lastWait),
+		MaxWaitMs:   milliseconds(q.maxWait),
+	}
+	if q.served > 0 {
+		stats.AvgWaitMs = milliseconds(q.totalWait / time.Duration(q.served))
+	}
+	return stats
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// coalesceKey identifies identical reads: the URL without the random nonce
+func coalesceKey(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	query := u.Query()
+	query.Del("rnd")
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// SetQueue makes the client send its requests through queue
+func (wc *WebClient) SetQueue(queue *DeviceQueue) {
+	wc.queue = queue
+}
+
+// WithPriority returns a copy of the client whose reads are queued at priority
+// Writes always use PriorityWrite.
+func (wc *WebClient) WithPriority(priority Priority) *WebClient {
+	clone := *wc
+	clone.priority = priority
+	return &clone
+}
+
+// QueueStats returns the request queue metrics, or nil without a queue
+func (wc *WebClient) QueueStats() *QueueStats {
+	if wc.queue == nil {
+		return nil
+	}
+	stats := wc.queue.Stats()
+	return &stats
+}
+
+// enqueue sends one request through the queue, if the client has one
+func (wc *WebClient) enqueue(rawURL string, idempotent bool) (int, []byte, error) {
+	if wc.queue == nil {
+		return wc.send(rawURL)
+	}
+	if !idempotent {
+		return wc.queue.Do(PriorityWrite, "", func() (int, []byte, error) { return wc.send(rawURL) })
+	}
+	return wc.queue.Do(wc.priority, coalesceKey(rawURL), func() (int, []byte, error) { return wc.send(rawURL) })
+}
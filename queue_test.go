@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockQueue occupies the only slot of q until the returned function is called
+func blockQueue(t *testing.T, q *DeviceQueue) func() {
+	t.Helper()
+	release := make(chan struct{})
+	started := make(chan struct{})
+	go q.Do(PriorityWrite, "", func() (int, []byte, error) {
+		close(started)
+		<-release
+		return http.StatusOK, nil, nil
+	})
+	<-started
+	return func() { close(release) }
+}
+
+// waitForDepth waits until depth requests are queued
+func waitForDepth(t *testing.T, q *DeviceQueue, depth int) {
+	t.Helper()
+	waitFor(t, func() bool { return q.Stats().Depth == depth })
+}
+
+// TestDeviceQueuePriority tests that writes run before reads and reads before polls
+func TestDeviceQueuePriority(t *testing.T) {
+	q := NewDeviceQueue(1)
+	release := blockQueue(t, q)
+
+	var mutex sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	enqueue := func(name string, priority Priority, key string) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.Do(priority, key, func() (int, []byte, error) {
+				mutex.Lock()
+				order = append(order, name)
+				mutex.Unlock()
+				return http.StatusOK, nil, nil
+			})
+		}()
+	}
+
+	enqueue("poll", PriorityBackground, "xml.xml")
+	waitForDepth(t, q, 1)
+	enqueue("alarms", PriorityRead, "alarms.xml")
+	waitForDepth(t, q, 2)
+	enqueue("write", PriorityWrite, "")
+	waitForDepth(t, q, 3)
+	// An API read joining the queued poll moves it ahead of the alarms read
+	enqueue("status", PriorityRead, "xml.xml")
+	waitFor(t, func() bool { return q.Stats().Coalesced == 1 })
+
+	release()
+	wg.Wait()
+
+	if got := fmt.Sprint(order); got != "[write poll alarms]" {
+		t.Errorf("got order %s, want [write poll alarms]", got)
+	}
+}
+
+// TestDeviceQueueCoalescing tests that identical overlapping reads share one request
+func TestDeviceQueueCoalescing(t *testing.T) {
+	q := NewDeviceQueue(1)
+	release := blockQueue(t, q)
+
+	var calls int32
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, body, err := q.Do(PriorityRead, "xml.xml", func() (int, []byte, error) {
+				atomic.AddInt32(&calls, 1)
+				return http.StatusOK, []byte("<root/>"), nil
+			})
+			if err != nil || string(body) != "<root/>" {
+				t.Errorf("got %q, %v", body, err)
+			}
+		}()
+	}
+	waitFor(t, func() bool { return q.Stats().Coalesced == 4 })
+	release()
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("got %d device calls, want 1", calls)
+	}
+	stats := q.Stats()
+	if stats.Served != 2 || stats.Depth != 0 || stats.InFlight != 0 {
+		t.Errorf("got %+v, want 2 served and an empty queue", stats)
+	}
+}
+
+// TestDeviceQueueRunningReadJoined tests that a read shares a running identical read until a write is queued
+func TestDeviceQueueRunningReadJoined(t *testing.T) {
+	q := NewDeviceQueue(3)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	go q.Do(PriorityBackground, "xml.xml", func() (int, []byte, error) {
+		close(started)
+		<-release
+		return http.StatusOK, []byte("before write"), nil
+	})
+	<-started
+
+	joined := make(chan string)
+	go func() {
+		_, body, _ := q.Do(PriorityRead, "xml.xml", func() (int, []byte, error) {
+			return http.StatusOK, []byte("second request"), nil
+		})
+		joined <- string(body)
+	}()
+	waitFor(t, func() bool { return q.Stats().Coalesced == 1 })
+
+	// A read-back after a write must get a fresh request
+	q.Do(PriorityWrite, "", func() (int, []byte, error) { return http.StatusOK, nil, nil })
+	_, body, _ := q.Do(PriorityRead, "xml.xml", func() (int, []byte, error) {
+		return http.StatusOK, []byte("after write"), nil
+	})
+	close(release)
+
+	if got := <-joined; got != "before write" {
+		t.Errorf("joined read: got %q, want the running read's body", got)
+	}
+	if string(body) != "after write" {
+		t.Errorf("read-back: got %q, want the body of a new request", body)
+	}
+	if stats := q.Stats(); stats.Coalesced != 1 {
+		t.Errorf("got %d coalesced, want 1", stats.Coalesced)
+	}
+}
+
+// TestWebClientQueueSerialises tests that concurrent client calls never overlap at the device
+func TestWebClientQueueSerialises(t *testing.T) {
+	var active, maxActive int32
+	device := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&active, 1)
+		defer atomic.AddInt32(&active, -1)
+		for {
+			max := atomic.LoadInt32(&maxActive)
+			if n <= max || atomic.CompareAndSwapInt32(&maxActive, max, n) {
+				break
+			}
+		}
+		time.Sleep(2 * time.Millisecond)
+		fmt.Fprint(w, `<?xml version="1.0"?><root></root>`)
+	}))
+	defer device.Close()
+
+	client := NewWebClient(device.Listener.Addr().String())
+	client.baseURL = device.URL
+	client.SetSessionID("12345")
+	client.SetQueue(NewDeviceQueue(1))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(3)
+		go func() { defer wg.Done(); client.GetData() }()
+		go func() { defer wg.Done(); client.WithPriority(PriorityBackground).GetAlarms() }()
+		go func(i int) { defer wg.Done(); client.SetValue(FormatParam("H10714", i)) }(i)
+	}
+	wg.Wait()
+
+	if maxActive != 1 {
+		t.Errorf("got %d concurrent device requests, want 1", maxActive)
+	}
+	if stats := client.QueueStats(); stats.Served == 0 || stats.Served+stats.Coalesced != 30 {
+		t.Errorf("got %+v, want 30 requests served or coalesced", stats)
+	}
+}
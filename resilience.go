@@ -0,0 +1,265 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RetryPolicy controls how idempotent device reads are retried
+// Writes to xml.cgi, ip.cgi and the schedule endpoints are never retried: a
+// timed-out request may still have reached the unit, and repeating a command
+// such as C10005 (reset) must be a deliberate decision.
+type RetryPolicy struct {
+	Attempts  int           // total attempts including the first; 1 disables retries
+	BaseDelay time.Duration // wait before the first retry, doubled for each further one
+	MaxDelay  time.Duration // upper bound of the wait
+	Jitter    float64       // fraction of the wait that is randomised (0-1)
+}
+
+// DefaultRetryPolicy rides out short Wi-Fi drops without delaying a request for long
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:  3,
+	BaseDelay: 500 * time.Millisecond,
+	MaxDelay:  5 * time.Second,
+	Jitter:    0.2,
+}
+
+// delay returns the wait before retry n (1 for the first retry)
+func (p RetryPolicy) delay(n int) time.Duration {
+	d := p.BaseDelay << (n - 1)
+	if d > p.MaxDelay || d <= 0 {
+		d = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		spread := float64(d) * p.Jitter
+		d += time.Duration(spread * (2*rand.Float64() - 1))
+	}
+	return d
+}
+
+// Circuit breaker states
+const (
+	BreakerClosed   = "closed"    // requests go to the device
+	BreakerOpen     = "open"      // requests fail immediately
+	BreakerHalfOpen = "half_open" // one probe request decides whether to close
+)
+
+// Default circuit breaker settings
+const (
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = 30 * time.Second
+)
+
+// ErrDeviceOffline is matched by errors returned while the circuit breaker is open
+var ErrDeviceOffline = errors.New("device offline")
+
+// DeviceOfflineError is returned without contacting the device while the breaker is open
+type DeviceOfflineError struct {
+	Since   time.Time // first failure of the current outage
+	RetryAt time.Time // when the next probe is allowed
+	LastErr error
+}
+
+func (e *DeviceOfflineError) Error() string {
+	return fmt.Sprintf("device offline since %s (last error: %v)", e.Since.Format(time.RFC3339), e.LastErr)
+}
+
+// Is makes errors.Is match both ErrDeviceOffline and ErrDeviceUnreachable
+func (e *DeviceOfflineError) Is(target error) bool {
+	return target == ErrDeviceOffline || target == ErrDeviceUnreachable
+}
+
+// BreakerStatus is the circuit breaker state reported by /health
+type BreakerStatus struct {
+	State        string     `json:"state"`
+	Failures     int        `json:"consecutive_failures"`
+	OfflineSince *time.Time `json:"offline_since,omitempty"`
+	RetryAt      *time.Time `json:"retry_at,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+}
+
+// CircuitBreaker stops sending requests to a device that keeps failing
+// After threshold consecutive failures it opens for cooldown; the first
+// request after that is a probe that closes it again on success.
+type CircuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mutex        sync.Mutex
+	state        string
+	failures     int
+	offlineSince time.Time
+	openedAt     time.Time
+	lastErr      error
+}
+
+// NewCircuitBreaker creates a closed breaker
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	if threshold < 1 {
+		threshold = DefaultBreakerThreshold
+	}
+	if cooldown <= 0 {
+		cooldown = DefaultBreakerCooldown
+	}
+	return &CircuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+		state:     BreakerClosed,
+	}
+}
+
+// Allow reports whether a request may be sent, returning a
+// *DeviceOfflineError while the breaker is open or a probe is in flight
+func (cb *CircuitBreaker) Allow() error {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	switch cb.state {
+	case BreakerOpen:
+		if cb.now().Sub(cb.openedAt) >= cb.cooldown {
+			cb.state = BreakerHalfOpen
+			return nil
+		}
+	case BreakerClosed:
+		return nil
+	}
+	return &DeviceOfflineError{Since: cb.offlineSince, RetryAt: cb.openedAt.Add(cb.cooldown), LastErr: cb.lastErr}
+}
+
+// Success records a request the device answered
+func (cb *CircuitBreaker) Success() {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	if cb.state != BreakerClosed {
+		log.Printf("✓ Device back online after %s", cb.now().Sub(cb.offlineSince).Round(time.Second))
+	}
+	cb.state = BreakerClosed
+	cb.failures = 0
+	cb.offlineSince = time.Time{}
+	cb.lastErr = nil
+}
+
+// Failure records a request the device did not answer
+func (cb *CircuitBreaker) Failure(err error) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	if cb.failures == 0 {
+		cb.offlineSince = cb.now()
+	}
+	cb.failures++
+	cb.lastErr = err
+
+	if cb.state == BreakerHalfOpen || (cb.state == BreakerClosed && cb.failures >= cb.threshold) {
+		if cb.state == BreakerClosed {
+			log.Printf("⚠ Device unreachable after %d failures, pausing requests for %s: %v", cb.failures, cb.cooldown, err)
+		}
+		cb.state = BreakerOpen
+		cb.openedAt = cb.now()
+	}
+}
+
+// Status returns the current state
+func (cb *CircuitBreaker) Status() BreakerStatus {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	status := BreakerStatus{State: cb.state, Failures: cb.failures}
+	if !cb.offlineSince.IsZero() {
+		since := cb.offlineSince
+		status.OfflineSince = &since
+	}
+	if cb.state == BreakerOpen {
+		retryAt := cb.openedAt.Add(cb.cooldown)
+		status.RetryAt = &retryAt
+	}
+	if cb.lastErr != nil {
+		status.LastError = cb.lastErr.Error()
+	}
+	return status
+}
+
+// SetRetryPolicy makes the client retry idempotent reads
+func (wc *WebClient) SetRetryPolicy(policy RetryPolicy) {
+	wc.retry = policy
+}
+
+// SetCircuitBreaker makes the client fail fast while the device is unreachable
+func (wc *WebClient) SetCircuitBreaker(breaker *CircuitBreaker) {
+	wc.breaker = breaker
+}
+
+// DeviceStatus returns the circuit breaker state, or nil without a breaker
+func (wc *WebClient) DeviceStatus() *BreakerStatus {
+	if wc.breaker == nil {
+		return nil
+	}
+	status := wc.breaker.Status()
+	return &status
+}
+
+// get sends a GET to the device and returns the status code and body
+// Transport errors and 5xx answers (ErrDeviceUnreachable) count as device
+// failures; idempotent requests are retried on them according to the retry
+// policy, and the breaker records one failure once all attempts are used up.
+func (wc *WebClient) get(rawURL string, idempotent bool) (int, []byte, error) {
+	attempts := 1
+	if idempotent && wc.retry.Attempts > 1 {
+		attempts = wc.retry.Attempts
+	}
+
+	if wc.breaker != nil {
+		if offline := wc.breaker.Allow(); offline != nil {
+			return 0, nil, offline
+		}
+	}
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(wc.retry.delay(attempt - 1))
+		}
+
+		var status int
+		var body []byte
+		status, body, err = wc.enqueue(rawURL, idempotent)
+		if !errors.Is(err, ErrDeviceUnreachable) {
+			if wc.breaker != nil {
+				wc.breaker.Success()
+			}
+			return status, body, err
+		}
+	}
+	if wc.breaker != nil {
+		wc.breaker.Failure(err)
+	}
+	return 0, nil, err
+}
+
+// send performs a single request
+func (wc *WebClient) send(rawURL string) (int, []byte, error) {
+	resp, err := wc.httpClient.Get(rawURL)
+	if err != nil {
+		return 0, nil, fmt.Errorf("%w: %w", ErrDeviceUnreachable, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, fmt.Errorf("%w: %w", ErrDeviceUnreachable, err)
+	}
+	switch {
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return 0, nil, fmt.Errorf("%w: device returned status %d", ErrDeviceUnreachable, resp.StatusCode)
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return 0, nil, fmt.Errorf("%w: device returned status %d", ErrSessionExpired, resp.StatusCode)
+	}
+	return resp.StatusCode, body, nil
+}
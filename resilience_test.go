@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyDevice answers 503 to the first failures requests and counts every request
+type flakyDevice struct {
+	failures int32
+	requests int32
+}
+
+func (d *flakyDevice) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if atomic.AddInt32(&d.requests, 1) <= atomic.LoadInt32(&d.failures) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprint(w, `<?xml version="1.0"?><root></root>`)
+}
+
+// newResilientClient creates a client with fast retries talking to device
+func newResilientClient(t *testing.T, device http.Handler, breaker *CircuitBreaker) *WebClient {
+	t.Helper()
+	server := httptest.NewServer(device)
+	t.Cleanup(server.Close)
+
+	client := NewWebClient(server.Listener.Addr().String())
+	client.baseURL = server.URL
+	client.SetSessionID("12345")
+	client.SetRetryPolicy(RetryPolicy{Attempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond, Jitter: 0.2})
+	client.SetCircuitBreaker(breaker)
+	return client
+}
+
+// TestRetryIdempotentReads tests that reads ride out transient failures
+func TestRetryIdempotentReads(t *testing.T) {
+	device := &flakyDevice{failures: 2}
+	client := newResilientClient(t, device, NewCircuitBreaker(5, time.Minute))
+
+	if _, err := client.GetData(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if device.requests != 3 {
+		t.Errorf("got %d requests, want 3", device.requests)
+	}
+	if status := client.DeviceStatus(); status.State != BreakerClosed || status.Failures != 0 {
+		t.Errorf("got %+v, want closed breaker without failures", status)
+	}
+}
+
+// TestNoRetryForCommands tests that writes are sent exactly once
+func TestNoRetryForCommands(t *testing.T) {
+	device := &flakyDevice{failures: 1}
+	client := newResilientClient(t, device, nil)
+
+	if err := NewSystemControl(client).Reset(); err == nil {
+		t.Fatal("expected error for failed write")
+	}
+	if device.requests != 1 {
+		t.Errorf("got %d requests, want 1", device.requests)
+	}
+}
+
+// TestCircuitBreakerOpensAndRecovers tests fail-fast while offline and the half-open probe
+func TestCircuitBreakerOpensAndRecovers(t *testing.T) {
+	device := &flakyDevice{failures: 6}
+	breaker := NewCircuitBreaker(2, time.Minute)
+	now := time.Date(2025, 11, 17, 12, 0, 0, 0, time.UTC)
+	breaker.now = func() time.Time { return now }
+	client := newResilientClient(t, device, breaker)
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.GetData(); err == nil || errors.Is(err, ErrDeviceOffline) {
+			t.Fatalf("read %d: got %v, want device error", i, err)
+		}
+	}
+	if device.requests != 6 {
+		t.Fatalf("got %d requests, want 6", device.requests)
+	}
+
+	// Open: fail fast without contacting the device
+	_, err := client.GetData()
+	var offline *DeviceOfflineError
+	if !errors.As(err, &offline) || !errors.Is(err, ErrDeviceOffline) {
+		t.Fatalf("got %v, want DeviceOfflineError", err)
+	}
+	if !offline.Since.Equal(now) {
+		t.Errorf("offline since %s, want %s", offline.Since, now)
+	}
+	if device.requests != 6 {
+		t.Errorf("device contacted while breaker open (%d requests)", device.requests)
+	}
+	if status := client.DeviceStatus(); status.State != BreakerOpen || status.RetryAt == nil {
+		t.Errorf("got %+v, want open breaker with retry time", status)
+	}
+
+	// After the cooldown a probe goes through and closes the breaker
+	now = now.Add(time.Minute)
+	if _, err := client.GetData(); err != nil {
+		t.Fatalf("probe failed: %v", err)
+	}
+	if status := client.DeviceStatus(); status.State != BreakerClosed || status.OfflineSince != nil {
+		t.Errorf("got %+v, want closed breaker", status)
+	}
+}
+
+// TestRetryPolicyDelay tests exponential growth, the cap and the jitter bounds
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{Attempts: 5, BaseDelay: 100 * time.Millisecond, MaxDelay: 300 * time.Millisecond, Jitter: 0.2}
+	for n, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 300 * time.Millisecond, 4: 300 * time.Millisecond} {
+		for i := 0; i < 20; i++ {
+			d := policy.delay(n)
+			if d < want*8/10 || d > want*12/10 {
+				t.Errorf("retry %d: got %s, want %s ±20%%", n, d, want)
+			}
+		}
+	}
+}
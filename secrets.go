@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Secret holds a sensitive value (device password or login magic)
+// It never prints or marshals its content; use Reveal to get the value.
+type Secret string
+
+const redacted = "[REDACTED]"
+
+// String implements fmt.Stringer without exposing the value
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+// GoString implements fmt.GoStringer so %#v does not leak the value either
+func (s Secret) GoString() string {
+	return s.String()
+}
+
+// MarshalJSON keeps secrets out of JSON responses and logs
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + s.String() + `"`), nil
+}
+
+// Reveal returns the cleartext value
+func (s Secret) Reveal() string {
+	return string(s)
+}
+
+// systemd credential names looked up in $CREDENTIALS_DIRECTORY
+const (
+	credentialPassword = "device_password"
+	credentialMagic    = "device_magic"
+)
+
+// PasswordMagic returns the login magic for a device password:
+// the hex MD5 of the literal string "\r\n" + password
+func PasswordMagic(password string) string {
+	hash := md5.New()
+	io.WriteString(hash, "\r\n"+password)
+	return fmt.Sprintf("%x", hash.Sum(nil))
+}
+
+// validMagic reports whether s looks like a hex MD5 digest
+func validMagic(s string) bool {
+	if len(s) != md5.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// readSecretFile reads a secret from a file, trimming the trailing newline
+func readSecretFile(path string) (Secret, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	value := strings.TrimRight(string(data), "\r\n")
+	if value == "" {
+		return "", fmt.Errorf("secret file %s is empty", path)
+	}
+	return Secret(value), nil
+}
+
+// readCredential reads a systemd credential (LoadCredential=) if present
+func readCredential(name string) (Secret, bool, error) {
+	dir := os.Getenv("CREDENTIALS_DIRECTORY")
+	if dir == "" {
+		return "", false, nil
+	}
+	secret, err := readSecretFile(filepath.Join(dir, name))
+	if os.IsNotExist(err) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return secret, true, nil
+}
+
+// resolveSecrets fills DevicePassword/DeviceMagic from files and systemd credentials
+// Explicit values win over files, and files win over credentials.
+func (c *Config) resolveSecrets() error {
+	if c.DevicePassword == "" && c.DevicePasswordFile != "" {
+		secret, err := readSecretFile(c.DevicePasswordFile)
+		if err != nil {
+			return fmt.Errorf("DEVICE_PASSWORD_FILE: %w", err)
+		}
+		c.DevicePassword = secret
+	}
+	if c.DeviceMagic == "" && c.DeviceMagicFile != "" {
+		secret, err := readSecretFile(c.DeviceMagicFile)
+		if err != nil {
+			return fmt.Errorf("DEVICE_MAGIC_FILE: %w", err)
+		}
+		c.DeviceMagic = secret
+	}
+
+	if c.DevicePassword == "" && c.DeviceMagic == "" {
+		if secret, ok, err := readCredential(credentialMagic); err != nil {
+			return fmt.Errorf("credential %s: %w", credentialMagic, err)
+		} else if ok {
+			c.DeviceMagic = secret
+		}
+	}
+	if c.DevicePassword == "" && c.DeviceMagic == "" {
+		if secret, ok, err := readCredential(credentialPassword); err != nil {
+			return fmt.Errorf("credential %s: %w", credentialPassword, err)
+		} else if ok {
+			c.DevicePassword = secret
+		}
+	}
+
+	c.DeviceMagic = Secret(strings.ToLower(c.DeviceMagic.Reveal()))
+	return nil
+}
+
+// LoginMagic returns the magic used to log in, preferring the pre-hashed value
+func (c *Config) LoginMagic() Secret {
+	if c.DeviceMagic != "" {
+		return c.DeviceMagic
+	}
+	if c.DevicePassword != "" {
+		return Secret(PasswordMagic(c.DevicePassword.Reveal()))
+	}
+	return ""
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestPasswordMagic tests the documented login magic for password 6378
+func TestPasswordMagic(t *testing.T) {
+	if got := PasswordMagic("6378"); got != "993278d1925c378ab94a6fe664ea6c60" {
+		t.Errorf("got magic %s, want 993278d1925c378ab94a6fe664ea6c60", got)
+	}
+}
+
+// TestSecretRedaction tests that secrets never appear in formatted output or JSON
+func TestSecretRedaction(t *testing.T) {
+	secret := Secret("6378")
+
+	outputs := []string{
+		fmt.Sprintf("%s", secret),
+		fmt.Sprintf("%v", secret),
+		fmt.Sprintf("%#v", secret),
+		fmt.Sprintf("%+v", struct{ Password Secret }{secret}),
+	}
+	data, _ := json.Marshal(map[string]Secret{"password": secret})
+	outputs = append(outputs, string(data))
+
+	for _, out := range outputs {
+		if strings.Contains(out, "6378") {
+			t.Errorf("secret leaked in %q", out)
+		}
+	}
+
+	if secret.Reveal() != "6378" {
+		t.Errorf("Reveal: got %q, want 6378", secret.Reveal())
+	}
+}
+
+// TestLoadConfigSecretSources tests password files, magic and systemd credentials
+func TestLoadConfigSecretSources(t *testing.T) {
+	dir := t.TempDir()
+	passwordFile := filepath.Join(dir, "password")
+	os.WriteFile(passwordFile, []byte("6378\n"), 0600)
+
+	credDir := filepath.Join(dir, "creds")
+	os.Mkdir(credDir, 0700)
+	os.WriteFile(filepath.Join(credDir, credentialMagic), []byte("993278D1925C378AB94A6FE664EA6C60\n"), 0600)
+
+	tests := []struct {
+		name    string
+		args    []string
+		credDir string
+		want    Secret
+	}{
+		{"password file", []string{"--device-password-file", passwordFile}, "", "993278d1925c378ab94a6fe664ea6c60"},
+		{"magic", []string{"--device-magic", "993278d1925c378ab94a6fe664ea6c60"}, "", "993278d1925c378ab94a6fe664ea6c60"},
+		{"systemd credential", nil, credDir, "993278d1925c378ab94a6fe664ea6c60"},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("CREDENTIALS_DIRECTORY", tt.credDir)
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		cfg, err := LoadConfig(fs, append([]string{"--config", writeConfigFile(t, "")}, tt.args...))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if cfg.LoginMagic() != tt.want {
+			t.Errorf("%s: got magic %q, want %q", tt.name, cfg.LoginMagic().Reveal(), tt.want.Reveal())
+		}
+	}
+}
+
+// TestLoadConfigInvalidMagic tests that a malformed magic is rejected
+func TestLoadConfigInvalidMagic(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	_, err := LoadConfig(fs, []string{"--config", writeConfigFile(t, "DEVICE_MAGIC=6378\n")})
+	if err == nil || !strings.Contains(err.Error(), "DEVICE_MAGIC") {
+		t.Errorf("expected DEVICE_MAGIC error, got %v", err)
+	}
+	if err != nil && strings.Contains(err.Error(), "6378") {
+		t.Errorf("error message leaks the secret: %v", err)
+	}
+}
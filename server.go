@@ -1,10 +1,16 @@
 package main
 
 import (
+	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -17,17 +23,26 @@ type APIResponse struct {
 	Message string      `json:"message,omitempty"`
 	Data    interface{} `json:"data,omitempty"`
 	Error   string      `json:"error,omitempty"`
+	Code    string      `json:"code,omitempty"` // machine-readable error code, see errors.go
+}
+
+type HealthResponse struct {
+	Status string         `json:"status"`
+	Time   string         `json:"time"`
+	Device *BreakerStatus `json:"device,omitempty"` // circuit breaker state
+	Queue  *QueueStats    `json:"queue,omitempty"`  // device request queue metrics
 }
 
 type StatusResponse struct {
-	Device          string    `json:"device"`
-	IP              string    `json:"ip"`
-	IsAuthenticated bool      `json:"is_authenticated"`
-	SessionID       string    `json:"session_id,omitempty"`
-	ParameterCount  int       `json:"parameter_count"`
-	LastUpdate      time.Time `json:"last_update"`
-	IndoorTemp      float64   `json:"indoor_temp_celsius"`
-	OutdoorTemp     float64   `json:"outdoor_temp_celsius"`
+	Device          string       `json:"device"`
+	IP              string       `json:"ip"`
+	IsAuthenticated bool         `json:"is_authenticated"`
+	SessionID       string       `json:"session_id,omitempty"`
+	ParameterCount  int          `json:"parameter_count"`
+	LastUpdate      time.Time    `json:"last_update"`
+	IndoorTemp      float64      `json:"indoor_temp_celsius"`
+	OutdoorTemp     float64      `json:"outdoor_temp_celsius"`
+	Clock           *ClockStatus `json:"clock,omitempty"`
 }
 
 type TemperatureResponse struct {
@@ -36,6 +51,11 @@ type TemperatureResponse struct {
 	Timestamp time.Time `json:"timestamp"`
 }
 
+type AlarmsResponse struct {
+	Active []int        `json:"active"` // codes raised and not yet cleared
+	Events []AlarmEvent `json:"events"` // alarm log in device order
+}
+
 type ParameterResponse struct {
 	ID    string `json:"id"`
 	Name  string `json:"name"`
@@ -47,6 +67,38 @@ type ParametersResponse struct {
 	Parameters []ParameterResponse `json:"parameters"`
 }
 
+type DecodedParametersResponse struct {
+	Count      int            `json:"count"`
+	Parameters []DecodedValue `json:"parameters"`
+}
+
+type VentilationResponse struct {
+	Mode      VentilationMode `json:"mode"`
+	ModeID    int             `json:"mode_id"`
+	Power     int             `json:"power_percent"`
+	Timestamp time.Time       `json:"timestamp"`
+}
+
+type ModeRequest struct {
+	Mode VentilationMode `json:"mode"`
+}
+
+type PowerRequest struct {
+	Power *int `json:"power"`
+}
+
+type SetpointResponse struct {
+	Setpoint   float64 `json:"setpoint_celsius"`
+	RawValue   string  `json:"raw_value"`
+	Min        float64 `json:"min_celsius"`
+	Max        float64 `json:"max_celsius"`
+	Resolution float64 `json:"resolution_celsius"`
+}
+
+type SetpointRequest struct {
+	Celsius *float64 `json:"celsius"`
+}
+
 type ErrorResponse struct {
 	Error   string `json:"error"`
 	Message string `json:"message"`
@@ -55,23 +107,193 @@ type ErrorResponse struct {
 // Server state
 type Server struct {
 	deviceIP       string
-	devicePassword string
+	devicePassword Secret
+	deviceMagic    Secret
 	client         *WebClient
+	config         *Config
+	verifyOptions  VerifyOptions
+	maintenance    *MaintenanceTracker
+	notifier       *Notifier
+	automation     *Automation
+	overrides      *OverrideManager
+	audit          *AuditLog
+	guard          *CommandGuard
+	serviceMode    *ServiceModeSwitch
+	clock          *ClockSync
+	events         *EventHub
+	history        *History
+	influx         *InfluxExporter
+	profiles       []ParameterProfile
+	info           *DeviceInfo // last identification, see identify
 	mutex          sync.RWMutex
+	closed         bool // Shutdown was called; a later Serve returns at once
+	httpServer     *http.Server
+	poller         *Poller
+
+	alarmsMutex sync.Mutex
+	alarmsData  *DeviceData // snapshot the cached alarm list was read for, see polledAlarms
+	alarmsList  *AlarmData
+	alarmsErr   error
 }
 
-// NewServer creates a new HTTP server
+// NewServer creates a new HTTP server with default settings
 func NewServer(ip string, password string) *Server {
-	return &Server{
-		deviceIP:       ip,
-		devicePassword: password,
-		client:         NewWebClient(ip),
+	cfg := DefaultConfig()
+	cfg.DeviceIP = ip
+	cfg.DevicePassword = Secret(password)
+	return NewServerWithConfig(cfg)
+}
+
+// NewServerWithConfig creates a new HTTP server from a loaded configuration
+func NewServerWithConfig(cfg *Config) *Server {
+	client := NewWebClient(cfg.DeviceIP)
+	client.httpClient.Timeout = cfg.DeviceTimeout
+	client.SetRetryPolicy(cfg.RetryPolicy())
+	client.SetCircuitBreaker(NewCircuitBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown))
+	client.SetQueue(NewDeviceQueue(cfg.DeviceConcurrency))
+	switch {
+	case cfg.DeviceReplay != "":
+		interactions, err := LoadCassette(cfg.DeviceReplay)
+		if err != nil {
+			log.Printf("✗ Device replay disabled: %v", err)
+		} else {
+			client.SetTransport(NewReplayTransport(interactions))
+			log.Printf("⚠ Replaying %d device interactions from %s, the unit is not contacted", len(interactions), cfg.DeviceReplay)
+		}
+	case cfg.DeviceRecord != "":
+		recorder, err := NewRecordingTransport(cfg.DeviceRecord, nil)
+		if err != nil {
+			log.Printf("✗ Device recording disabled: %v", err)
+		} else {
+			client.SetTransport(recorder)
+			log.Printf("🔧 Recording device traffic to %s", cfg.DeviceRecord)
+		}
+	}
+	audit := NewAuditLog(filepath.Join(cfg.StateDir, "audit.jsonl"), int64(cfg.AuditMaxSizeMB)<<20, cfg.AuditMaxFiles)
+	client.SetAuditLog(audit)
+
+	maintenance, err := NewMaintenanceTracker(cfg, client)
+	if err != nil {
+		log.Printf("✗ Filter maintenance tracking disabled: %v", err)
+	}
+
+	var notifier *Notifier
+	if cfg.NotifyConfigFile != "" {
+		notifyConfig, err := LoadNotifierConfig(cfg.NotifyConfigFile)
+		if err != nil {
+			log.Printf("✗ Notifications disabled: %v", err)
+		} else {
+			notifier = NewNotifier(*notifyConfig, cfg.DeviceIP)
+		}
+	}
+
+	if maintenance != nil && notifier != nil {
+		maintenance.OnThreshold = func(status MaintenanceStatus) {
+			notifier.Send(Notification{
+				Event:   "filter_change_due",
+				Message: fmt.Sprintf("Filter change due in %dh", status.RemainingHours),
+				Details: status,
+			})
+		}
+	}
+
+	overrides, err := NewOverrideManager(cfg, client)
+	if err != nil {
+		log.Printf("✗ Temporary overrides disabled: %v", err)
+	}
+
+	serviceMode, err := NewServiceModeSwitch(cfg.StateDir)
+	if err != nil {
+		log.Printf("✗ %v", err)
+		serviceMode = &ServiceModeSwitch{path: filepath.Join(cfg.StateDir, "maintenance_mode.json")}
+	}
+
+	clock, err := NewClockSync(cfg.ClockTimezone, cfg.ClockMaxDrift, cfg.ClockSync, client)
+	if err != nil {
+		log.Printf("✗ Clock sync disabled: %v", err)
+	}
+
+	var influx *InfluxExporter
+	if cfg.InfluxURL != "" {
+		influx = NewInfluxExporter(cfg.InfluxURL, cfg.InfluxToken, cfg.InfluxMeasurement, cfg.DeviceIP)
+	}
+
+	var profiles []ParameterProfile
+	if cfg.ParameterProfilesFile != "" {
+		if profiles, err = LoadParameterProfiles(cfg.ParameterProfilesFile); err != nil {
+			log.Printf("✗ Parameter profiles disabled: %v", err)
+		}
+	}
+
+	var automation *Automation
+	if cfg.AutomationFile != "" {
+		automationConfig, err := LoadAutomationConfig(cfg.AutomationFile)
+		if err != nil {
+			log.Printf("✗ Automation disabled: %v", err)
+		} else {
+			automationConfig.DryRun = automationConfig.DryRun || cfg.AutomationDryRun
+			automation = NewAutomation(*automationConfig, client, defaultVerifyOptions, audit)
+		}
 	}
+
+	s := &Server{
+		deviceIP:       cfg.DeviceIP,
+		devicePassword: cfg.DevicePassword,
+		deviceMagic:    cfg.LoginMagic(),
+		client:         client,
+		config:         cfg,
+		verifyOptions:  defaultVerifyOptions,
+		maintenance:    maintenance,
+		notifier:       notifier,
+		automation:     automation,
+		overrides:      overrides,
+		audit:          audit,
+		guard:          NewCommandGuard(cfg.SystemCommands, cfg.ConfirmTimeout),
+		serviceMode:    serviceMode,
+		clock:          clock,
+		events:         NewEventHub(),
+		history:        NewHistory(cfg.HistorySize),
+		influx:         influx,
+		profiles:       profiles,
+	}
+	client.SetSnapshotSource(s.latestSnapshot)
+	client.SetSessionRenewal(s.authenticate)
+	return s
+}
+
+// latestSnapshot returns the poller's most recent snapshot, nil before the first poll
+func (s *Server) latestSnapshot() *DeviceData {
+	s.mutex.RLock()
+	poller := s.poller
+	s.mutex.RUnlock()
+	if poller == nil {
+		return nil
+	}
+	data, _, _ := poller.Latest()
+	return data
+}
+
+// deviceClient returns the device client acting on behalf of the request's caller
+func (s *Server) deviceClient(r *http.Request) *WebClient {
+	return s.client.WithCaller(callerName(r))
+}
+
+// settings returns the server configuration, falling back to defaults
+func (s *Server) settings() *Config {
+	if s.config == nil {
+		return DefaultConfig()
+	}
+	return s.config
 }
 
 // Authenticate with the device (only caches the session ID)
 func (s *Server) authenticate() error {
-	sessionID, err := s.client.Login(s.devicePassword)
+	magic := s.deviceMagic
+	if magic == "" {
+		magic = Secret(PasswordMagic(s.devicePassword.Reveal()))
+	}
+
+	sessionID, err := s.client.LoginMagic(magic.Reveal())
 	if err != nil {
 		return fmt.Errorf("authentication failed: %w", err)
 	}
@@ -82,10 +304,19 @@ func (s *Server) authenticate() error {
 
 // FetchDeviceData fetches fresh data from the device
 func (s *Server) fetchDeviceData() (*DeviceData, error) {
+	return s.fetchDeviceDataWith(s.client)
+}
+
+// pollDeviceData fetches data for the background poller, queued behind API requests
+func (s *Server) pollDeviceData() (*DeviceData, error) {
+	return s.fetchDeviceDataWith(s.client.WithPriority(PriorityBackground))
+}
+
+func (s *Server) fetchDeviceDataWith(client *WebClient) (*DeviceData, error) {
 	log.Printf("→ Fetching fresh data from device...")
 	startTime := time.Now()
 
-	data, err := s.client.GetData()
+	data, err := client.GetData()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get data: %w", err)
 	}
@@ -94,6 +325,7 @@ func (s *Server) fetchDeviceData() (*DeviceData, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse data: %w", err)
 	}
+	deviceData.profile = s.parameterProfile()
 
 	elapsed := time.Since(startTime)
 	log.Printf("✓ Data fetched successfully (%d parameters, %.2fs)", len(deviceData.Items), elapsed.Seconds())
@@ -112,9 +344,11 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	response := APIResponse{
 		Success: true,
 		Message: "Server is running",
-		Data: map[string]string{
-			"status": "ok",
-			"time":   time.Now().Format(time.RFC3339),
+		Data: HealthResponse{
+			Status: "ok",
+			Time:   time.Now().Format(time.RFC3339),
+			Device: s.client.DeviceStatus(),
+			Queue:  s.client.QueueStats(),
 		},
 	}
 
@@ -132,11 +366,7 @@ func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
 	// Fetch fresh data from device
 	deviceData, err := s.fetchDeviceData()
 	if err != nil {
-		w.WriteHeader(http.StatusServiceUnavailable)
-		json.NewEncoder(w).Encode(APIResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Failed to fetch device data: %v", err),
-		})
+		writeError(w, err, "Failed to fetch device data")
 		return
 	}
 
@@ -144,7 +374,7 @@ func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
 	outdoorTemp, _ := deviceData.GetOutdoorTemperature()
 
 	status := StatusResponse{
-		Device:          "Atrea RD5",
+		Device:          s.deviceModel(deviceData),
 		IP:              s.deviceIP,
 		IsAuthenticated: s.client.IsAuthenticated(),
 		SessionID:       s.client.GetSessionID(),
@@ -153,6 +383,11 @@ func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
 		IndoorTemp:      indoorTemp,
 		OutdoorTemp:     outdoorTemp,
 	}
+	if s.clock != nil {
+		if clock, err := s.clock.Measure(deviceData); err == nil {
+			status.Clock = &clock
+		}
+	}
 
 	response := APIResponse{
 		Success: true,
@@ -173,23 +408,15 @@ func (s *Server) handleTemperature(w http.ResponseWriter, r *http.Request) {
 	// Fetch fresh data from device
 	deviceData, err := s.fetchDeviceData()
 	if err != nil {
-		w.WriteHeader(http.StatusServiceUnavailable)
-		json.NewEncoder(w).Encode(APIResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Failed to fetch device data: %v", err),
-		})
+		writeError(w, err, "Failed to fetch device data")
 		return
 	}
 
 	indoor, errIn := deviceData.GetCurrentTemperature()
 	outdoor, errOut := deviceData.GetOutdoorTemperature()
 
-	if errIn != nil || errOut != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(APIResponse{
-			Success: false,
-			Error:   "Failed to read temperatures",
-		})
+	if err := errors.Join(errIn, errOut); err != nil {
+		writeError(w, err, "Failed to read temperatures")
 		return
 	}
 
@@ -208,6 +435,34 @@ func (s *Server) handleTemperature(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// GET /alarms - Active alarms and the device alarm log
+func (s *Server) handleAlarms(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	alarmsXML, err := s.client.GetAlarms()
+	if err != nil {
+		writeError(w, err, "Failed to fetch alarms")
+		return
+	}
+	alarms, err := ParseAlarmsXML(alarmsXML)
+	if err != nil {
+		writeError(w, err, "Failed to parse alarms")
+		return
+	}
+
+	response := AlarmsResponse{Active: alarms.ActiveAlarms(), Events: alarms.Events}
+	if response.Active == nil {
+		response.Active = []int{}
+	}
+	if response.Events == nil {
+		response.Events = []AlarmEvent{}
+	}
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: response})
+}
+
 // GET /parameters - List all parameters
 func (s *Server) handleParameters(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -218,11 +473,7 @@ func (s *Server) handleParameters(w http.ResponseWriter, r *http.Request) {
 	// Fetch fresh data from device
 	deviceData, err := s.fetchDeviceData()
 	if err != nil {
-		w.WriteHeader(http.StatusServiceUnavailable)
-		json.NewEncoder(w).Encode(APIResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Failed to fetch device data: %v", err),
-		})
+		writeError(w, err, "Failed to fetch device data")
 		return
 	}
 
@@ -233,24 +484,38 @@ func (s *Server) handleParameters(w http.ResponseWriter, r *http.Request) {
 		limitInt, _ = strconv.Atoi(limit)
 	}
 
-	var params []ParameterResponse
-	count := 0
-	for id, value := range deviceData.Items {
-		name := GetParameterName(id)
-		params = append(params, ParameterResponse{
-			ID:    id,
-			Name:  name,
-			Value: value,
-		})
-		count++
-		if limitInt > 0 && count >= limitInt {
-			break
-		}
+	ids := make([]string, 0, len(deviceData.Items))
+	for id := range deviceData.Items {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	if limitInt > 0 && limitInt < len(ids) {
+		ids = ids[:limitInt]
 	}
 
-	result := ParametersResponse{
-		Count:      len(params),
-		Parameters: params,
+	var result interface{}
+	if r.URL.Query().Get("decoded") == "true" {
+		decoded := make([]DecodedValue, 0, len(ids))
+		for _, id := range ids {
+			decoded = append(decoded, DecodeParameter(id, deviceData.Items[id], deviceData.profile))
+		}
+		result = DecodedParametersResponse{
+			Count:      len(decoded),
+			Parameters: decoded,
+		}
+	} else {
+		var params []ParameterResponse
+		for _, id := range ids {
+			params = append(params, ParameterResponse{
+				ID:    id,
+				Name:  GetParameterName(id, deviceData.profile),
+				Value: deviceData.Items[id],
+			})
+		}
+		result = ParametersResponse{
+			Count:      len(params),
+			Parameters: params,
+		}
 	}
 
 	response := APIResponse{
@@ -274,40 +539,31 @@ func (s *Server) handleParameter(w http.ResponseWriter, r *http.Request) {
 	paramID := parts[0]
 
 	if paramID == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(APIResponse{
-			Success: false,
-			Error:   "Missing parameter ID",
-		})
+		writeFailure(w, http.StatusBadRequest, CodeInvalidRequest, "Missing parameter ID")
 		return
 	}
 
 	// Fetch fresh data from device
 	deviceData, err := s.fetchDeviceData()
 	if err != nil {
-		w.WriteHeader(http.StatusServiceUnavailable)
-		json.NewEncoder(w).Encode(APIResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Failed to fetch device data: %v", err),
-		})
+		writeError(w, err, "Failed to fetch device data")
 		return
 	}
 
 	value, ok := deviceData.Items[paramID]
 	if !ok {
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(APIResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Parameter %s not found", paramID),
-		})
+		writeError(w, &ParameterError{Parameter: paramID, Err: ErrUnknownParameter}, "")
 		return
 	}
 
-	param := ParameterResponse{
+	var param interface{} = ParameterResponse{
 		ID:    paramID,
-		Name:  GetParameterName(paramID),
+		Name:  GetParameterName(paramID, deviceData.profile),
 		Value: value,
 	}
+	if r.URL.Query().Get("decoded") == "true" {
+		param = DecodeParameter(paramID, value, deviceData.profile)
+	}
 
 	response := APIResponse{
 		Success: true,
@@ -318,6 +574,460 @@ func (s *Server) handleParameter(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// GET /mode - Current operating mode, PUT /mode - Request an operating mode
+func (s *Server) handleMode(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.writeVentilation(w)
+	case http.MethodPut:
+		var req ModeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeFailure(w, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("Invalid request body: %v", err))
+			return
+		}
+
+		if !req.Mode.Settable() {
+			writeFailure(w, http.StatusBadRequest, CodeOutOfRange, fmt.Sprintf("Mode %s cannot be requested", req.Mode))
+			return
+		}
+
+		log.Printf("→ %s sets operating mode to %s", callerName(r), req.Mode)
+		results, err := NewVentilationControl(s.deviceClient(r)).SetModeVerified(req.Mode, s.verifyOptions)
+		writeWriteResults(w, results, err, fmt.Sprintf("Operating mode set to %s", req.Mode))
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// GET /power - Current fan power, PUT /power - Request a fan power in percent
+func (s *Server) handlePower(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.writeVentilation(w)
+	case http.MethodPut:
+		var req PowerRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Power == nil {
+			writeFailure(w, http.StatusBadRequest, CodeInvalidRequest, `Invalid request body: expected {"power": <percent>}`)
+			return
+		}
+
+		if err := ValidateFanPower(*req.Power); err != nil {
+			writeRequestError(w, err)
+			return
+		}
+
+		log.Printf("→ %s sets fan power to %d%%", callerName(r), *req.Power)
+		results, err := NewVentilationControl(s.deviceClient(r)).SetPowerVerified(*req.Power, s.verifyOptions)
+		writeWriteResults(w, results, err, fmt.Sprintf("Fan power set to %d%%", *req.Power))
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// GET /setpoint - Current temperature setpoint, PUT /setpoint - Set it in °C
+func (s *Server) handleSetpoint(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		deviceData, err := s.fetchDeviceData()
+		if err != nil {
+			writeError(w, err, "Failed to fetch device data")
+			return
+		}
+
+		setpoint, err := deviceData.GetDesiredTemperature()
+		if err != nil {
+			writeError(w, err, "Failed to read setpoint")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, APIResponse{
+			Success: true,
+			Data: SetpointResponse{
+				Setpoint:   setpoint,
+				RawValue:   deviceData.Items[ParamDesiredTemperature],
+				Min:        MinSetpoint,
+				Max:        MaxSetpoint,
+				Resolution: SetpointResolution,
+			},
+		})
+	case http.MethodPut:
+		var req SetpointRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Celsius == nil {
+			writeFailure(w, http.StatusBadRequest, CodeInvalidRequest, `Invalid request body: expected {"celsius": <temperature>}`)
+			return
+		}
+
+		log.Printf("→ %s sets temperature setpoint to %.1f°C", callerName(r), *req.Celsius)
+		setpoint, results, err := NewTemperatureControl(s.deviceClient(r)).SetSetpointVerified(*req.Celsius, s.verifyOptions)
+		message := fmt.Sprintf("Setpoint set to %.1f°C", setpoint)
+		if setpoint != *req.Celsius {
+			message += fmt.Sprintf(" (requested %.2f°C, rounded/clamped to %.1f-%.1f°C in %.1f°C steps)",
+				*req.Celsius, MinSetpoint, MaxSetpoint, SetpointResolution)
+		}
+		writeWriteResults(w, results, err, message)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// GET /maintenance - Filter maintenance status and prediction
+func (s *Server) handleMaintenance(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if s.maintenance == nil {
+		writeFailure(w, http.StatusServiceUnavailable, CodeUnavailable, "Filter maintenance tracking is not available")
+		return
+	}
+
+	status, ok := s.maintenance.Status()
+	if !ok {
+		// No poll has completed yet, fetch a snapshot now
+		deviceData, err := s.fetchDeviceData()
+		if err != nil {
+			writeError(w, err, "Failed to fetch device data")
+			return
+		}
+		s.maintenance.Observe(deviceData)
+		if status, ok = s.maintenance.Status(); !ok {
+			writeError(w, &ParameterError{Parameter: ParamFilterHours, Err: ErrUnknownParameter}, "Device does not report filter hours")
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    status,
+	})
+}
+
+// POST /maintenance/filter-change - Record a filter change (and reset the device counter if configured)
+func (s *Server) handleFilterChange(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if s.maintenance == nil {
+		writeFailure(w, http.StatusServiceUnavailable, CodeUnavailable, "Filter maintenance tracking is not available")
+		return
+	}
+
+	change, err := s.maintenance.RecordChange(callerName(r))
+	if err != nil {
+		writeError(w, err, "")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Filter change recorded",
+		Data:    change,
+	})
+}
+
+// AutomationResponse represents the automation rules and their state
+type AutomationResponse struct {
+	DryRun bool                   `json:"dry_run"`
+	Rules  []AutomationRuleStatus `json:"rules"`
+}
+
+// GET /automation - Automation rules with last run and cooldown
+func (s *Server) handleAutomation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if s.automation == nil {
+		writeFailure(w, http.StatusServiceUnavailable, CodeUnavailable, "Automation is not configured (set AUTOMATION_FILE)")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data: AutomationResponse{
+			DryRun: s.automation.DryRun(),
+			Rules:  s.automation.Rules(),
+		},
+	})
+}
+
+// GET /automation/audit - Actions taken by automation rules, newest first
+func (s *Server) handleAutomationAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if s.automation == nil {
+		writeFailure(w, http.StatusServiceUnavailable, CodeUnavailable, "Automation is not configured (set AUTOMATION_FILE)")
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	writeJSON(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    s.automation.Audit(limit),
+	})
+}
+
+// GET /override - Active override, POST /override - Start a temporary override,
+// DELETE /override - Cancel it and restore the previous values
+func (s *Server) handleOverride(w http.ResponseWriter, r *http.Request) {
+	if s.overrides == nil {
+		writeFailure(w, http.StatusServiceUnavailable, CodeUnavailable, "Temporary overrides are not available")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		current, _ := s.overrides.Active()
+		writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: current})
+	case http.MethodPost:
+		var req OverrideRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeFailure(w, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("Invalid request body: %v", err))
+			return
+		}
+		if _, err := req.Validate(); err != nil {
+			writeRequestError(w, err)
+			return
+		}
+
+		override, err := s.overrides.Apply(req, callerName(r))
+		if err != nil {
+			writeError(w, err, "")
+			return
+		}
+		writeJSON(w, http.StatusOK, APIResponse{
+			Success: true,
+			Message: fmt.Sprintf("Override active until %s", override.ExpiresAt.Format(time.RFC3339)),
+			Data:    override,
+		})
+	case http.MethodDelete:
+		cancelled, err := s.overrides.Cancel(callerName(r))
+		if err != nil {
+			writeError(w, err, "")
+			return
+		}
+		if cancelled == nil {
+			writeFailure(w, http.StatusNotFound, CodeNotFound, "No override is active")
+			return
+		}
+		log.Printf("→ %s cancelled the override", callerName(r))
+		writeJSON(w, http.StatusOK, APIResponse{
+			Success: true,
+			Message: "Override cancelled, previous values restored",
+			Data:    cancelled,
+		})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// GET /audit - Changes made to the device, newest first
+func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := AuditFilter{
+		Caller:    query.Get("caller"),
+		Action:    query.Get("action"),
+		Parameter: query.Get("parameter"),
+		Limit:     100,
+	}
+	if limit, err := strconv.Atoi(query.Get("limit")); err == nil && limit > 0 {
+		filter.Limit = limit
+	}
+	if since := query.Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			writeFailure(w, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("Invalid since %q (want RFC 3339)", since))
+			return
+		}
+		filter.Since = t
+	}
+
+	records, err := s.audit.Query(filter)
+	if err != nil {
+		writeError(w, err, "Failed to read audit log")
+		return
+	}
+	writeJSON(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    records,
+	})
+}
+
+// SystemResponse lists the guarded commands the server may issue
+type SystemResponse struct {
+	AllowedCommands []string    `json:"allowed_commands"`
+	ConfirmTimeout  Duration    `json:"confirm_timeout"`
+	MaintenanceMode ServiceMode `json:"maintenance_mode"`
+}
+
+// SystemCommandRequest is the body of POST /system/:command and /system/confirm
+type SystemCommandRequest struct {
+	Settings string `json:"settings,omitempty"` // network settings, e.g. "dhcp=1"
+	Token    string `json:"token,omitempty"`
+}
+
+// ServiceModeRequest is the body of PUT /maintenance/mode
+type ServiceModeRequest struct {
+	Enabled *bool  `json:"enabled"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// GET /system - Allowed system commands and maintenance mode
+func (s *Server) handleSystem(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data: SystemResponse{
+			AllowedCommands: s.guard.Allowed(),
+			ConfirmTimeout:  Duration{s.guard.ttl},
+			MaintenanceMode: s.serviceMode.Get(),
+		},
+	})
+}
+
+// POST /system/:command - Request a confirmation token for reset, clear_mode or network
+// POST /system/confirm - Execute the command of a token issued to the same caller
+func (s *Server) handleSystemCommand(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req SystemCommandRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeFailure(w, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("Invalid request body: %v", err))
+			return
+		}
+	}
+
+	caller := callerName(r)
+	command := strings.TrimPrefix(r.URL.Path, "/system/")
+	if command != "confirm" {
+		pending, err := s.guard.Request(command, req.Settings, caller)
+		if err != nil {
+			writeRequestError(w, err)
+			return
+		}
+		log.Printf("→ %s requested system command %s", caller, command)
+		writeJSON(w, http.StatusAccepted, APIResponse{
+			Success: true,
+			Message: fmt.Sprintf("Confirm with POST /system/confirm within %s", s.guard.ttl),
+			Data:    pending,
+		})
+		return
+	}
+
+	pending, err := s.guard.Confirm(req.Token, caller)
+	if err != nil {
+		writeError(w, err, "")
+		return
+	}
+
+	log.Printf("⚠ %s confirmed system command %s", caller, pending.Command)
+	if err := executeSystemCommand(s.deviceClient(r), pending); err != nil {
+		writeError(w, err, fmt.Sprintf("System command %s failed", pending.Command))
+		return
+	}
+	writeJSON(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("System command %s sent", pending.Command),
+		Data:    pending,
+	})
+}
+
+// GET /maintenance/mode - Maintenance mode, PUT /maintenance/mode - Turn it on or off
+// Automation rules do not write to the device while maintenance mode is on.
+func (s *Server) handleServiceMode(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: s.serviceMode.Get()})
+	case http.MethodPut:
+		var req ServiceModeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Enabled == nil {
+			writeFailure(w, http.StatusBadRequest, CodeInvalidRequest, `Request body must be {"enabled": true|false, "reason": "..."}`)
+			return
+		}
+		state := s.serviceMode.Set(*req.Enabled, req.Reason, callerName(r))
+		message := "Maintenance mode disabled, automation resumed"
+		if state.Enabled {
+			message = "Maintenance mode enabled, automation paused"
+		}
+		writeJSON(w, http.StatusOK, APIResponse{Success: true, Message: message, Data: state})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// writeVentilation fetches and writes the current mode and fan power
+func (s *Server) writeVentilation(w http.ResponseWriter) {
+	deviceData, err := s.fetchDeviceData()
+	if err != nil {
+		writeError(w, err, "Failed to fetch device data")
+		return
+	}
+
+	mode, errMode := deviceData.GetVentilationMode()
+	power, errPower := deviceData.GetFanPower()
+	if errMode != nil || errPower != nil {
+		writeError(w, errors.Join(errMode, errPower), "Failed to read operating mode and fan power")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data: VentilationResponse{
+			Mode:      mode,
+			ModeID:    int(mode),
+			Power:     power,
+			Timestamp: time.Now(),
+		},
+	})
+}
+
+// defaultVerifyOptions is used for every write issued through the REST API
+var defaultVerifyOptions = VerifyOptions{Rollback: true, Attempts: 3, Interval: 500 * time.Millisecond}
+
+// writeWriteResults reports a verified write: 200 when every value took effect,
+// 409 when the device ignored a value and 503 when it could not be reached
+func writeWriteResults(w http.ResponseWriter, results []WriteResult, err error, message string) {
+	if err == nil {
+		writeJSON(w, http.StatusOK, APIResponse{Success: true, Message: message, Data: results})
+		return
+	}
+
+	code, status := errorStatus(err)
+	writeJSON(w, status, APIResponse{
+		Success: false,
+		Code:    code,
+		Error:   fmt.Sprintf("Write failed: %v", err),
+		Data:    results,
+	})
+}
+
+// writeJSON writes an API response with the given status code
+func writeJSON(w http.ResponseWriter, status int, response APIResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
 // Middleware for CORS
 func corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -342,33 +1052,310 @@ func loggingMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// callerKey is the request context key holding the authenticated caller name
+type callerKey struct{}
+
+// Middleware for API token authentication
+// Requests must send "Authorization: Bearer <token>" when tokens are configured;
+// /health, /health/live, /health/ready, /openapi.json and the dashboard's static files under /ui/ stay public.
+// A browser cannot set headers on a WebSocket, so /ws also takes ?access_token=<token>.
+func authMiddleware(tokens map[string]string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(tokens) == 0 || r.Method == http.MethodOptions || r.URL.Path == "/health" || strings.HasPrefix(r.URL.Path, "/health/") || r.URL.Path == "/openapi.json" || strings.HasPrefix(r.URL.Path, "/ui/") {
+			next(w, r)
+			return
+		}
+
+		presented := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if presented == "" && r.URL.Path == "/ws" {
+			presented = r.URL.Query().Get("access_token")
+		}
+		for token, name := range tokens {
+			if subtle.ConstantTimeCompare([]byte(presented), []byte(token)) == 1 {
+				next(w, r.WithContext(context.WithValue(r.Context(), callerKey{}, name)))
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("WWW-Authenticate", `Bearer realm="atrea-api"`)
+		writeFailure(w, http.StatusUnauthorized, CodeUnauthorized, "Missing or invalid API token")
+	}
+}
+
+// callerName returns the authenticated caller of a request, or "anonymous"
+func callerName(r *http.Request) string {
+	if name, ok := r.Context().Value(callerKey{}).(string); ok {
+		return name
+	}
+	return "anonymous"
+}
+
 // Combined middleware
 func (s *Server) withMiddleware(handler http.HandlerFunc) http.HandlerFunc {
-	return loggingMiddleware(corsMiddleware(handler))
+	return loggingMiddleware(corsMiddleware(authMiddleware(s.settings().AuthTokens, handler)))
+}
+
+// route binds a ServeMux pattern to its handler
+// Every route must be described in apiPaths (see openapi.go).
+type route struct {
+	pattern string
+	handler http.HandlerFunc
+}
+
+// routes returns the server's URL patterns
+func (s *Server) routes() []route {
+	return []route{
+		{"/health", s.handleHealth},
+		{"/health/live", s.handleLive},
+		{"/health/ready", s.handleReady},
+		{"/status", s.handleStatus},
+		{"/temperature", s.handleTemperature},
+		{"/alarms", s.handleAlarms},
+		{"/device", s.handleDevice},
+		{"/parameters", s.handleParameters},
+		{"/parameter/", s.handleParameter},
+		{"/mode", s.handleMode},
+		{"/power", s.handlePower},
+		{"/setpoint", s.handleSetpoint},
+		{"/maintenance", s.handleMaintenance},
+		{"/maintenance/filter-change", s.handleFilterChange},
+		{"/automation", s.handleAutomation},
+		{"/automation/audit", s.handleAutomationAudit},
+		{"/override", s.handleOverride},
+		{"/audit", s.handleAudit},
+		{"/maintenance/mode", s.handleServiceMode},
+		{"/system", s.handleSystem},
+		{"/system/", s.handleSystemCommand},
+		{"/openapi.json", s.handleOpenAPI},
+		{"/ui/", s.handleUI},
+		{"/dashboard", s.handleDashboard},
+		{"/ws", s.handleWebSocket},
+		{"/export.csv", s.handleExportCSV},
+	}
+}
+
+// Handler returns the server's routes on a dedicated mux
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	for _, rt := range s.routes() {
+		mux.HandleFunc(rt.pattern, s.withMiddleware(rt.handler))
+	}
+	return mux
 }
 
-// StartServer starts the HTTP server
+// StartServer authenticates with the device and serves HTTP on the given port
+// It blocks until the server fails or Shutdown is called
 func (s *Server) StartServer(port int) error {
 	// Authenticate first
 	if err := s.authenticate(); err != nil {
 		return err
 	}
-
-	// Setup routes
-	http.HandleFunc("/health", s.withMiddleware(s.handleHealth))
-	http.HandleFunc("/status", s.withMiddleware(s.handleStatus))
-	http.HandleFunc("/temperature", s.withMiddleware(s.handleTemperature))
-	http.HandleFunc("/parameters", s.withMiddleware(s.handleParameters))
-	http.HandleFunc("/parameter/", s.withMiddleware(s.handleParameter))
+	// Identify the unit so parameters decode with its firmware's profile
+	if _, err := s.identify(s.client, nil); err != nil {
+		log.Printf("⚠ Device identification failed: %v", err)
+	}
 
 	addr := fmt.Sprintf(":%d", port)
-	log.Printf("🚀 Starting web server on %s", addr)
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	scheme := "http"
+	if s.settings().TLSEnabled() {
+		scheme = "https"
+	}
+	log.Printf("🚀 Starting web server on %s (%s)", addr, scheme)
 	log.Printf("Available endpoints:")
 	log.Printf("  GET  /health             - Health check")
+	log.Printf("  GET  /health/live        - Liveness (process up)")
+	log.Printf("  GET  /health/ready       - Readiness (device reachable, session valid, data fresh)")
 	log.Printf("  GET  /status             - Device status and temperatures")
 	log.Printf("  GET  /temperature        - Current temperatures (indoor/outdoor)")
-	log.Printf("  GET  /parameters         - List all parameters (?limit=10 to limit)")
-	log.Printf("  GET  /parameter/:id      - Get specific parameter (e.g. /parameter/I10215)")
+	log.Printf("  GET  /alarms             - Active alarms and the device alarm log")
+	log.Printf("  GET  /device             - Model, firmware, serial, MAC and uptime of the unit")
+	log.Printf("  GET  /parameters         - List all parameters (?limit=10 to limit, ?decoded=true for units)")
+	log.Printf("  GET  /parameter/:id      - Get specific parameter (e.g. /parameter/I10215?decoded=true)")
+	log.Printf("  GET|PUT /mode            - Operating mode ({\"mode\": \"ventilation\"})")
+	log.Printf("  GET|PUT /power           - Fan power in percent ({\"power\": 50})")
+	log.Printf("  GET|PUT /setpoint        - Temperature setpoint in °C ({\"celsius\": 21.5})")
+	log.Printf("  GET  /maintenance        - Filter hours, remaining runtime and predicted change date")
+	log.Printf("  POST /maintenance/filter-change - Record a filter change")
+	log.Printf("  GET  /automation         - Automation rules and cooldowns")
+	log.Printf("  GET|PUT /maintenance/mode - Maintenance mode, pauses automation ({\"enabled\": true})")
+	log.Printf("  GET  /system             - Allowed system commands")
+	log.Printf("  POST /system/:command    - Request reset, clear_mode or network; confirm via POST /system/confirm")
+	log.Printf("  GET  /audit              - Changes made to the device (?caller=&action=&parameter=&since=&limit=)")
+	log.Printf("  GET|POST|DELETE /override - Temporary override ({\"power\": 100, \"duration\": \"30m\"})")
+	log.Printf("  GET  /automation/audit   - Actions taken by automation rules (?limit=50)")
+	log.Printf("  GET  /export.csv         - Polled history as CSV (?ids=I10215,I10211&from=&to=)")
+	log.Printf("  GET  /ws                 - WebSocket: change events and commands (set_parameter, set_mode, start_override, refresh)")
+	log.Printf("  GET  /ui/                - Web dashboard")
+	log.Printf("  GET  /dashboard          - Dashboard data from the latest poll")
+	log.Printf("  GET  /openapi.json       - OpenAPI specification")
 
-	return http.ListenAndServe(addr, nil)
+	return s.Serve(ln)
+}
+
+// Serve accepts connections on ln and starts the background poller
+// It returns nil once Shutdown has completed, or at once (closing ln) if
+// Shutdown was called before, e.g. on a signal during StartServer's login.
+func (s *Server) Serve(ln net.Listener) error {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		ln.Close()
+		return nil
+	}
+	if s.httpServer != nil {
+		s.mutex.Unlock()
+		return errors.New("server already started")
+	}
+	cfg := s.settings()
+	s.httpServer = &http.Server{
+		Handler:      s.Handler(),
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		IdleTimeout:  cfg.IdleTimeout,
+	}
+	if s.poller == nil {
+		s.poller = NewPoller(cfg.PollInterval, s.pollDeviceData)
+		if s.maintenance != nil {
+			s.poller.Subscribe(s.maintenance.Observe)
+		}
+		if s.notifier != nil {
+			s.poller.Subscribe(s.evaluateNotifications)
+		}
+		if s.automation != nil {
+			s.poller.Subscribe(s.runAutomation)
+		}
+		if s.clock != nil {
+			s.poller.Subscribe(s.clock.Observe)
+		}
+		if s.events != nil {
+			s.poller.Subscribe(s.publishEvents)
+		}
+		if s.history != nil {
+			s.poller.Subscribe(s.history.Observe)
+		}
+		if s.influx != nil {
+			s.poller.Subscribe(s.influx.Observe)
+		}
+	}
+	httpServer := s.httpServer
+	poller := s.poller
+	s.mutex.Unlock()
+
+	if s.notifier != nil {
+		s.notifier.Start()
+	}
+	if s.overrides != nil {
+		s.overrides.Start()
+	}
+	if s.influx != nil {
+		s.influx.Start()
+	}
+	poller.Start()
+
+	var err error
+	if cfg.TLSEnabled() {
+		err = httpServer.ServeTLS(ln, cfg.TLSCertFile, cfg.TLSKeyFile)
+	} else {
+		err = httpServer.Serve(ln)
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Shutdown stops accepting connections, waits for in-flight requests
+// (including device writes) to complete and stops the poller
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mutex.Lock()
+	s.closed = true
+	httpServer := s.httpServer
+	poller := s.poller
+	s.mutex.Unlock()
+
+	// Every step is bounded by ctx; the first error, usually ctx.Err(), is returned
+	var errs []error
+	if httpServer != nil {
+		errs = append(errs, httpServer.Shutdown(ctx))
+	}
+	if s.overrides != nil {
+		s.overrides.Stop()
+	}
+	if poller != nil {
+		errs = append(errs, poller.Stop(ctx))
+	}
+	if s.notifier != nil {
+		errs = append(errs, s.notifier.Stop(ctx))
+	}
+	if s.influx != nil {
+		errs = append(errs, s.influx.Stop(ctx))
+	}
+	if s.clock != nil {
+		errs = append(errs, s.clock.Stop(ctx))
+	}
+	if s.events != nil {
+		// WebSocket connections are hijacked, so httpServer.Shutdown does not wait for them
+		s.events.Close()
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runAutomation evaluates automation rules unless maintenance mode or a
+// temporary override is active
+func (s *Server) runAutomation(data *DeviceData) {
+	if s.serviceMode.Enabled() {
+		return
+	}
+	if s.overrides != nil {
+		if _, active := s.overrides.Active(); active {
+			return
+		}
+	}
+	s.automation.Evaluate(data)
+}
+
+// evaluateNotifications runs the notification rules on a polled snapshot,
+// fetching the alarm list when a rule needs it
+func (s *Server) evaluateNotifications(data *DeviceData) {
+	var active []int
+	if s.notifier.WatchesAlarms() {
+		alarms, err := s.polledAlarms(data)
+		if err != nil {
+			return
+		}
+		active = alarms.ActiveAlarms()
+	}
+	s.notifier.Evaluate(data, active)
+}
+
+// polledAlarms returns the alarm list read alongside a polled snapshot;
+// alarms.xml is fetched once per snapshot however many subscribers and
+// dashboards ask
+func (s *Server) polledAlarms(data *DeviceData) (*AlarmData, error) {
+	s.alarmsMutex.Lock()
+	defer s.alarmsMutex.Unlock()
+	if s.alarmsData == data {
+		return s.alarmsList, s.alarmsErr
+	}
+
+	var alarms *AlarmData
+	alarmsXML, err := s.client.WithPriority(PriorityBackground).GetAlarms()
+	if err != nil {
+		log.Printf("✗ Failed to fetch alarms: %v", err)
+	} else if alarms, err = ParseAlarmsXML(alarmsXML); err != nil {
+		log.Printf("✗ Failed to parse alarms: %v", err)
+	}
+	s.alarmsData, s.alarmsList, s.alarmsErr = data, alarms, err
+	return alarms, err
 }
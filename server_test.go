@@ -1,12 +1,30 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
+// newTestServer creates a server talking to a mock device with state in a temp dir
+func newTestServer(t *testing.T, deviceURL string) *Server {
+	t.Helper()
+	cfg := DefaultConfig()
+	cfg.DeviceIP = "127.0.0.1"
+	cfg.DevicePassword = "6378"
+	cfg.StateDir = t.TempDir()
+
+	server := NewServerWithConfig(cfg)
+	server.client.baseURL = deviceURL
+	server.verifyOptions = VerifyOptions{Attempts: 1}
+	return server
+}
+
 // TestHealthEndpoint tests the health check endpoint
 func TestHealthEndpoint(t *testing.T) {
 	server := &Server{
@@ -136,3 +154,147 @@ func TestStatusEndpointDeviceNotAvailable(t *testing.T) {
 		t.Logf("Device available (status %d)", w.Code)
 	}
 }
+
+// TestServeAndShutdown tests that two servers can run side by side and shut down cleanly
+func TestServeAndShutdown(t *testing.T) {
+	device := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<?xml version="1.0"?><RD5WEB><RD5><INTEGER_R><O I="I10215" V="201"/></INTEGER_R></RD5></RD5WEB>`)
+	}))
+	defer device.Close()
+
+	servers := make([]*Server, 2)
+	addrs := make([]string, 2)
+	errChs := make([]chan error, 2)
+	for i := range servers {
+		servers[i] = newTestServer(t, device.URL)
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("failed to listen: %v", err)
+		}
+		addrs[i] = ln.Addr().String()
+		errChs[i] = make(chan error, 1)
+		go func(server *Server, errCh chan error) { errCh <- server.Serve(ln) }(servers[i], errChs[i])
+	}
+
+	// Both servers are running at this point
+	for i, addr := range addrs {
+		resp, err := http.Get("http://" + addr + "/health")
+		if err != nil {
+			t.Fatalf("server %d: failed to make request: %v", i, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("server %d: expected status 200, got %d", i, resp.StatusCode)
+		}
+	}
+
+	for i, server := range servers {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := server.Shutdown(ctx); err != nil {
+			t.Errorf("server %d: shutdown failed: %v", i, err)
+		}
+		cancel()
+
+		if err := <-errChs[i]; err != nil {
+			t.Errorf("server %d: Serve returned %v, want nil", i, err)
+		}
+	}
+}
+
+// TestShutdownBeforeServe tests that a signal during startup does not leave Serve running
+func TestShutdownBeforeServe(t *testing.T) {
+	server := newTestServer(t, "http://127.0.0.1:1")
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown failed: %v", err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	errCh := make(chan error, 1)
+	go func() { errCh <- server.Serve(ln) }()
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Errorf("Serve returned %v, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return after Shutdown")
+	}
+}
+
+// TestAuthMiddleware tests bearer token authentication
+func TestAuthMiddleware(t *testing.T) {
+	var caller string
+	handler := authMiddleware(map[string]string{"s3cret": "alice"}, func(w http.ResponseWriter, r *http.Request) {
+		caller = callerName(r)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		path       string
+		header     string
+		wantStatus int
+	}{
+		{"/status", "", http.StatusUnauthorized},
+		{"/status", "Bearer wrong", http.StatusUnauthorized},
+		{"/status", "Bearer s3cret", http.StatusOK},
+		{"/health", "", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		w := httptest.NewRecorder()
+		handler(w, req)
+
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s with %q: expected status %d, got %d", tt.path, tt.header, tt.wantStatus, w.Code)
+		}
+	}
+
+	if caller != "anonymous" {
+		t.Errorf("expected last caller anonymous (/health), got %q", caller)
+	}
+}
+
+// TestParameterDecoded tests ?decoded=true on /parameter/:id and /parameters
+func TestParameterDecoded(t *testing.T) {
+	device := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<RD5WEB><RD5><INTEGER_R><O I="I10215" V="205"/><O I="I10211" V="65526"/></INTEGER_R></RD5></RD5WEB>`)
+	}))
+	defer device.Close()
+
+	server := newTestServer(t, device.URL)
+
+	req := httptest.NewRequest("GET", "/parameter/I10211?decoded=true", nil)
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+
+	var single struct {
+		Data DecodedValue `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&single); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if single.Data.Value != -1.0 || single.Data.Unit != "°C" || single.Data.RawValue != "65526" {
+		t.Errorf("got %+v, want -1.0 °C raw 65526", single.Data)
+	}
+
+	req = httptest.NewRequest("GET", "/parameters?decoded=true&limit=1", nil)
+	w = httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+
+	var list struct {
+		Data DecodedParametersResponse `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if list.Data.Count != 1 || list.Data.Parameters[0].ID != "I10211" {
+		t.Errorf("got %+v, want first parameter I10211 only", list.Data)
+	}
+}
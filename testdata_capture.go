@@ -1,57 +1,403 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
-// CaptureTestData runs the actual device integration and saves responses to testdata files
-// This is used ONCE to capture real device responses for testing
-func CaptureTestData() error {
-	// Create testdata directory
-	testdataDir := "testdata"
-	if err := os.MkdirAll(testdataDir, 0755); err != nil {
+// captureManifestFile lists the files written by a capture run
+const captureManifestFile = "manifest.json"
+
+// captureEndpoint is one device response saved by CaptureTestData
+type captureEndpoint struct {
+	file     string
+	endpoint string
+	fetch    func(wc *WebClient) (string, error)
+	verify   func(body string) error
+	required bool // the capture fails without it; others are skipped when the unit lacks them
+}
+
+// captureEndpoints lists every endpoint the client reads
+var captureEndpoints = []captureEndpoint{
+	{"response_config.xml", "/config/xml.xml", (*WebClient).GetData, verifyConfigXML, true},
+	{"response_alarms.xml", "/config/alarms.xml", (*WebClient).GetAlarms, verifyAlarmsXML, true},
+	{"response_network.txt", "/config/ip.cgi", (*WebClient).GetNetworkSettings, verifyNetwork, false},
+	{"response_schedule_rts_vzt.xml", "/config/rtssetup.xml", weeklyProgramFetcher("RTS", "vzt"), verifyWellFormedXML, false},
+	{"response_schedule_rts_izt.xml", "/config/rgtssetup.xml", weeklyProgramFetcher("RTS", "izt"), verifyWellFormedXML, false},
+	{"response_schedule_rns_vzt.xml", "/config/rnssetup.xml", weeklyProgramFetcher("RNS", "vzt"), verifyWellFormedXML, false},
+	{"response_schedule_rns_izt.xml", "/config/rgnssetup.xml", weeklyProgramFetcher("RNS", "izt"), verifyWellFormedXML, false},
+}
+
+func weeklyProgramFetcher(deviceType, programType string) func(wc *WebClient) (string, error) {
+	return func(wc *WebClient) (string, error) {
+		return wc.GetWeeklyProgram(deviceType, programType)
+	}
+}
+
+// CaptureManifest describes a capture run and is saved next to the files
+type CaptureManifest struct {
+	CapturedAt     time.Time     `json:"captured_at"`
+	DeviceTime     string        `json:"device_time,omitempty"` // clock of the unit (RD5WEB t attribute)
+	Model          string        `json:"model"`
+	Firmware       string        `json:"firmware"` // see DeviceInfo, else the web server banner of the unit
+	ParameterCount int           `json:"parameter_count"`
+	Scrubbed       []string      `json:"scrubbed"` // parameters replaced with placeholder values
+	Files          []CaptureFile `json:"files"`
+}
+
+// CaptureFile is one captured endpoint; Error explains why it was not saved
+type CaptureFile struct {
+	File     string `json:"file"`
+	Endpoint string `json:"endpoint"`
+	Bytes    int    `json:"bytes,omitempty"`
+	SHA256   string `json:"sha256,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// CaptureTestData reads every known endpoint from the unit and saves the
+// anonymised responses as test fixtures in cfg.CaptureDir
+// Each response is scrubbed and must still parse before it is written.
+func CaptureTestData(cfg *Config) error {
+	if err := os.MkdirAll(cfg.CaptureDir, 0755); err != nil {
 		return err
 	}
 
-	// Connect to device
-	client := NewWebClient("192.168.68.106")
+	client := NewWebClient(cfg.DeviceIP)
+	client.httpClient.Timeout = cfg.DeviceTimeout
+	client.SetRetryPolicy(cfg.RetryPolicy())
+	banner := &bannerTransport{next: http.DefaultTransport}
+	client.SetTransport(banner)
+	if cfg.DeviceRecord != "" {
+		recorder, err := NewRecordingTransport(cfg.DeviceRecord, banner)
+		if err != nil {
+			return err
+		}
+		defer recorder.Close()
+		client.SetTransport(recorder)
+	}
 
-	// STEP 1: Capture login response
-	fmt.Println("Capturing login response...")
-	sessionID, err := client.Login("6378")
-	if err != nil {
+	fmt.Printf("Capturing from %s into %s/\n", cfg.DeviceIP, cfg.CaptureDir)
+	if _, err := client.LoginMagic(cfg.LoginMagic().Reveal()); err != nil {
 		return fmt.Errorf("login failed: %w", err)
 	}
-	fmt.Printf("✓ Session ID obtained: %s\n", sessionID)
+	fmt.Println("✓ Logged in")
 
-	// STEP 2: Capture config data response
-	fmt.Println("Capturing config data...")
-	configData, err := client.GetData()
-	if err != nil {
-		return fmt.Errorf("get data failed: %w", err)
-	}
-	fmt.Printf("✓ Config data captured: %d bytes\n", len(configData))
+	// Registers named as serial or MAC in DEVICE_IDENTITY_PARAMS are scrubbed too
+	scrubParams := append(append(append([]string{}, cfg.CaptureScrubParams...), cfg.IdentityParams["serial"]...), cfg.IdentityParams["mac"]...)
+	scrubber := newCaptureScrubber(cfg.DeviceIP, scrubParams)
+	manifest := CaptureManifest{CapturedAt: time.Now().UTC(), Scrubbed: scrubber.parameters()}
+	var data *DeviceData
+	var network string
+	for _, ep := range captureEndpoints {
+		file := CaptureFile{File: ep.file, Endpoint: ep.endpoint}
+		body, err := ep.fetch(client)
+		if err == nil {
+			if ep.file == "response_network.txt" {
+				body = scrubber.scrubNetwork(body)
+			} else {
+				body = scrubber.scrub(body)
+			}
+			err = ep.verify(body)
+		}
+		if err != nil {
+			if ep.required {
+				return fmt.Errorf("%s: %w", ep.endpoint, err)
+			}
+			file.Error = err.Error()
+			manifest.Files = append(manifest.Files, file)
+			fmt.Printf("⚠ Skipped %s: %v\n", ep.endpoint, err)
+			continue
+		}
 
-	if err := os.WriteFile(filepath.Join(testdataDir, "response_config.xml"), []byte(configData), 0644); err != nil {
-		return err
+		if err := os.WriteFile(filepath.Join(cfg.CaptureDir, ep.file), []byte(body), 0644); err != nil {
+			return err
+		}
+		sum := sha256.Sum256([]byte(body))
+		file.Bytes = len(body)
+		file.SHA256 = hex.EncodeToString(sum[:])
+		manifest.Files = append(manifest.Files, file)
+		fmt.Printf("✓ %s → %s (%d bytes)\n", ep.endpoint, ep.file, len(body))
+
+		switch ep.file {
+		case "response_config.xml":
+			data, _ = ParseXMLData(body)
+			manifest.ParameterCount = len(data.Items)
+			manifest.DeviceTime = deviceTimestamp(body)
+		case "response_network.txt":
+			network = body
+		}
 	}
 
-	// STEP 3: Capture alarms response
-	fmt.Println("Capturing alarms data...")
-	alarmsData, err := client.GetAlarms()
+	info := ExtractDeviceInfo(data, ParseNetworkSettings(network), cfg.IdentityParams)
+	manifest.Model, manifest.Firmware = info.Model, info.Firmware
+	if manifest.Firmware == unknownFirmware {
+		manifest.Firmware = banner.get()
+	}
+	encoded, err := json.MarshalIndent(manifest, "", "  ")
 	if err != nil {
-		return fmt.Errorf("get alarms failed: %w", err)
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(cfg.CaptureDir, captureManifestFile), append(encoded, '\n'), 0644); err != nil {
+		return err
 	}
-	fmt.Printf("✓ Alarms data captured: %d bytes\n", len(alarmsData))
 
-	if err := os.WriteFile(filepath.Join(testdataDir, "response_alarms.xml"), []byte(alarmsData), 0644); err != nil {
+	fmt.Printf("\n✓ Test data captured to %s/ (firmware %s)\n", cfg.CaptureDir, manifest.Firmware)
+	return nil
+}
+
+// verifyConfigXML checks that xml.xml parses and holds parameters
+func verifyConfigXML(body string) error {
+	data, err := ParseXMLData(body)
+	if err != nil {
 		return err
 	}
+	if len(data.Items) == 0 {
+		return fmt.Errorf("%w: no parameters", ErrMalformedResponse)
+	}
+	return nil
+}
+
+// verifyAlarmsXML checks that alarms.xml parses
+func verifyAlarmsXML(body string) error {
+	_, err := ParseAlarmsXML(body)
+	return err
+}
 
-	fmt.Println("\n✓ All test data captured successfully!")
-	fmt.Printf("Test data saved to %s/\n", testdataDir)
+// verifyNetwork checks ip.cgi, which is XML on some firmware and plain text on others
+func verifyNetwork(body string) error {
+	if strings.TrimSpace(body) == "" {
+		return fmt.Errorf("%w: empty response", ErrMalformedResponse)
+	}
+	if strings.HasPrefix(strings.TrimSpace(body), "<") {
+		return verifyWellFormedXML(body)
+	}
+	return nil
+}
 
+// verifyWellFormedXML checks endpoints the client passes through without parsing
+func verifyWellFormedXML(body string) error {
+	decoder := xml.NewDecoder(strings.NewReader(body))
+	elements := 0
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrMalformedResponse, err)
+		}
+		if _, ok := token.(xml.StartElement); ok {
+			elements++
+		}
+	}
+	if elements == 0 {
+		return fmt.Errorf("%w: no XML elements", ErrMalformedResponse)
+	}
 	return nil
 }
+
+// deviceTimestamp returns the t attribute of the RD5WEB root element
+func deviceTimestamp(body string) string {
+	var root struct {
+		T string `xml:"t,attr"`
+	}
+	xml.Unmarshal([]byte(body), &root)
+	return strings.TrimSpace(root.T)
+}
+
+// captureNetworkPairs are the low/high parameter pairs holding addresses
+// (see IPParameterEncoder) and the documentation addresses (RFC 5737) replacing
+// them. The subnet mask in H12204/H12205 identifies nobody and is kept.
+var captureNetworkPairs = []struct {
+	low, high, replacement string
+}{
+	{"H12202", "H12203", "192.0.2.10"}, // address
+	{"H12206", "H12207", "192.0.2.1"},  // gateway
+	{"H12208", "H12209", "192.0.2.53"}, // DNS server
+}
+
+// captureAddressKeys are the ip.cgi fields holding addresses; the mask is kept
+var captureAddressKeys = []string{"ip", "ipaddr", "addr", "gw", "gateway", "dns", "dns1", "dns2"}
+
+var (
+	captureParameter = regexp.MustCompile(`(<O\s+I=")([^"]+)("\s+V=")([^"]*)(")`)
+	captureIPv4      = regexp.MustCompile(`\b(\d{1,3})\.(\d{1,3})\.(\d{1,3})\.(\d{1,3})\b`)
+	captureIPDigits  = regexp.MustCompile(`\b\d{12}\b`) // ip.cgi form: 192168068106
+	captureMAC       = regexp.MustCompile(`\b[0-9A-Fa-f]{2}([:-])[0-9A-Fa-f]{2}(?:[:-][0-9A-Fa-f]{2}){4}\b`)
+)
+
+// captureScrubber replaces network identifiers and configured parameters
+// (e.g. serial numbers) with placeholders. Only addresses it knows - the
+// device IP and those read from the address parameters and ip.cgi fields -
+// are replaced, so version strings and other dotted numbers survive.
+type captureScrubber struct {
+	values    map[string]string // parameter ID -> placeholder
+	addresses map[string]string // real dotted address -> documentation address
+}
+
+func newCaptureScrubber(deviceIP string, params []string) *captureScrubber {
+	s := &captureScrubber{values: make(map[string]string), addresses: make(map[string]string)}
+	for _, pair := range captureNetworkPairs {
+		encoded, _ := IPParameterEncoder(pair.replacement)
+		s.values[pair.low] = encoded["low"]
+		s.values[pair.high] = encoded["high"]
+	}
+	for _, id := range params {
+		s.values[id] = "0"
+	}
+	if host, _, err := net.SplitHostPort(deviceIP); err == nil {
+		deviceIP = host
+	}
+	if net.ParseIP(deviceIP).To4() != nil {
+		s.addresses[deviceIP] = "192.0.2.10"
+	}
+	return s
+}
+
+// parameters returns the scrubbed parameter IDs, sorted
+func (s *captureScrubber) parameters() []string {
+	ids := make([]string, 0, len(s.values))
+	for id := range s.values {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// scrub anonymises one response body
+func (s *captureScrubber) scrub(body string) string {
+	s.learnParameters(body)
+	body = captureParameter.ReplaceAllStringFunc(body, func(match string) string {
+		parts := captureParameter.FindStringSubmatch(match)
+		if placeholder, ok := s.values[parts[2]]; ok {
+			return parts[1] + parts[2] + parts[3] + placeholder + parts[5]
+		}
+		return match
+	})
+	body = captureIPv4.ReplaceAllStringFunc(body, func(match string) string {
+		if placeholder, ok := s.addresses[match]; ok {
+			return placeholder
+		}
+		return match
+	})
+	body = captureIPDigits.ReplaceAllStringFunc(body, func(match string) string {
+		placeholder, ok := s.addresses[dottedAddress(match)]
+		if !ok {
+			return match
+		}
+		var digits strings.Builder
+		for _, octet := range strings.Split(placeholder, ".") {
+			n, _ := strconv.Atoi(octet)
+			fmt.Fprintf(&digits, "%03d", n)
+		}
+		return digits.String()
+	})
+	return captureMAC.ReplaceAllStringFunc(body, func(match string) string {
+		separator := captureMAC.FindStringSubmatch(match)[1]
+		return strings.Join([]string{"00", "00", "5E", "00", "53", "00"}, separator) // RFC 7042 documentation MAC
+	})
+}
+
+// scrubNetwork anonymises an ip.cgi body: its address fields are learnt
+// before scrubbing and its serial number fields are replaced with 0
+func (s *captureScrubber) scrubNetwork(body string) string {
+	fields := ParseNetworkSettings(body)
+	for _, key := range captureAddressKeys {
+		value := strings.TrimSpace(fields[key])
+		if captureIPDigits.MatchString(value) {
+			value = dottedAddress(value)
+		}
+		if ip := net.ParseIP(value).To4(); ip != nil && !ip.IsUnspecified() {
+			s.address(ip.String())
+		}
+	}
+	for _, key := range networkIdentityKeys["serial"] {
+		if serial := strings.TrimSpace(fields[key]); serial != "" && serial != "0" {
+			body = strings.ReplaceAll(body, serial, "0")
+		}
+	}
+	return s.scrub(body)
+}
+
+// learnParameters records the real addresses held by the address parameters
+func (s *captureScrubber) learnParameters(body string) {
+	values := make(map[string]int)
+	for _, parts := range captureParameter.FindAllStringSubmatch(body, -1) {
+		if n, err := strconv.Atoi(parts[4]); err == nil {
+			values[parts[2]] = n
+		}
+	}
+	for _, pair := range captureNetworkPairs {
+		low, okLow := values[pair.low]
+		high, okHigh := values[pair.high]
+		real := IPParameterDecoder(low, high)
+		if _, known := s.addresses[real]; okLow && okHigh && !known && (low != 0 || high != 0) {
+			s.addresses[real] = pair.replacement
+		}
+	}
+}
+
+// address maps a real address to a stable documentation address
+func (s *captureScrubber) address(real string) string {
+	if placeholder, ok := s.addresses[real]; ok {
+		return placeholder
+	}
+	placeholder := fmt.Sprintf("192.0.2.%d", 100+len(s.addresses))
+	s.addresses[real] = placeholder
+	return placeholder
+}
+
+// dottedAddress converts the 12 digit ip.cgi form to a dotted address
+func dottedAddress(digits string) string {
+	dotted := make([]string, 4)
+	for i := range dotted {
+		n, _ := strconv.Atoi(digits[3*i : 3*i+3])
+		dotted[i] = strconv.Itoa(n)
+	}
+	return strings.Join(dotted, ".")
+}
+
+// bannerTransport remembers the Server header the unit sends
+type bannerTransport struct {
+	next http.RoundTripper
+
+	mutex  sync.Mutex
+	banner string
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *bannerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err == nil {
+		if server := resp.Header.Get("Server"); server != "" {
+			t.mutex.Lock()
+			t.banner = server
+			t.mutex.Unlock()
+		}
+	}
+	return resp, err
+}
+
+func (t *bannerTransport) get() string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.banner == "" {
+		return "unknown"
+	}
+	return t.banner
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestCaptureTestData tests that every endpoint is captured, anonymised and listed in the manifest
+func TestCaptureTestData(t *testing.T) {
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "RD5 web 2.1")
+		switch r.URL.Path {
+		case "/config/login.cgi":
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><root lng="0">15736</root>`)
+		case "/config/xml.xml":
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><RD5WEB t="2025-11-17 11:34:12 "><RD5><INTEGER_R>`+
+				`<O I="I10215" V="201"/><O I="I00123" V="98765"/></INTEGER_R><INTEGER_RW>`+
+				`<O I="H12202" V="43200"/><O I="H12203" V="27204"/><O I="H12204" V="65535"/><O I="H12205" V="255"/>`+
+				`</INTEGER_RW></RD5></RD5WEB>`)
+		case "/config/alarms.xml":
+			fmt.Fprint(w, `<root><errors t="2025-11-17 11:34:12 "><i t="1663908742" i="1" p="2"/></errors></root>`)
+		case "/config/ip.cgi":
+			fmt.Fprint(w, "dhcp=0&ip=192168068106&gw=192168068001&ip4mask=255255255000&mac=00:1A:2B:3C:4D:5E&sn=AT0417")
+		case "/config/rtssetup.xml":
+			fmt.Fprint(w, `<root><p d="0" h="6" m="0" v="2"/><!-- unit 192.168.68.106 firmware 2.3.36.1 --></root>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer mock.Close()
+
+	cfg := DefaultConfig()
+	cfg.DeviceIP = strings.TrimPrefix(mock.URL, "http://")
+	cfg.DevicePassword = "6378"
+	cfg.CaptureDir = t.TempDir()
+	cfg.CaptureScrubParams = []string{"I00123"}
+	if err := CaptureTestData(cfg); err != nil {
+		t.Fatalf("capture: %v", err)
+	}
+
+	read := func(name string) string {
+		body, err := os.ReadFile(filepath.Join(cfg.CaptureDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(body)
+	}
+	for _, name := range []string{"response_config.xml", "response_alarms.xml", "response_network.txt", "response_schedule_rts_vzt.xml"} {
+		body := read(name)
+		for _, identifier := range []string{"192.168", "192168068", "1A:2B", "43200", "98765", "AT0417"} {
+			if strings.Contains(body, identifier) {
+				t.Errorf("%s still contains %s:\n%s", name, identifier, body)
+			}
+		}
+	}
+	if network := read("response_network.txt"); !strings.Contains(network, "ip4mask=255255255000") || !strings.Contains(network, "mac=00:00:5E:00:53:00") {
+		t.Errorf("network settings scrubbed wrongly: %s", network)
+	}
+	if schedule := read("response_schedule_rts_vzt.xml"); !strings.Contains(schedule, "unit 192.0.2.10 firmware 2.3.36.1") {
+		t.Errorf("schedule scrubbed wrongly: %s", schedule)
+	}
+	if data, _ := ParseXMLData(read("response_config.xml")); data.Items["H12202"] != "192" || data.Items["H12204"] != "65535" || data.Items["I10215"] != "201" {
+		t.Errorf("got parameters %v", data.Items)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.CaptureDir, "response_schedule_rns_vzt.xml")); !os.IsNotExist(err) {
+		t.Errorf("unparseable schedule was saved: %v", err)
+	}
+
+	var manifest CaptureManifest
+	if err := json.Unmarshal([]byte(read(captureManifestFile)), &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Firmware != "RD5 web 2.1" || manifest.DeviceTime != "2025-11-17 11:34:12" || manifest.ParameterCount != 6 || len(manifest.Files) != len(captureEndpoints) {
+		t.Errorf("got manifest %+v", manifest)
+	}
+	for _, file := range manifest.Files {
+		if saved := file.SHA256 != ""; saved == (file.Error != "") {
+			t.Errorf("%s: got sha256 %q and error %q", file.File, file.SHA256, file.Error)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+// Atrea RD5 dashboard: reads the server's latest poll, alarms included, from
+// GET /dashboard and writes through PUT /mode and /setpoint.
+"use strict";
+
+const REFRESH_MS = 15000;
+const CHART_POINTS = 240; // one hour at the refresh interval
+
+const samples = [];
+const $ = (id) => document.getElementById(id);
+
+// api calls an endpoint with the stored token and returns its APIResponse
+async function api(path, method = "GET", body) {
+  const headers = {};
+  const token = localStorage.getItem("atrea-token");
+  if (token) headers["Authorization"] = "Bearer " + token;
+  if (body !== undefined) headers["Content-Type"] = "application/json";
+
+  const resp = await fetch(path, { method, headers, body: body === undefined ? undefined : JSON.stringify(body) });
+  if (resp.status === 401) {
+    $("login").hidden = false;
+    throw new Error("API token required");
+  }
+  const json = await resp.json();
+  if (!json.success) throw new Error(json.error || resp.statusText);
+  return json;
+}
+
+function show(id, text) {
+  $(id).textContent = text;
+}
+
+function celsius(v) {
+  return v.toFixed(1) + " °C";
+}
+
+function showTemperatures(data) {
+  show("indoor", celsius(data.indoor_celsius));
+  show("outdoor", celsius(data.outdoor_celsius));
+  const time = new Date(data.timestamp);
+  const last = samples[samples.length - 1];
+  if (last && last.time.getTime() === time.getTime()) return; // no new poll yet
+  samples.push({ time, indoor: data.indoor_celsius, outdoor: data.outdoor_celsius });
+  if (samples.length > CHART_POINTS) samples.shift();
+  drawChart();
+}
+
+function showVentilation(data, setpoint) {
+  show("mode", data.mode);
+  show("power", data.power_percent + " %");
+  if (document.activeElement !== $("mode-select")) $("mode-select").value = data.mode;
+
+  show("setpoint", celsius(setpoint.setpoint_celsius));
+  const input = $("setpoint-input");
+  input.min = setpoint.min_celsius;
+  input.max = setpoint.max_celsius;
+  input.step = setpoint.resolution_celsius;
+  if (document.activeElement !== input) input.value = setpoint.setpoint_celsius;
+}
+
+// showAlarms lists the active alarms and the recent log entries, newest first
+function showAlarms(active, log) {
+  show("alarms-summary", active.length ? "Active: " + active.join(", ") : "No active alarms");
+  const list = $("alarms");
+  list.replaceChildren();
+  for (const event of log) {
+    const item = document.createElement("li");
+    const phase = ["raised", "cleared", "event"][event.phase] || "phase " + event.phase;
+    item.textContent = new Date(event.time).toLocaleString() + " – alarm " + event.code + " " + phase;
+    list.append(item);
+  }
+}
+
+function showFilter(data) {
+  show("filter-hours", data.hours_since_change + " h");
+  show("filter-remaining", data.change_due ? "change due" : data.remaining_hours + " h");
+  show("filter-next", data.predicted_change ? new Date(data.predicted_change).toLocaleDateString() : "–");
+}
+
+async function refreshDashboard() {
+  const { data } = await api("../dashboard");
+  showTemperatures(data.temperature);
+  showVentilation(data.ventilation, data.setpoint);
+  showAlarms(data.alarms, data.alarm_log);
+  if (data.maintenance) showFilter(data.maintenance);
+}
+
+// drawChart plots indoor and outdoor temperature of the recent samples
+function drawChart() {
+  const canvas = $("chart");
+  const ctx = canvas.getContext("2d");
+  ctx.clearRect(0, 0, canvas.width, canvas.height);
+  if (samples.length < 2) return;
+
+  const values = samples.flatMap((s) => [s.indoor, s.outdoor]);
+  const min = Math.floor(Math.min(...values)) - 1;
+  const max = Math.ceil(Math.max(...values)) + 1;
+  const pad = 30;
+  const x = (i) => pad + (i * (canvas.width - pad)) / (CHART_POINTS - 1);
+  const y = (v) => canvas.height - pad / 2 - ((v - min) * (canvas.height - pad)) / (max - min);
+
+  ctx.fillStyle = "#888";
+  ctx.font = "11px sans-serif";
+  ctx.fillText(max + "°", 2, y(max) + 4);
+  ctx.fillText(min + "°", 2, y(min));
+
+  for (const [key, color] of [["indoor", "#d9534f"], ["outdoor", "#337ab7"]]) {
+    ctx.strokeStyle = color;
+    ctx.lineWidth = 2;
+    ctx.beginPath();
+    samples.forEach((s, i) => (i ? ctx.lineTo(x(i), y(s[key])) : ctx.moveTo(x(i), y(s[key]))));
+    ctx.stroke();
+  }
+}
+
+async function refresh() {
+  try {
+    await refreshDashboard();
+    show("updated", "Updated " + new Date().toLocaleTimeString());
+  } catch (err) {
+    show("updated", "⚠ " + err.message);
+  }
+}
+
+// write sends a change and reports the server's message
+async function write(path, body) {
+  try {
+    const resp = await api(path, "PUT", body);
+    show("result", "✓ " + (resp.message || "Saved"));
+  } catch (err) {
+    show("result", "✗ " + err.message);
+  }
+  refresh();
+}
+
+$("mode-form").addEventListener("submit", (e) => {
+  e.preventDefault();
+  write("../mode", { mode: $("mode-select").value });
+});
+
+$("setpoint-form").addEventListener("submit", (e) => {
+  e.preventDefault();
+  write("../setpoint", { celsius: parseFloat($("setpoint-input").value) });
+});
+
+$("login").addEventListener("submit", (e) => {
+  e.preventDefault();
+  localStorage.setItem("atrea-token", $("token").value);
+  $("login").hidden = true;
+  refresh();
+});
+
+refresh();
+setInterval(refresh, REFRESH_MS);
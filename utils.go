@@ -2,6 +2,9 @@
 
 import (
 	"encoding/xml"
+	"fmt"
+	"math"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -10,11 +13,91 @@ import (
 // DeviceData represents the parsed device configuration
 type DeviceData struct {
 	Items map[string]string
+
+	profile *ParameterProfile // parameter profile of the unit, nil for the built-in map
 }
 
 // AlarmData represents parsed alarm information
 type AlarmData struct {
+	// Alarms maps each alarm code to its latest state: "active", "cleared" or "event"
 	Alarms map[string]string
+	// Events is the alarm log, oldest first
+	Events []AlarmEvent
+}
+
+// AlarmEvent is one entry of the device alarm log (alarms.xml)
+type AlarmEvent struct {
+	Time  time.Time `json:"time"`
+	Code  int       `json:"code"`
+	Phase int       `json:"phase"` // 0 = raised, 1 = cleared, 2 = event without duration
+}
+
+// Alarm log phases
+const (
+	AlarmPhaseRaised  = 0
+	AlarmPhaseCleared = 1
+	AlarmPhaseEvent   = 2
+)
+
+// ParseAlarmsXML parses the response of GetAlarms()
+// Format: <root><errors t="..."><i t="<unix time>" i="<code>" p="<phase>"/>...</errors></root>
+// The log is a ring buffer: unused slots (t="0") are skipped and entries are
+// ordered by time, so each code's state comes from its newest entry.
+func ParseAlarmsXML(xmlStr string) (*AlarmData, error) {
+	var root struct {
+		Errors struct {
+			Items []struct {
+				Time  int64 `xml:"t,attr"`
+				Code  int   `xml:"i,attr"`
+				Phase int   `xml:"p,attr"`
+			} `xml:"i"`
+		} `xml:"errors"`
+	}
+
+	if err := xml.Unmarshal([]byte(xmlStr), &root); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMalformedResponse, err)
+	}
+
+	data := &AlarmData{Alarms: make(map[string]string)}
+	for _, item := range root.Errors.Items {
+		if item.Time == 0 {
+			continue
+		}
+		data.Events = append(data.Events, AlarmEvent{
+			Time:  time.Unix(item.Time, 0),
+			Code:  item.Code,
+			Phase: item.Phase,
+		})
+	}
+	sort.SliceStable(data.Events, func(i, j int) bool {
+		return data.Events[i].Time.Before(data.Events[j].Time)
+	})
+
+	for _, item := range data.Events {
+		state := "event"
+		switch item.Phase {
+		case AlarmPhaseRaised:
+			state = "active"
+		case AlarmPhaseCleared:
+			state = "cleared"
+		}
+		data.Alarms[strconv.Itoa(item.Code)] = state
+	}
+
+	return data, nil
+}
+
+// ActiveAlarms returns the sorted codes of alarms raised and not yet cleared
+func (a *AlarmData) ActiveAlarms() []int {
+	var active []int
+	for code, state := range a.Alarms {
+		if state == "active" {
+			n, _ := strconv.Atoi(code)
+			active = append(active, n)
+		}
+	}
+	sort.Ints(active)
+	return active
 }
 
 // ParseXMLData parses the XML response from GetData()
@@ -46,12 +129,30 @@ func ParseXMLData(xmlStr string) (*DeviceData, error) {
 					Value string `xml:"V,attr"`
 				} `xml:"O"`
 			} `xml:"ENUM_R"`
+			IntegerRW struct {
+				Items []struct {
+					ID    string `xml:"I,attr"`
+					Value string `xml:"V,attr"`
+				} `xml:"O"`
+			} `xml:"INTEGER_RW"`
+			DigitalR struct {
+				Items []struct {
+					ID    string `xml:"I,attr"`
+					Value string `xml:"V,attr"`
+				} `xml:"O"`
+			} `xml:"DIGITAL_R"`
+			DigitalRW struct {
+				Items []struct {
+					ID    string `xml:"I,attr"`
+					Value string `xml:"V,attr"`
+				} `xml:"O"`
+			} `xml:"DIGITAL_RW"`
 		} `xml:"RD5"`
 	}
 
 	err := xml.Unmarshal([]byte(xmlStr), &root)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %w", ErrMalformedResponse, err)
 	}
 
 	data := &DeviceData{
@@ -71,6 +172,16 @@ func ParseXMLData(xmlStr string) (*DeviceData, error) {
 	for _, item := range root.RD5.EnumR.Items {
 		data.Items[item.ID] = item.Value
 	}
+	// Writable holding registers (H*) and coils (C*) plus digital inputs (D*)
+	for _, item := range root.RD5.IntegerRW.Items {
+		data.Items[item.ID] = item.Value
+	}
+	for _, item := range root.RD5.DigitalR.Items {
+		data.Items[item.ID] = item.Value
+	}
+	for _, item := range root.RD5.DigitalRW.Items {
+		data.Items[item.ID] = item.Value
+	}
 
 	return data, nil
 }
@@ -107,6 +218,11 @@ var ParameterNames = map[string]string{
 	"I00001": "Mode",
 	"I00002": "Temperature",
 	"I00004": "Year",
+	"I00005": "Month",
+	"I00006": "Day",
+	"I00007": "Hour",
+	"I00008": "Minute",
+	"I00009": "Second",
 
 	// Temperature Readings (I1xxxx series)
 	"I10211": "Outdoor Air Temperature (T-ODA)",
@@ -134,6 +250,7 @@ var ParameterNames = map[string]string{
 	"I12020": "Filter Hours",
 
 	// Control Parameters (H10xxx, H11xxx, H12xxx series)
+	"H10714": "Fan Power",
 	"H10715": "Operating Mode",
 	"H11010": "Temperature Setpoint Mode 1",
 	"H11017": "Temperature Control Mode",
@@ -142,9 +259,11 @@ var ParameterNames = map[string]string{
 	"H11406": "System Uptime",
 
 	// Date/Time
-	"H10905": "Year",
-	"H10906": "Month",
-	"H10907": "Day",
+	"H10905": "Set Year",
+	"H10906": "Set Month",
+	"H10907": "Set Day",
+	"H10908": "Set Hour",
+	"H10909": "Set Minute",
 
 	// Network & System
 	"H12200": "Network DHCP",
@@ -158,8 +277,14 @@ var ParameterNames = map[string]string{
 	"C10007": "Clear Mode",
 }
 
-// GetParameterName returns the human-readable name for a parameter ID
-func GetParameterName(id string) string {
+// GetParameterName returns the human-readable name for a parameter ID under a
+// profile; a nil profile uses ParameterNames
+func GetParameterName(id string, profile *ParameterProfile) string {
+	if profile != nil {
+		if name, ok := profile.Names[id]; ok {
+			return name
+		}
+	}
 	if name, ok := ParameterNames[id]; ok {
 		return name
 	}
@@ -172,16 +297,11 @@ func GetParameterName(id string) string {
 func (d *DeviceData) GetCurrentTemperature() (float64, error) {
 	tempIDs := []string{"I10215", "I10222", "I10224", "I10225", "I10249"}
 
-	for _, id := range tempIDs {
-		if val, ok := d.Items[id]; ok {
-			temp, err := strconv.ParseFloat(val, 64)
-			if err == nil {
-				return decodeTemperature(temp), nil
-			}
-		}
+	temp, ok := d.decodedTemperature(tempIDs)
+	if !ok {
+		return 0, &ParameterError{Parameter: tempIDs[0], Err: ErrUnknownParameter, Detail: "no indoor temperature reported"}
 	}
-
-	return 0, nil
+	return temp, nil
 }
 
 // GetOutdoorTemperature reads the outdoor air temperature from the device
@@ -190,16 +310,11 @@ func (d *DeviceData) GetCurrentTemperature() (float64, error) {
 func (d *DeviceData) GetOutdoorTemperature() (float64, error) {
 	tempIDs := []string{"I10211", "I10275", "I10282", "I10281"}
 
-	for _, id := range tempIDs {
-		if val, ok := d.Items[id]; ok {
-			temp, err := strconv.ParseFloat(val, 64)
-			if err == nil {
-				return decodeTemperature(temp), nil
-			}
-		}
+	temp, ok := d.decodedTemperature(tempIDs)
+	if !ok {
+		return 0, &ParameterError{Parameter: tempIDs[0], Err: ErrUnknownParameter, Detail: "no outdoor temperature reported"}
 	}
-
-	return 0, nil
+	return temp, nil
 }
 
 // decodeTemperature converts raw device temperature values to Celsius
@@ -225,21 +340,65 @@ func decodeTemperature(rawValue float64) float64 {
 	return 0.0
 }
 
-// GetAllTemperatures returns a map of all temperature-like parameters
+// Temperature range the device encoding can represent, see decodeTemperature
+const (
+	MinEncodedTemperature = -50.0
+	MaxEncodedTemperature = 130.0
+)
+
+// encodeTemperature converts Celsius to the raw device encoding used by decodeTemperature
+// Values are rounded to tenths; negatives use 16-bit two's complement (-0.1°C = 65535).
+// Values outside MinEncodedTemperature..MaxEncodedTemperature return ErrOutOfRange.
+func encodeTemperature(celsius float64) (int, error) {
+	tenths := int(math.Round(celsius * 10))
+	if math.IsNaN(celsius) || tenths < int(MinEncodedTemperature*10) || tenths > int(MaxEncodedTemperature*10) {
+		return 0, fmt.Errorf("temperature %.1f°C: %w (%.0f to %.0f°C)", celsius, ErrOutOfRange, MinEncodedTemperature, MaxEncodedTemperature)
+	}
+	if tenths < 0 {
+		return tenths + 65536, nil
+	}
+	return tenths, nil
+}
+
+// Setpoint limits and resolution accepted by the unit
+const (
+	MinSetpoint        = 10.0
+	MaxSetpoint        = 30.0
+	SetpointResolution = 0.5
+)
+
+// ClampSetpoint rounds a setpoint to the unit's half-degree resolution and clamps it to its range
+func ClampSetpoint(celsius float64) float64 {
+	rounded := math.Round(celsius/SetpointResolution) * SetpointResolution
+	return math.Max(MinSetpoint, math.Min(MaxSetpoint, rounded))
+}
+
+// GetDesiredTemperature decodes the temperature setpoint (H11021) in Celsius
+func (d *DeviceData) GetDesiredTemperature() (float64, error) {
+	val, ok := d.Items[ParamDesiredTemperature]
+	if !ok {
+		return 0, &ParameterError{Parameter: ParamDesiredTemperature, Err: ErrUnknownParameter}
+	}
+	raw, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return 0, &ParameterError{Parameter: ParamDesiredTemperature, Err: ErrMalformedResponse, Detail: fmt.Sprintf("value %q", val)}
+	}
+	return decodeTemperature(raw), nil
+}
+
+// GetAllTemperatures returns all temperature parameters in °C keyed by parameter ID
+// Decoding follows the parameter metadata (see DecodeParameter), so the values
+// match GetCurrentTemperature and GetOutdoorTemperature.
 func (d *DeviceData) GetAllTemperatures() map[string]float64 {
 	temps := make(map[string]float64)
 
-	for id, val := range d.Items {
-		// Temperature parameters typically start with I1 and are 5 digits
-		if strings.HasPrefix(id, "I1") && len(id) == 6 {
-			if temp, err := strconv.ParseFloat(val, 64); err == nil {
-				// Convert from device format (raw value / 100) to Celsius
-				tempCelsius := temp / 100
-				// Only include reasonable temperatures
-				if tempCelsius > -50 && tempCelsius < 100 {
-					name := GetParameterName(id)
-					temps[name] = tempCelsius
-				}
+	for id := range d.Items {
+		if GetParameterInfo(id, d.profile).Kind != KindTemperature {
+			continue
+		}
+		if value, ok := d.Decode(id); ok {
+			if celsius, ok := value.Value.(float64); ok {
+				temps[id] = celsius
 			}
 		}
 	}
@@ -249,10 +408,11 @@ func (d *DeviceData) GetAllTemperatures() map[string]float64 {
 
 // CommonParameters defines common device parameters
 type CommonParameters struct {
-	// Operating mode
-	OperatingMode string // H10715
+	// Operating mode and fan power
+	OperatingMode VentilationMode // H10715
+	FanPower      int             // H10714
 	// Temperature settings
-	DesiredTemperature float64 // H11021
+	DesiredTemperature float64 // H11021 (°C)
 	TemperatureMode    int     // H11017
 	// Date/Time
 	Year  int // H10905
@@ -270,11 +430,15 @@ type CommonParameters struct {
 func (d *DeviceData) ExtractCommonParameters() *CommonParameters {
 	params := &CommonParameters{}
 
-	if val, ok := d.GetValue("H10715"); ok {
-		params.OperatingMode = val
+	if mode, err := d.GetVentilationMode(); err == nil {
+		params.OperatingMode = mode
+	}
+
+	if power, err := d.GetFanPower(); err == nil {
+		params.FanPower = power
 	}
 
-	if val, err := d.GetFloatValue("H11021"); err == nil {
+	if val, err := d.GetDesiredTemperature(); err == nil {
 		params.DesiredTemperature = val
 	}
 
@@ -343,16 +507,41 @@ func NewTemperatureControl(client *WebClient) *TemperatureControl {
 	return &TemperatureControl{client: client}
 }
 
-// SetDesiredTemperature sets the target temperature
+// Temperature control parameters
+const (
+	ParamDesiredTemperature = "H11021" // setpoint in tenths of °C
+	ParamTemperatureMode    = "H11017"
+)
+
+// SetDesiredTemperature sets the target temperature in °C
+// The value is rounded to 0.5°C and clamped to MinSetpoint..MaxSetpoint.
 // mode can be: 0 (off), 1 (heating), 2 (cooling), etc.
 func (tc *TemperatureControl) SetDesiredTemperature(temperature float64, mode int) error {
+	raw, err := encodeTemperature(ClampSetpoint(temperature))
+	if err != nil {
+		return err
+	}
 	params := []string{
-		FormatParam("H11021", int(temperature)),
-		FormatParam("H11017", mode),
+		FormatParam(ParamDesiredTemperature, raw),
+		FormatParam(ParamTemperatureMode, mode),
 	}
 	return tc.client.SetMultipleValues(params)
 }
 
+// SetSetpointVerified sets only the target temperature and confirms it by reading it back
+// It returns the setpoint actually requested after rounding and clamping.
+func (tc *TemperatureControl) SetSetpointVerified(temperature float64, opts VerifyOptions) (float64, []WriteResult, error) {
+	setpoint := ClampSetpoint(temperature)
+	raw, err := encodeTemperature(setpoint)
+	if err != nil {
+		return setpoint, nil, err
+	}
+	results, err := tc.client.SetMultipleValuesVerified([]string{
+		FormatParam(ParamDesiredTemperature, raw),
+	}, opts)
+	return setpoint, results, err
+}
+
 // SystemControl provides convenience methods for system control
 type SystemControl struct {
 	client *WebClient
@@ -365,12 +554,12 @@ func NewSystemControl(client *WebClient) *SystemControl {
 
 // Reset performs a system reset
 func (sc *SystemControl) Reset() error {
-	return sc.client.SetValue(FormatParam("C10005", 1))
+	return sc.client.systemCommand("reset", FormatParam("C10005", 1))
 }
 
 // ClearMode clears the current mode
 func (sc *SystemControl) ClearMode() error {
-	return sc.client.SetValue(FormatParam("C10007", 1))
+	return sc.client.systemCommand("clear_mode", FormatParam("C10007", 1))
 }
 
 // SetTimezone sets the timezone offset (in hours from UTC)
@@ -378,12 +567,14 @@ func (sc *SystemControl) SetTimezone(offsetHours int) error {
 	return sc.client.SetValue(FormatParam("H11400", offsetHours))
 }
 
-// SetSystemTime sets the current system date/time
+// SetSystemTime sets the device date and time of day to t's wall clock
+// The device has no zone of its own, so pass t in the zone the unit should follow
+// (see ClockSync). Seconds are not settable.
 func (sc *SystemControl) SetSystemTime(t time.Time) error {
-	params := []string{
-		FormatParam("H10905", t.Year()),
-		FormatParam("H10906", int(t.Month())),
-		FormatParam("H10907", t.Day()),
+	fields := []int{t.Year(), int(t.Month()), t.Day(), t.Hour(), t.Minute()}
+	params := make([]string, len(setClockParams))
+	for i, id := range setClockParams {
+		params[i] = FormatParam(id, fields[i])
 	}
 	return sc.client.SetMultipleValues(params)
 }
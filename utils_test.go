@@ -1,7 +1,9 @@
 package main
 
 import (
+	"errors"
 	"io/ioutil"
+	"math"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -206,7 +208,7 @@ func TestGetParameterName(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		name := GetParameterName(tt.paramID)
+		name := GetParameterName(tt.paramID, nil)
 		if name != tt.expectedName {
 			t.Errorf("param %s: got name %q, want %q", tt.paramID, name, tt.expectedName)
 		}
@@ -227,3 +229,112 @@ func TestAlarmsParsingWithRealData(t *testing.T) {
 		t.Error("alarms XML missing expected root element")
 	}
 }
+
+// TestEncodeTemperatureRoundTrip tests that encoding is the inverse of decoding
+func TestEncodeTemperatureRoundTrip(t *testing.T) {
+	tests := []struct {
+		celsius float64
+		raw     int
+	}{
+		{21.5, 215},
+		{0.1, 1},
+		{-0.1, 65535},
+		{-1.0, 65526},
+		{-50.0, 65036},
+		{130.0, 1300},
+		{20.04, 200},
+	}
+
+	for _, tt := range tests {
+		raw, err := encodeTemperature(tt.celsius)
+		if err != nil || raw != tt.raw {
+			t.Errorf("encode %.2f°C: got %d, want %d", tt.celsius, raw, tt.raw)
+		}
+		if got := decodeTemperature(float64(raw)); math.Abs(got-math.Round(tt.celsius*10)/10) > 1e-9 {
+			t.Errorf("round trip %.2f°C: got %.1f°C", tt.celsius, got)
+		}
+	}
+
+	for _, celsius := range []float64{-100, -50.1, 130.1, 7000, math.NaN()} {
+		if raw, err := encodeTemperature(celsius); !errors.Is(err, ErrOutOfRange) {
+			t.Errorf("encode %.1f°C: got %d, %v, want ErrOutOfRange", celsius, raw, err)
+		}
+	}
+}
+
+// TestClampSetpoint tests half-degree rounding and range clamping
+func TestClampSetpoint(t *testing.T) {
+	tests := []struct {
+		input, want float64
+	}{
+		{21.5, 21.5},
+		{21.3, 21.5},
+		{21.2, 21.0},
+		{5, MinSetpoint},
+		{35, MaxSetpoint},
+	}
+
+	for _, tt := range tests {
+		if got := ClampSetpoint(tt.input); got != tt.want {
+			t.Errorf("ClampSetpoint(%.1f): got %.1f, want %.1f", tt.input, got, tt.want)
+		}
+	}
+}
+
+// TestDecodeParameter tests metadata driven decoding
+func TestDecodeParameter(t *testing.T) {
+	tests := []struct {
+		id    string
+		raw   string
+		value interface{}
+		unit  string
+	}{
+		{"I10215", "205", 20.5, "°C"},
+		{"I10211", "65526", -1.0, "°C"},
+		{"H11021", "215", 21.5, "°C"},
+		{"H10714", "60", 60, "%"},
+		{"H10715", "2", "ventilation", ""},
+		{"I12020", "857", 857, "h"},
+		{"D00001", "1", true, ""},
+		{"I99999", "42", "42", ""},
+		{"I10215", "n/a", "n/a", ""},
+	}
+
+	for _, tt := range tests {
+		got := DecodeParameter(tt.id, tt.raw, nil)
+		if got.Value != tt.value || got.Unit != tt.unit || got.RawValue != tt.raw {
+			t.Errorf("%s=%s: got %v %q (raw %s), want %v %q", tt.id, tt.raw, got.Value, got.Unit, got.RawValue, tt.value, tt.unit)
+		}
+	}
+}
+
+// TestGetAllTemperaturesConsistent tests that all temperature views share one decoding
+func TestGetAllTemperaturesConsistent(t *testing.T) {
+	configData, err := ioutil.ReadFile(filepath.Join("testdata", "response_config.xml"))
+	if err != nil {
+		t.Skipf("skipping test: cannot load test data (%v)", err)
+	}
+
+	deviceData, err := ParseXMLData(string(configData))
+	if err != nil {
+		t.Fatalf("failed to parse XML: %v", err)
+	}
+
+	temps := deviceData.GetAllTemperatures()
+	indoor, _ := deviceData.GetCurrentTemperature()
+	outdoor, _ := deviceData.GetOutdoorTemperature()
+
+	if temps["I10215"] != indoor {
+		t.Errorf("I10215: GetAllTemperatures %.1f°C, GetCurrentTemperature %.1f°C", temps["I10215"], indoor)
+	}
+	if temps["I10211"] != outdoor {
+		t.Errorf("I10211: GetAllTemperatures %.1f°C, GetOutdoorTemperature %.1f°C", temps["I10211"], outdoor)
+	}
+	for _, id := range []string{"I10222", "I10224"} {
+		if _, ok := deviceData.Items[id]; ok {
+			if _, ok := temps[id]; !ok {
+				t.Errorf("%s missing from GetAllTemperatures (alt names must not collide)", id)
+			}
+		}
+	}
+}
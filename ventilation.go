@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Ventilation parameters (holding registers of the RD5 unit)
+const (
+	ParamOperatingMode = "H10715" // requested/current operating mode
+	ParamFanPower      = "H10714" // requested/current fan power in %
+)
+
+// Fan power limits accepted by the unit (0 switches the fans off)
+const (
+	MinFanPower = 12
+	MaxFanPower = 100
+)
+
+// VentilationMode is the operating mode of the ventilation unit
+type VentilationMode int
+
+const (
+	ModeOff                       VentilationMode = 0
+	ModeAutomatic                 VentilationMode = 1
+	ModeVentilation               VentilationMode = 2
+	ModeCirculationAndVentilation VentilationMode = 3
+	ModeCirculation               VentilationMode = 4
+	ModeNightPrecooling           VentilationMode = 5
+	ModeDisbalance                VentilationMode = 6
+	ModeOverpressure              VentilationMode = 7
+	ModePeriodicVentilation       VentilationMode = 8
+
+	// States reported by the unit that cannot be requested
+	ModeStartup      VentilationMode = 9
+	ModeRundown      VentilationMode = 10
+	ModeDefrosting   VentilationMode = 11
+	ModeExternal     VentilationMode = 12
+	ModeHPDefrosting VentilationMode = 13
+)
+
+var ventilationModeNames = map[VentilationMode]string{
+	ModeOff:                       "off",
+	ModeAutomatic:                 "automatic",
+	ModeVentilation:               "ventilation",
+	ModeCirculationAndVentilation: "circulation_and_ventilation",
+	ModeCirculation:               "circulation",
+	ModeNightPrecooling:           "night_precooling",
+	ModeDisbalance:                "disbalance",
+	ModeOverpressure:              "overpressure",
+	ModePeriodicVentilation:       "periodic_ventilation",
+	ModeStartup:                   "startup",
+	ModeRundown:                   "rundown",
+	ModeDefrosting:                "defrosting",
+	ModeExternal:                  "external",
+	ModeHPDefrosting:              "hp_defrosting",
+}
+
+// String returns the mode name, or "mode_<n>" for undocumented values
+func (m VentilationMode) String() string {
+	if name, ok := ventilationModeNames[m]; ok {
+		return name
+	}
+	return "mode_" + strconv.Itoa(int(m))
+}
+
+// Known reports whether the mode is a documented value
+func (m VentilationMode) Known() bool {
+	_, ok := ventilationModeNames[m]
+	return ok
+}
+
+// Settable reports whether the mode can be requested (as opposed to transient states)
+func (m VentilationMode) Settable() bool {
+	return m >= ModeOff && m <= ModePeriodicVentilation
+}
+
+// MarshalJSON encodes the mode by name
+func (m VentilationMode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.String())
+}
+
+// UnmarshalJSON accepts either the mode name or its numeric value
+func (m *VentilationMode) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		var id int
+		if err := json.Unmarshal(data, &id); err != nil {
+			return fmt.Errorf("mode must be a name or number")
+		}
+		name = strconv.Itoa(id)
+	}
+	mode, err := ParseVentilationMode(name)
+	if err != nil {
+		return err
+	}
+	*m = mode
+	return nil
+}
+
+// ParseVentilationMode parses a mode name (e.g. "ventilation") or number (e.g. "2")
+func ParseVentilationMode(s string) (VentilationMode, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if id, err := strconv.Atoi(s); err == nil {
+		mode := VentilationMode(id)
+		if !mode.Known() {
+			return 0, fmt.Errorf("unknown ventilation mode %d", id)
+		}
+		return mode, nil
+	}
+	for mode, name := range ventilationModeNames {
+		if name == s {
+			return mode, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown ventilation mode %q", s)
+}
+
+// GetVentilationMode decodes the current operating mode (H10715)
+func (d *DeviceData) GetVentilationMode() (VentilationMode, error) {
+	val, ok := d.Items[ParamOperatingMode]
+	if !ok {
+		return 0, &ParameterError{Parameter: ParamOperatingMode, Err: ErrUnknownParameter}
+	}
+	id, err := strconv.Atoi(val)
+	if err != nil {
+		return 0, &ParameterError{Parameter: ParamOperatingMode, Err: ErrMalformedResponse, Detail: fmt.Sprintf("value %q", val)}
+	}
+	return VentilationMode(id), nil
+}
+
+// GetFanPower decodes the current fan power in percent (H10714)
+func (d *DeviceData) GetFanPower() (int, error) {
+	val, ok := d.Items[ParamFanPower]
+	if !ok {
+		return 0, &ParameterError{Parameter: ParamFanPower, Err: ErrUnknownParameter}
+	}
+	power, err := strconv.Atoi(val)
+	if err != nil {
+		return 0, &ParameterError{Parameter: ParamFanPower, Err: ErrMalformedResponse, Detail: fmt.Sprintf("value %q", val)}
+	}
+	return power, nil
+}
+
+// ValidateFanPower checks that power is 0 (off) or within MinFanPower..MaxFanPower
+func ValidateFanPower(power int) error {
+	if power != 0 && (power < MinFanPower || power > MaxFanPower) {
+		return fmt.Errorf("fan power %d%%: %w (0 or %d-%d%%)", power, ErrOutOfRange, MinFanPower, MaxFanPower)
+	}
+	return nil
+}
+
+// VentilationControl provides convenience methods for operating mode and fan power
+type VentilationControl struct {
+	client *WebClient
+}
+
+// NewVentilationControl creates a ventilation control helper
+func NewVentilationControl(client *WebClient) *VentilationControl {
+	return &VentilationControl{client: client}
+}
+
+// SetMode requests an operating mode
+func (vc *VentilationControl) SetMode(mode VentilationMode) error {
+	if !mode.Settable() {
+		return fmt.Errorf("%w: ventilation mode %s cannot be requested", ErrOutOfRange, mode)
+	}
+	return vc.client.SetValue(FormatParam(ParamOperatingMode, int(mode)))
+}
+
+// SetPower requests a fan power in percent
+func (vc *VentilationControl) SetPower(power int) error {
+	if err := ValidateFanPower(power); err != nil {
+		return err
+	}
+	return vc.client.SetValue(FormatParam(ParamFanPower, power))
+}
+
+// Set requests mode and fan power in a single write
+func (vc *VentilationControl) Set(mode VentilationMode, power int) error {
+	if !mode.Settable() {
+		return fmt.Errorf("%w: ventilation mode %s cannot be requested", ErrOutOfRange, mode)
+	}
+	if err := ValidateFanPower(power); err != nil {
+		return err
+	}
+	return vc.client.SetMultipleValues([]string{
+		FormatParam(ParamOperatingMode, int(mode)),
+		FormatParam(ParamFanPower, power),
+	})
+}
+
+// SetModeVerified requests an operating mode and confirms it by reading it back
+func (vc *VentilationControl) SetModeVerified(mode VentilationMode, opts VerifyOptions) ([]WriteResult, error) {
+	if !mode.Settable() {
+		return nil, fmt.Errorf("%w: ventilation mode %s cannot be requested", ErrOutOfRange, mode)
+	}
+	return vc.client.SetMultipleValuesVerified([]string{FormatParam(ParamOperatingMode, int(mode))}, opts)
+}
+
+// SetPowerVerified requests a fan power and confirms it by reading it back
+func (vc *VentilationControl) SetPowerVerified(power int, opts VerifyOptions) ([]WriteResult, error) {
+	if err := ValidateFanPower(power); err != nil {
+		return nil, err
+	}
+	return vc.client.SetMultipleValuesVerified([]string{FormatParam(ParamFanPower, power)}, opts)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestParseVentilationMode tests parsing modes by name and number
+func TestParseVentilationMode(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    VentilationMode
+		wantErr bool
+	}{
+		{"off", ModeOff, false},
+		{"Automatic", ModeAutomatic, false},
+		{"night_precooling", ModeNightPrecooling, false},
+		{"6", ModeDisbalance, false},
+		{"turbo", 0, true},
+		{"99", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseVentilationMode(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: unexpected error state: %v", tt.input, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%q: got %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+// TestVentilationModeJSON tests JSON encoding by name and decoding from name or number
+func TestVentilationModeJSON(t *testing.T) {
+	data, _ := json.Marshal(ModeVentilation)
+	if string(data) != `"ventilation"` {
+		t.Errorf("got %s, want \"ventilation\"", data)
+	}
+
+	var req ModeRequest
+	if err := json.Unmarshal([]byte(`{"mode": 4}`), &req); err != nil || req.Mode != ModeCirculation {
+		t.Errorf("numeric mode: got %s (%v), want circulation", req.Mode, err)
+	}
+	if err := json.Unmarshal([]byte(`{"mode": "boost"}`), &req); err == nil {
+		t.Error("expected error for unknown mode name")
+	}
+}
+
+// TestVentilationFromRealData tests decoding mode and power from the captured response
+func TestVentilationFromRealData(t *testing.T) {
+	configData, err := os.ReadFile(filepath.Join("testdata", "response_config.xml"))
+	if err != nil {
+		t.Skipf("skipping test: cannot load test data (%v)", err)
+	}
+
+	deviceData, err := ParseXMLData(string(configData))
+	if err != nil {
+		t.Fatalf("failed to parse XML: %v", err)
+	}
+
+	mode, err := deviceData.GetVentilationMode()
+	if err != nil {
+		t.Fatalf("failed to get mode: %v", err)
+	}
+	if mode != ModeAutomatic {
+		t.Errorf("got mode %s, want automatic", mode)
+	}
+
+	power, err := deviceData.GetFanPower()
+	if err != nil {
+		t.Fatalf("failed to get power: %v", err)
+	}
+	if power < 0 || power > 100 {
+		t.Errorf("unreasonable fan power: %d%%", power)
+	}
+}
+
+// TestModeAndPowerEndpoints tests PUT /mode and /power against a mock device
+func TestModeAndPowerEndpoints(t *testing.T) {
+	var written []string
+	values := map[string]string{"H10715": "2", "H10714": "60"}
+	device := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/config/xml.cgi" {
+			for key, v := range r.URL.Query() {
+				if key != "auth" {
+					written = append(written, key+"="+v[0])
+					values[key] = v[0]
+				}
+			}
+			return
+		}
+		fmt.Fprintf(w, `<RD5WEB><RD5><INTEGER_RW><O I="H10715" V="%s"/><O I="H10714" V="%s"/></INTEGER_RW></RD5></RD5WEB>`,
+			values["H10715"], values["H10714"])
+	}))
+	defer device.Close()
+
+	server := newTestServer(t, device.URL)
+	handler := server.Handler()
+
+	tests := []struct {
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantWrite  string
+	}{
+		{"PUT", "/mode", `{"mode": "circulation"}`, http.StatusOK, "H10715=4"},
+		{"PUT", "/mode", `{"mode": "defrosting"}`, http.StatusBadRequest, ""},
+		{"PUT", "/power", `{"power": 55}`, http.StatusOK, "H10714=55"},
+		{"PUT", "/power", `{"power": 5}`, http.StatusBadRequest, ""},
+		{"PUT", "/power", `{}`, http.StatusBadRequest, ""},
+		{"DELETE", "/mode", ``, http.StatusMethodNotAllowed, ""},
+	}
+
+	for _, tt := range tests {
+		written = nil
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s %s %s: expected status %d, got %d", tt.method, tt.path, tt.body, tt.wantStatus, w.Code)
+		}
+		if tt.wantWrite != "" && (len(written) != 1 || written[0] != tt.wantWrite) {
+			t.Errorf("%s %s %s: device writes %v, want [%s]", tt.method, tt.path, tt.body, written, tt.wantWrite)
+		}
+		if tt.wantWrite == "" && len(written) != 0 {
+			t.Errorf("%s %s %s: unexpected device writes %v", tt.method, tt.path, tt.body, written)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/mode", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	var result struct {
+		Data VentilationResponse `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if result.Data.Mode != ModeCirculation || result.Data.Power != 55 {
+		t.Errorf("GET /mode: got %s/%d%%, want circulation/55%%", result.Data.Mode, result.Data.Power)
+	}
+}
@@ -1,32 +1,50 @@
 package main
 
 import (
-	"crypto/md5"
+	"errors"
 	"fmt"
-	"io"
+	"log"
 	"math/rand"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 // WebClient provides access to the Atrea RD5 web API
 type WebClient struct {
 	baseURL    string
-	auth       string
+	session    *deviceSession // login shared with WithCaller/WithPriority copies
 	httpClient *http.Client
+	audit      *AuditLog          // records every change when set, see SetAuditLog
+	caller     string             // identity recorded in the audit log, see WithCaller
+	retry      RetryPolicy        // retries of idempotent reads, see SetRetryPolicy
+	breaker    *CircuitBreaker    // fails fast while the device is unreachable, see SetCircuitBreaker
+	queue      *DeviceQueue       // serialises requests to the device, see SetQueue
+	priority   Priority           // queue priority of reads, see WithPriority
+	snapshot   func() *DeviceData // latest polled values, see SetSnapshotSource
 }
 
 // NewWebClient creates a new web client for the Atrea RD5
 func NewWebClient(ip string) *WebClient {
 	return &WebClient{
 		baseURL:    "http://" + ip,
+		session:    &deviceSession{},
 		httpClient: &http.Client{Timeout: 10 * time.Second},
 	}
 }
 
+// deviceSession is the device login shared by a client and its copies
+type deviceSession struct {
+	mutex sync.RWMutex
+	id    string
+
+	renewMutex sync.Mutex   // one renewal at a time
+	renew      func() error // logs in again, see SetSessionRenewal
+}
+
 // Login authenticates with the device using the password
 //
 // AUTHENTICATION FLOW:
@@ -46,10 +64,12 @@ func NewWebClient(ip string) *WebClient {
 func (wc *WebClient) Login(password string) (string, error) {
 	// STEP 1: Create MD5 hash of "\r\n" + password
 	// CRITICAL: The hash input is the literal string with actual carriage return and newline
-	hash := md5.New()
-	io.WriteString(hash, "\r\n"+password)
-	magic := fmt.Sprintf("%x", hash.Sum(nil))
+	return wc.LoginMagic(PasswordMagic(password))
+}
 
+// LoginMagic authenticates with a pre-computed login magic (see PasswordMagic)
+// This lets deployments store only the hash instead of the cleartext password.
+func (wc *WebClient) LoginMagic(magic string) (string, error) {
 	// STEP 2: Generate random number for nonce (prevents replay attacks, any random digits work)
 	randStr := generateRandomString(3)
 
@@ -58,13 +78,8 @@ func (wc *WebClient) Login(password string) (string, error) {
 	params.Set("magic", magic)
 	params.Set("rnd", randStr)
 
-	resp, err := wc.httpClient.Get(wc.baseURL + "/config/login.cgi?" + params.Encode())
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
+	// Logging in again only replaces the session, so the request is retried like a read
+	_, body, err := wc.get(wc.baseURL+"/config/login.cgi?"+params.Encode(), true)
 	if err != nil {
 		return "", err
 	}
@@ -84,7 +99,7 @@ func (wc *WebClient) Login(password string) (string, error) {
 				// Validate: must not be empty, "0", or "denied"; must be numeric
 				if sessionID != "" && sessionID != "0" && sessionID != "denied" {
 					if _, err := strconv.Atoi(sessionID); err == nil {
-						wc.auth = sessionID
+						wc.SetSessionID(sessionID)
 						return sessionID, nil
 					}
 				}
@@ -93,88 +108,317 @@ func (wc *WebClient) Login(password string) (string, error) {
 	}
 
 	// If we got here, either parsing failed or response was "denied"
-	return "", fmt.Errorf("authentication failed: invalid response from device")
+	if strings.Contains(responseStr, "denied") || strings.Contains(responseStr, ">0</root>") {
+		return "", fmt.Errorf("authentication failed: %w", ErrAuthDenied)
+	}
+	return "", fmt.Errorf("authentication failed: %w: invalid login response", ErrMalformedResponse)
 
 } // GetData retrieves the XML configuration data from the device
 func (wc *WebClient) GetData() (string, error) {
-	params := url.Values{}
-	if wc.auth != "" {
-		params.Set("auth", wc.auth)
+	return wc.read("/config/xml.xml")
+}
+
+// read fetches a device document with the current session, logging in
+// again once if the device no longer accepts it
+func (wc *WebClient) read(endpoint string) (string, error) {
+	var body string
+	err := wc.withSession(func(sessionID string) error {
+		params := url.Values{}
+		if sessionID != "" {
+			params.Set("auth", sessionID)
+		}
+		params.Set("rnd", generateRandomString(2))
+
+		_, response, err := wc.get(wc.baseURL+endpoint+"?"+params.Encode(), true)
+		if err != nil {
+			return err
+		}
+		if sessionDenied(response) {
+			return ErrSessionExpired
+		}
+		body = string(response)
+		return nil
+	})
+	return body, err
+}
+
+// withSession runs fn with the current session ID and, when the device
+// reports the session expired, renews it and runs fn once more
+func (wc *WebClient) withSession(fn func(sessionID string) error) error {
+	sessionID := wc.GetSessionID()
+	err := fn(sessionID)
+	if errors.Is(err, ErrSessionExpired) && wc.renewSession(sessionID) {
+		err = fn(wc.GetSessionID())
 	}
-	params.Set("rnd", generateRandomString(2))
+	return err
+}
 
-	resp, err := wc.httpClient.Get(wc.baseURL + "/config/xml.xml?" + params.Encode())
-	if err != nil {
-		return "", err
+// renewSession logs in again after the device rejected stale; it reports
+// whether a new session is available
+func (wc *WebClient) renewSession(stale string) bool {
+	s := wc.session
+	if s.renew == nil {
+		return false
+	}
+	s.renewMutex.Lock()
+	defer s.renewMutex.Unlock()
+	if current := wc.GetSessionID(); current != stale && current != "" {
+		return true // renewed by a concurrent request
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	return string(body), err
+	log.Printf("🔧 Device session expired, logging in again")
+	if err := s.renew(); err != nil {
+		log.Printf("✗ Session renewal failed: %v", err)
+		return false
+	}
+	return true
+}
+
+// sessionDenied reports whether the device answered a read with the
+// <root>denied</root> document it also sends for a refused login
+func sessionDenied(body []byte) bool {
+	response := string(body)
+	return !strings.Contains(response, "<RD5WEB") && strings.Contains(response, ">denied</root>")
 }
 
 // SetValue sends a parameter update to the device
 // Parameter should be in format like "H12345=1000"
 func (wc *WebClient) SetValue(parameter string) error {
-	params := url.Values{}
-	params.Set("auth", wc.auth)
-	params.Set(strings.Split(parameter, "=")[0], strings.Split(parameter, "=")[1])
-
-	resp, err := wc.httpClient.Get(wc.baseURL + "/config/xml.cgi?" + params.Encode())
-	if err != nil {
+	if err := checkWritable([]string{parameter}); err != nil {
 		return err
 	}
-	defer resp.Body.Close()
+	previous := wc.auditPrevious()
+	err := wc.setValue(parameter)
+	wc.auditWrites(AuditWrite, "", []string{parameter}, previous, err)
+	return err
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to set value: status %d", resp.StatusCode)
-	}
+// systemCommand sends a command parameter and audits it as a system command
+func (wc *WebClient) systemCommand(command, parameter string) error {
+	err := wc.setValue(parameter)
+	wc.auditWrites(AuditSystem, command, []string{parameter}, nil, err)
+	return err
+}
 
-	return nil
+func (wc *WebClient) setValue(parameter string) error {
+	return wc.withSession(func(sessionID string) error {
+		params := url.Values{}
+		params.Set("auth", sessionID)
+		params.Set(splitParam(parameter))
+
+		status, _, err := wc.get(wc.baseURL+"/config/xml.cgi?"+params.Encode(), false)
+		if err != nil {
+			return err
+		}
+		if status != http.StatusOK {
+			return fmt.Errorf("failed to set value: %w: status %d", ErrMalformedResponse, status)
+		}
+
+		return nil
+	})
 }
 
 // SetMultipleValues sends multiple parameter updates to the device
 // Parameters should be in format like []string{"H12345=1000", "H12346=2000"}
 func (wc *WebClient) SetMultipleValues(parameters []string) error {
-	params := url.Values{}
-	params.Set("auth", wc.auth)
+	if err := checkWritable(parameters); err != nil {
+		return err
+	}
+	previous := wc.auditPrevious()
+	err := wc.setMultipleValues(parameters)
+	wc.auditWrites(AuditWrite, "", parameters, previous, err)
+	return err
+}
+
+func (wc *WebClient) setMultipleValues(parameters []string) error {
+	return wc.withSession(func(sessionID string) error {
+		params := url.Values{}
+		params.Set("auth", sessionID)
+
+		for _, param := range parameters {
+			params.Set(splitParam(param))
+		}
+
+		status, _, err := wc.get(wc.baseURL+"/config/xml.cgi?"+params.Encode(), false)
+		if err != nil {
+			return err
+		}
+		if status != http.StatusOK {
+			return fmt.Errorf("failed to set values: %w: status %d", ErrMalformedResponse, status)
+		}
+
+		return nil
+	})
+}
+
+// WriteResult reports the outcome of one parameter of a verified write
+type WriteResult struct {
+	Parameter  string `json:"parameter"`
+	Requested  string `json:"requested"`
+	Previous   string `json:"previous,omitempty"`
+	Actual     string `json:"actual"`
+	Applied    bool   `json:"applied"`
+	RolledBack bool   `json:"rolled_back,omitempty"`
+}
+
+// VerifyOptions controls SetMultipleValuesVerified
+type VerifyOptions struct {
+	// Rollback restores the previous values of applied parameters when
+	// any parameter of the batch did not take effect
+	Rollback bool
+	// Attempts is how many times xml.xml is read back before giving up (default 1)
+	Attempts int
+	// Interval is the wait before each read-back, giving the unit time to apply values
+	Interval time.Duration
+}
 
+// SetMultipleValuesVerified writes parameters and reads xml.xml back to check
+// that each value took effect. The RD5 answers 200 even when it ignores a value,
+// so this is the only reliable way to know a write succeeded.
+// It returns one result per requested parameter and an error if any was not applied.
+func (wc *WebClient) SetMultipleValuesVerified(parameters []string, opts VerifyOptions) ([]WriteResult, error) {
+	if opts.Attempts < 1 {
+		opts.Attempts = 1
+	}
+
+	results := make([]WriteResult, 0, len(parameters))
 	for _, param := range parameters {
 		parts := strings.Split(param, "=")
-		if len(parts) == 2 {
-			params.Set(parts[0], parts[1])
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid parameter %q (want ID=VALUE)", param)
 		}
+		results = append(results, WriteResult{Parameter: parts[0], Requested: parts[1]})
+	}
+	if err := checkWritable(parameters); err != nil {
+		return nil, err
 	}
 
-	resp, err := wc.httpClient.Get(wc.baseURL + "/config/xml.cgi?" + params.Encode())
+	// Capture previous values so a failed batch can be rolled back
+	var previous map[string]string
+	if opts.Rollback {
+		before, err := wc.readParameters()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read values before write: %w", err)
+		}
+		for i := range results {
+			results[i].Previous = before.Items[results[i].Parameter]
+		}
+		previous = before.Items
+	} else {
+		previous = wc.auditPrevious()
+	}
+
+	err := wc.setMultipleValues(parameters)
+	wc.auditWrites(AuditWrite, "", parameters, previous, err)
 	if err != nil {
-		return err
+		return results, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to set values: status %d", resp.StatusCode)
+	failed, err := wc.verifyResults(results, opts)
+	if err != nil {
+		return results, fmt.Errorf("failed to read back values: %w", err)
+	}
+	if failed == 0 {
+		return results, nil
 	}
 
-	return nil
+	if opts.Rollback {
+		if err := wc.rollback(results, opts); err != nil {
+			log.Printf("✗ Rollback after unapplied write failed: %v", err)
+			return results, fmt.Errorf("%w: %d of %d parameters; %w: %v", ErrNotApplied, failed, len(results), ErrRollbackFailed, err)
+		}
+	}
+
+	return results, fmt.Errorf("%w: %d of %d parameters", ErrNotApplied, failed, len(results))
 }
 
-// GetAlarms retrieves alarm information from the device
-func (wc *WebClient) GetAlarms() (string, error) {
-	params := url.Values{}
-	if wc.auth != "" {
-		params.Set("auth", wc.auth)
+// verifyResults reads back the device until every value matches or attempts run out
+func (wc *WebClient) verifyResults(results []WriteResult, opts VerifyOptions) (int, error) {
+	failed := len(results)
+	for attempt := 0; attempt < opts.Attempts && failed > 0; attempt++ {
+		time.Sleep(opts.Interval)
+
+		after, err := wc.readParameters()
+		if err != nil {
+			return failed, err
+		}
+
+		failed = 0
+		for i := range results {
+			results[i].Actual = after.Items[results[i].Parameter]
+			results[i].Applied = sameValue(results[i].Actual, results[i].Requested)
+			if !results[i].Applied {
+				failed++
+			}
+		}
 	}
-	params.Set("rnd", generateRandomString(2))
+	return failed, nil
+}
 
-	resp, err := wc.httpClient.Get(wc.baseURL + "/config/alarms.xml?" + params.Encode())
+// rollback restores previous values of the parameters that were applied
+// It returns an error when the restore write or its read-back failed, or
+// when a value did not return to its previous state.
+func (wc *WebClient) rollback(results []WriteResult, opts VerifyOptions) error {
+	var restore []string
+	for _, result := range results {
+		if result.Applied && result.Previous != "" && !sameValue(result.Previous, result.Requested) {
+			restore = append(restore, FormatParam(result.Parameter, result.Previous))
+		}
+	}
+	if len(restore) == 0 {
+		return nil
+	}
+
+	if err := wc.SetMultipleValues(restore); err != nil {
+		return fmt.Errorf("failed to restore values: %w", err)
+	}
+
+	time.Sleep(opts.Interval)
+	after, err := wc.readParameters()
 	if err != nil {
-		return "", err
+		return fmt.Errorf("failed to read back restored values: %w", err)
+	}
+	var stuck []string
+	for i := range results {
+		r := &results[i]
+		if !r.Applied || r.Previous == "" || sameValue(r.Previous, r.Requested) {
+			continue
+		}
+		r.Actual = after.Items[r.Parameter]
+		if sameValue(r.Actual, r.Previous) {
+			r.RolledBack = true
+		} else {
+			stuck = append(stuck, r.Parameter)
+		}
+	}
+	if len(stuck) > 0 {
+		return fmt.Errorf("%s not restored", strings.Join(stuck, ", "))
 	}
-	defer resp.Body.Close()
+	return nil
+}
 
-	body, err := io.ReadAll(resp.Body)
-	return string(body), err
+// readParameters fetches and parses xml.xml
+func (wc *WebClient) readParameters() (*DeviceData, error) {
+	data, err := wc.GetData()
+	if err != nil {
+		return nil, err
+	}
+	return ParseXMLData(data)
+}
+
+// sameValue compares parameter values numerically when possible ("021" == "21")
+func sameValue(a, b string) bool {
+	if a == b {
+		return true
+	}
+	fa, errA := strconv.ParseFloat(a, 64)
+	fb, errB := strconv.ParseFloat(b, 64)
+	return errA == nil && errB == nil && fa == fb
+}
+
+// GetAlarms retrieves alarm information from the device
+func (wc *WebClient) GetAlarms() (string, error) {
+	return wc.read("/config/alarms.xml")
 }
 
 // GetWeeklyProgram retrieves weekly program settings
@@ -195,29 +439,26 @@ func (wc *WebClient) GetWeeklyProgram(deviceType, programType string) (string, e
 			endpoint = "/config/rgnssetup.xml"
 		}
 	} else {
-		return "", fmt.Errorf("invalid device type: %s", deviceType)
-	}
-
-	params := url.Values{}
-	if wc.auth != "" {
-		params.Set("auth", wc.auth)
-	}
-	params.Set("rnd", generateRandomString(2))
-
-	resp, err := wc.httpClient.Get(wc.baseURL + endpoint + "?" + params.Encode())
-	if err != nil {
-		return "", err
+		return "", fmt.Errorf("%w: invalid device type %s", ErrOutOfRange, deviceType)
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	return string(body), err
+	return wc.read(endpoint)
 }
 
 // SetWeeklyProgram updates weekly program settings
 // deviceType can be "RTS" or "RNS"
 // programType can be "vzt" or "izt"
 func (wc *WebClient) SetWeeklyProgram(deviceType, programType, data string) error {
+	var previous string
+	if wc.audit != nil {
+		previous, _ = wc.GetWeeklyProgram(deviceType, programType)
+	}
+	err := wc.setWeeklyProgram(deviceType, programType, data)
+	wc.auditChange(AuditSchedule, deviceType+"/"+programType, previous, data, err)
+	return err
+}
+
+func (wc *WebClient) setWeeklyProgram(deviceType, programType, data string) error {
 	var endpoint string
 	if deviceType == "RTS" {
 		if programType == "vzt" {
@@ -232,82 +473,89 @@ func (wc *WebClient) SetWeeklyProgram(deviceType, programType, data string) erro
 			endpoint = "/config/rgnssetup.cgi"
 		}
 	} else {
-		return fmt.Errorf("invalid device type: %s", deviceType)
+		return fmt.Errorf("%w: invalid device type %s", ErrOutOfRange, deviceType)
 	}
 
-	params := url.Values{}
-	params.Set("auth", wc.auth)
-	params.Set("rnd", generateRandomString(2))
+	return wc.withSession(func(sessionID string) error {
+		params := url.Values{}
+		params.Set("auth", sessionID)
+		params.Set("rnd", generateRandomString(2))
 
-	// Append data to query string
-	fullURL := wc.baseURL + endpoint + "?" + params.Encode() + "&" + data
+		// Append data to query string
+		fullURL := wc.baseURL + endpoint + "?" + params.Encode() + "&" + data
 
-	resp, err := wc.httpClient.Get(fullURL)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to set weekly program: status %d", resp.StatusCode)
-	}
+		status, _, err := wc.get(fullURL, false)
+		if err != nil {
+			return err
+		}
+		if status != http.StatusOK {
+			return fmt.Errorf("failed to set weekly program: %w: status %d", ErrMalformedResponse, status)
+		}
 
-	return nil
+		return nil
+	})
 }
 
 // GetNetworkSettings retrieves network configuration
 func (wc *WebClient) GetNetworkSettings() (string, error) {
-	params := url.Values{}
-	if wc.auth != "" {
-		params.Set("auth", wc.auth)
-	}
-	params.Set("rnd", generateRandomString(2))
-
-	resp, err := wc.httpClient.Get(wc.baseURL + "/config/ip.cgi?" + params.Encode())
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	return string(body), err
+	return wc.read("/config/ip.cgi")
 }
 
 // SetNetworkSettings updates network configuration
 // Example: "dhcp=1" or "dhcp=0&ip=192168068106&ip4mask=255255255000..."
 func (wc *WebClient) SetNetworkSettings(settings string) error {
-	params := url.Values{}
-	params.Set("auth", wc.auth)
-	params.Set("rnd", generateRandomString(2))
+	var previous string
+	if wc.audit != nil {
+		previous, _ = wc.GetNetworkSettings()
+	}
+	err := wc.setNetworkSettings(settings)
+	wc.auditChange(AuditNetwork, "ip.cgi", previous, settings, err)
+	return err
+}
 
-	fullURL := wc.baseURL + "/config/ip.cgi?" + params.Encode() + "&" + settings
+func (wc *WebClient) setNetworkSettings(settings string) error {
+	return wc.withSession(func(sessionID string) error {
+		params := url.Values{}
+		params.Set("auth", sessionID)
+		params.Set("rnd", generateRandomString(2))
 
-	resp, err := wc.httpClient.Get(fullURL)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
+		fullURL := wc.baseURL + "/config/ip.cgi?" + params.Encode() + "&" + settings
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to set network settings: status %d", resp.StatusCode)
-	}
+		status, _, err := wc.get(fullURL, false)
+		if err != nil {
+			return err
+		}
+		if status != http.StatusOK {
+			return fmt.Errorf("failed to set network settings: %w: status %d", ErrMalformedResponse, status)
+		}
 
-	return nil
+		return nil
+	})
 }
 
 // IsAuthenticated returns whether the client has an active session
 func (wc *WebClient) IsAuthenticated() bool {
-	return wc.auth != ""
+	return wc.GetSessionID() != ""
 }
 
 // GetSessionID returns the current session ID (auth token)
 func (wc *WebClient) GetSessionID() string {
-	return wc.auth
+	wc.session.mutex.RLock()
+	defer wc.session.mutex.RUnlock()
+	return wc.session.id
 }
 
 // SetSessionID sets the session ID manually (useful for restoring sessions)
 func (wc *WebClient) SetSessionID(sessionID string) {
-	wc.auth = sessionID
+	wc.session.mutex.Lock()
+	defer wc.session.mutex.Unlock()
+	wc.session.id = sessionID
+}
+
+// SetSessionRenewal makes the client call renew to log in again, once per
+// request, when the device reports the session expired
+func (wc *WebClient) SetSessionRenewal(renew func() error) {
+	wc.session.renew = renew
 }
 
 // Helper function to generate random string (like the JS randStr function)
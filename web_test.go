@@ -2,11 +2,13 @@ package main
 
 import (
 	"crypto/md5"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -112,7 +114,7 @@ func TestGetData(t *testing.T) {
 
 	client := NewWebClient(server.Listener.Addr().String())
 	client.baseURL = server.URL
-	client.auth = "12345"
+	client.SetSessionID("12345")
 
 	data, err := client.GetData()
 	if err != nil {
@@ -140,7 +142,7 @@ func TestGetAlarms(t *testing.T) {
 
 	client := NewWebClient(server.Listener.Addr().String())
 	client.baseURL = server.URL
-	client.auth = "12345"
+	client.SetSessionID("12345")
 
 	data, err := client.GetAlarms()
 	if err != nil {
@@ -174,7 +176,7 @@ func TestSetValue(t *testing.T) {
 
 	client := NewWebClient(server.Listener.Addr().String())
 	client.baseURL = server.URL
-	client.auth = "12345"
+	client.SetSessionID("12345")
 
 	err := client.SetValue("H11021=21")
 	if err != nil {
@@ -195,3 +197,206 @@ func TestIsAuthenticated(t *testing.T) {
 		t.Error("should be authenticated with session ID")
 	}
 }
+
+// fakeDevice is a mock RD5 that stores written parameters and can ignore some of them
+type fakeDevice struct {
+	values  map[string]string
+	ignored map[string]bool
+	writes  [][]string
+}
+
+func (d *fakeDevice) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/config/xml.cgi":
+		var batch []string
+		for key, v := range r.URL.Query() {
+			if key == "auth" || key == "rnd" {
+				continue
+			}
+			batch = append(batch, key+"="+v[0])
+			if !d.ignored[key] {
+				d.values[key] = v[0]
+			}
+		}
+		d.writes = append(d.writes, batch)
+	case "/config/xml.xml":
+		fmt.Fprint(w, `<RD5WEB><RD5><INTEGER_RW>`)
+		for id, v := range d.values {
+			fmt.Fprintf(w, `<O I="%s" V="%s"/>`, id, v)
+		}
+		fmt.Fprint(w, `</INTEGER_RW></RD5></RD5WEB>`)
+	}
+}
+
+// TestSetMultipleValuesVerified tests read-back verification of a successful write
+func TestSetMultipleValuesVerified(t *testing.T) {
+	device := &fakeDevice{values: map[string]string{"H10714": "50", "H10715": "1"}}
+	server := httptest.NewServer(device)
+	defer server.Close()
+
+	client := NewWebClient(server.Listener.Addr().String())
+	client.baseURL = server.URL
+	client.SetSessionID("12345")
+
+	results, err := client.SetMultipleValuesVerified([]string{"H10714=80", "H10715=2"}, VerifyOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, result := range results {
+		if !result.Applied || result.Actual != result.Requested {
+			t.Errorf("%s: got %+v, want applied", result.Parameter, result)
+		}
+	}
+}
+
+// TestSetMultipleValuesVerifiedRollback tests that an ignored value fails the batch and rolls back the rest
+func TestSetMultipleValuesVerifiedRollback(t *testing.T) {
+	device := &fakeDevice{
+		values:  map[string]string{"H10714": "50", "H10715": "1"},
+		ignored: map[string]bool{"H10715": true},
+	}
+	server := httptest.NewServer(device)
+	defer server.Close()
+
+	client := NewWebClient(server.Listener.Addr().String())
+	client.baseURL = server.URL
+	client.SetSessionID("12345")
+
+	results, err := client.SetMultipleValuesVerified([]string{"H10714=80", "H10715=2"}, VerifyOptions{Rollback: true})
+	if err == nil {
+		t.Fatal("expected error for ignored parameter, got nil")
+	}
+
+	byID := make(map[string]WriteResult)
+	for _, result := range results {
+		byID[result.Parameter] = result
+	}
+
+	if r := byID["H10715"]; r.Applied || r.Actual != "1" {
+		t.Errorf("H10715: got %+v, want not applied with actual 1", r)
+	}
+	if r := byID["H10714"]; !r.Applied || !r.RolledBack || r.Previous != "50" {
+		t.Errorf("H10714: got %+v, want applied and rolled back from 50", r)
+	}
+	if device.values["H10714"] != "50" {
+		t.Errorf("H10714 on device: got %s, want 50 after rollback", device.values["H10714"])
+	}
+	if len(device.writes) != 2 {
+		t.Errorf("expected write and rollback, got %d writes", len(device.writes))
+	}
+}
+
+// TestSetMultipleValuesVerifiedRollbackFailed tests that a failed rollback is reported
+func TestSetMultipleValuesVerifiedRollbackFailed(t *testing.T) {
+	device := &fakeDevice{
+		values:  map[string]string{"H10714": "50", "H10715": "1"},
+		ignored: map[string]bool{"H10715": true},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/config/xml.cgi" && len(device.writes) > 0 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		device.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	client := NewWebClient(server.Listener.Addr().String())
+	client.baseURL = server.URL
+	client.SetSessionID("12345")
+	client.SetRetryPolicy(RetryPolicy{Attempts: 1})
+
+	results, err := client.SetMultipleValuesVerified([]string{"H10714=80", "H10715=2"}, VerifyOptions{Rollback: true})
+	if !errors.Is(err, ErrNotApplied) || !errors.Is(err, ErrRollbackFailed) {
+		t.Fatalf("got %v, want not applied and rollback failed", err)
+	}
+	for _, result := range results {
+		if result.RolledBack {
+			t.Errorf("%s: reported as rolled back", result.Parameter)
+		}
+	}
+	if device.values["H10714"] != "80" {
+		t.Errorf("H10714 on device: got %s, want 80", device.values["H10714"])
+	}
+}
+
+// TestSetDesiredTemperatureEncoding tests that setpoints are sent in tenths of a degree
+func TestSetDesiredTemperatureEncoding(t *testing.T) {
+	device := &fakeDevice{values: map[string]string{}}
+	server := httptest.NewServer(device)
+	defer server.Close()
+
+	client := NewWebClient(server.Listener.Addr().String())
+	client.baseURL = server.URL
+	client.SetSessionID("12345")
+
+	if err := NewTemperatureControl(client).SetDesiredTemperature(21.5, 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if device.values["H11021"] != "215" {
+		t.Errorf("H11021: got %s, want 215", device.values["H11021"])
+	}
+
+	setpoint, _, err := NewTemperatureControl(client).SetSetpointVerified(40, VerifyOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if setpoint != MaxSetpoint || device.values["H11021"] != "300" {
+		t.Errorf("clamped setpoint: got %.1f°C (raw %s), want %.1f°C (raw 300)", setpoint, device.values["H11021"], MaxSetpoint)
+	}
+}
+
+// TestSessionRenewal tests that every read detects a denied session and that
+// the client logs in again once and retries
+func TestSessionRenewal(t *testing.T) {
+	var mutex sync.Mutex
+	logins := 0
+	device := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if r.URL.Path == "/config/login.cgi" {
+			logins++
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><root lng="0">22222</root>`)
+			return
+		}
+		if r.URL.Query().Get("auth") != "22222" {
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><root>denied</root>`)
+			return
+		}
+		fmt.Fprint(w, `<root><errors></errors></root>`)
+	}))
+	defer device.Close()
+
+	client := NewWebClient(device.Listener.Addr().String())
+	client.baseURL = device.URL
+	client.SetSessionID("11111")
+
+	reads := map[string]func() (string, error){
+		"alarms":   client.GetAlarms,
+		"network":  client.GetNetworkSettings,
+		"schedule": func() (string, error) { return client.GetWeeklyProgram("RTS", "vzt") },
+	}
+	for name, read := range reads {
+		if _, err := read(); !errors.Is(err, ErrSessionExpired) {
+			t.Errorf("%s without renewal: got %v, want ErrSessionExpired", name, err)
+		}
+	}
+
+	client.SetSessionRenewal(func() error {
+		_, err := client.LoginMagic("magic")
+		return err
+	})
+	// A copy renews the session for the client it was made from
+	if _, err := client.WithCaller("alice").GetAlarms(); err != nil {
+		t.Errorf("copy after renewal: %v", err)
+	}
+	for name, read := range reads {
+		if _, err := read(); err != nil {
+			t.Errorf("%s after renewal: %v", name, err)
+		}
+	}
+	if logins != 1 || client.GetSessionID() != "22222" {
+		t.Errorf("got %d logins and session %q, want one login shared with copies", logins, client.GetSessionID())
+	}
+}
@@ -0,0 +1,487 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WebSocket frame opcodes (RFC 6455 section 5.2)
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+)
+
+// websocketGUID is appended to the client key to compute Sec-WebSocket-Accept
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	wsMaxMessage   = 64 << 10         // largest command accepted from a client
+	wsPingInterval = 30 * time.Second // keeps proxies from closing idle connections
+	wsReadTimeout  = 2 * wsPingInterval
+	wsWriteTimeout = 10 * time.Second
+)
+
+var (
+	errNotWebSocket  = errors.New("expected a WebSocket upgrade")
+	errWebSocketData = errors.New("websocket protocol error")
+	errCrossOrigin   = errors.New("cross-origin WebSocket upgrade")
+)
+
+// wsConn is a server-side WebSocket connection
+// Reads happen on one goroutine; writes may come from any.
+type wsConn struct {
+	conn      net.Conn
+	reader    *bufio.Reader
+	writeLock sync.Mutex
+	closeOnce sync.Once
+}
+
+// upgradeWebSocket completes the opening handshake and takes over the connection
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	if !headerHasToken(r.Header, "Connection", "upgrade") || !headerHasToken(r.Header, "Upgrade", "websocket") {
+		return nil, errNotWebSocket
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		return nil, fmt.Errorf("%w: unsupported version %q, want 13", errNotWebSocket, r.Header.Get("Sec-WebSocket-Version"))
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		return nil, fmt.Errorf("%w: missing Sec-WebSocket-Key", errNotWebSocket)
+	}
+	if !sameOrigin(r) {
+		if r.Header.Get("Origin") == "" {
+			return nil, fmt.Errorf("%w: missing Origin without an Authorization header", errCrossOrigin)
+		}
+		return nil, fmt.Errorf("%w from %s", errCrossOrigin, r.Header.Get("Origin"))
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, fmt.Errorf("%w: connection cannot be taken over", errNotWebSocket)
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	// The server's read and write timeouts no longer apply to a long-lived connection
+	conn.SetDeadline(time.Time{})
+
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + websocketAccept(key) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(response)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{conn: conn, reader: rw.Reader}, nil
+}
+
+// sameOrigin reports whether a browser's Origin matches the requested host
+// Browsers do not apply CORS to WebSockets, so without this check any page
+// could drive the device through a visitor's connection. A request without
+// Origin is only accepted when it authenticated with the Authorization
+// header, which a browser WebSocket cannot send.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		_, authenticated := r.Context().Value(callerKey{}).(string)
+		return authenticated && r.Header.Get("Authorization") != ""
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host != "" && strings.EqualFold(u.Host, r.Host)
+}
+
+// websocketAccept computes the Sec-WebSocket-Accept value for a client key
+func websocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// headerHasToken reports whether a comma-separated header contains token
+func headerHasToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, field := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ReadMessage returns the next data message, answering pings and close frames
+// It returns io.EOF once the client closed the connection.
+func (c *wsConn) ReadMessage() (int, []byte, error) {
+	opcode := -1
+	var message []byte
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(wsReadTimeout))
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch op {
+		case wsPing:
+			c.writeFrame(wsPong, payload)
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			c.writeFrame(wsClose, payload[:min(len(payload), 2)])
+			return 0, nil, io.EOF
+		case wsContinuation:
+			if opcode < 0 {
+				return 0, nil, fmt.Errorf("%w: continuation without a message", errWebSocketData)
+			}
+		case wsText, wsBinary:
+			if opcode >= 0 {
+				return 0, nil, fmt.Errorf("%w: new message inside a fragmented one", errWebSocketData)
+			}
+			opcode = op
+		default:
+			return 0, nil, fmt.Errorf("%w: unknown opcode %#x", errWebSocketData, op)
+		}
+
+		if len(message)+len(payload) > wsMaxMessage {
+			return 0, nil, fmt.Errorf("%w: message larger than %d bytes", errWebSocketData, wsMaxMessage)
+		}
+		message = append(message, payload...)
+		if fin {
+			return opcode, message, nil
+		}
+	}
+}
+
+// readFrame reads and unmasks one frame
+func (c *wsConn) readFrame() (bool, int, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin := header[0]&0x80 != 0
+	op := int(header[0] & 0x0F)
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, fmt.Errorf("%w: reserved bits set", errWebSocketData)
+	}
+	if header[1]&0x80 == 0 {
+		return false, 0, nil, fmt.Errorf("%w: client frames must be masked", errWebSocketData)
+	}
+
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if op >= wsClose && (!fin || length > 125) {
+		return false, 0, nil, fmt.Errorf("%w: invalid control frame", errWebSocketData)
+	}
+	if length > wsMaxMessage {
+		return false, 0, nil, fmt.Errorf("%w: frame larger than %d bytes", errWebSocketData, wsMaxMessage)
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, op, payload, nil
+}
+
+// writeFrame sends one unmasked, unfragmented frame
+func (c *wsConn) writeFrame(op int, payload []byte) error {
+	frame := []byte{0x80 | byte(op)}
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, byte(len(payload)))
+	case len(payload) <= 0xFFFF:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+	}
+	frame = append(frame, payload...)
+
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// WriteJSON sends v as a text message
+func (c *wsConn) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.writeFrame(wsText, data)
+}
+
+// Close sends a normal closure and closes the connection
+func (c *wsConn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		c.writeFrame(wsClose, []byte{0x03, 0xE8}) // 1000: normal closure
+		err = c.conn.Close()
+	})
+	return err
+}
+
+// Control channel commands
+const (
+	CommandSetParameter  = "set_parameter"
+	CommandSetMode       = "set_mode"
+	CommandStartOverride = "start_override"
+	CommandRefresh       = "refresh"
+)
+
+// ControlCommand is a JSON command sent by a WebSocket client
+type ControlCommand struct {
+	ID        string           `json:"id"`
+	Command   string           `json:"command"`
+	Parameter string           `json:"parameter,omitempty"` // set_parameter
+	Value     json.Number      `json:"value,omitempty"`     // set_parameter, raw device value
+	Mode      *VentilationMode `json:"mode,omitempty"`      // set_mode
+	Override  *OverrideRequest `json:"override,omitempty"`  // start_override
+}
+
+// ackType is the type of messages answering a command, next to the Event types
+const ackType = "ack"
+
+// ControlAck answers one ControlCommand
+type ControlAck struct {
+	Type    string        `json:"type"` // always "ack"
+	ID      string        `json:"id"`
+	Success bool          `json:"success"`
+	Code    string        `json:"code,omitempty"`
+	Error   string        `json:"error,omitempty"`
+	Results []WriteResult `json:"results,omitempty"` // verified values of a write
+	Data    interface{}   `json:"data,omitempty"`
+}
+
+// GET /ws - WebSocket channel pushing change events and accepting commands
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	conn, err := upgradeWebSocket(w, r)
+	if err != nil {
+		if errors.Is(err, errNotWebSocket) {
+			writeFailure(w, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		} else if errors.Is(err, errCrossOrigin) {
+			writeFailure(w, http.StatusForbidden, CodeInvalidRequest, err.Error())
+		} else {
+			log.Printf("✗ WebSocket upgrade failed: %v", err)
+		}
+		return
+	}
+	defer conn.Close()
+
+	caller := callerName(r)
+	log.Printf("→ WebSocket client %s connected from %s", caller, r.RemoteAddr)
+	defer log.Printf("→ WebSocket client %s disconnected", caller)
+
+	events, unsubscribe := s.events.Subscribe()
+	defer unsubscribe()
+	if err := conn.WriteJSON(s.events.Snapshot()); err != nil {
+		return
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(wsPingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					// Too slow to keep up, or the server is shutting down
+					conn.Close()
+					return
+				}
+				if conn.WriteJSON(event) != nil {
+					conn.Close()
+					return
+				}
+			case <-ticker.C:
+				conn.writeFrame(wsPing, nil)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for {
+		op, message, err := conn.ReadMessage()
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				log.Printf("✗ WebSocket client %s: %v", caller, err)
+			}
+			return
+		}
+
+		var cmd ControlCommand
+		if op != wsText {
+			err = errors.New("commands must be JSON text messages")
+		} else {
+			err = json.Unmarshal(message, &cmd)
+		}
+		ack := ControlAck{Type: ackType, ID: cmd.ID}
+		if err != nil {
+			ack = requestAck(ack, fmt.Errorf("invalid command: %w", err))
+		} else {
+			ack = s.runCommand(cmd, s.deviceClient(r), caller)
+		}
+		if conn.WriteJSON(ack) != nil {
+			return
+		}
+	}
+}
+
+// runCommand executes a control command and acknowledges it
+func (s *Server) runCommand(cmd ControlCommand, client *WebClient, caller string) ControlAck {
+	ack := ControlAck{Type: ackType, ID: cmd.ID}
+
+	switch cmd.Command {
+	case CommandSetParameter:
+		if cmd.Value == "" {
+			return requestAck(ack, errors.New(`set_parameter needs "parameter" and "value"`))
+		}
+		param := FormatParam(cmd.Parameter, cmd.Value)
+		if err := checkWritable([]string{param}); err != nil {
+			return requestAck(ack, err)
+		}
+		log.Printf("→ %s sets %s over WebSocket", caller, param)
+		results, err := client.SetMultipleValuesVerified([]string{param}, s.verifyOptions)
+		return s.writeAck(ack, results, err)
+
+	case CommandSetMode:
+		if cmd.Mode == nil || !cmd.Mode.Settable() {
+			return requestAck(ack, fmt.Errorf("%w: set_mode needs a mode that can be requested", ErrOutOfRange))
+		}
+		log.Printf("→ %s sets operating mode to %s over WebSocket", caller, *cmd.Mode)
+		results, err := NewVentilationControl(client).SetModeVerified(*cmd.Mode, s.verifyOptions)
+		return s.writeAck(ack, results, err)
+
+	case CommandStartOverride:
+		if s.overrides == nil {
+			return failedAck(ack, CodeUnavailable, "Temporary overrides are not available")
+		}
+		if cmd.Override == nil {
+			return requestAck(ack, errors.New(`start_override needs an "override" object`))
+		}
+		if _, err := cmd.Override.Validate(); err != nil {
+			return requestAck(ack, err)
+		}
+		override, err := s.overrides.Apply(*cmd.Override, caller)
+		if err != nil {
+			return errorAck(ack, err)
+		}
+		ack.Success, ack.Data = true, override
+		return ack
+
+	case CommandRefresh:
+		data, err := s.fetchDeviceData()
+		if err != nil {
+			return errorAck(ack, err)
+		}
+		s.publishEvents(data)
+		ack.Success, ack.Data = true, map[string]int{"parameter_count": len(data.Items)}
+		return ack
+	}
+	return failedAck(ack, CodeInvalidRequest, fmt.Sprintf("unknown command %q", cmd.Command))
+}
+
+// writeAck acknowledges a verified write and publishes the values it applied
+func (s *Server) writeAck(ack ControlAck, results []WriteResult, err error) ControlAck {
+	applied := make(map[string]string)
+	for _, result := range results {
+		if result.Applied && !result.RolledBack {
+			applied[result.Parameter] = result.Actual
+		}
+	}
+	if len(applied) > 0 {
+		s.events.Update(applied)
+	}
+
+	ack.Results = results
+	if err != nil {
+		return errorAck(ack, err)
+	}
+	ack.Success = true
+	return ack
+}
+
+func errorAck(ack ControlAck, err error) ControlAck {
+	ack.Code, _ = errorStatus(err)
+	ack.Error = err.Error()
+	return ack
+}
+
+// requestAck rejects a command; errors without a specific code are invalid_request
+func requestAck(ack ControlAck, err error) ControlAck {
+	ack = errorAck(ack, err)
+	if ack.Code == CodeInternal {
+		ack.Code = CodeInvalidRequest
+	}
+	return ack
+}
+
+func failedAck(ack ControlAck, code, message string) ControlAck {
+	ack.Code, ack.Error = code, message
+	return ack
+}
+
+// publishEvents feeds a polled snapshot to the event hub, fetching the alarm
+// list only while live clients are connected or readiness checks alarms
+func (s *Server) publishEvents(data *DeviceData) {
+	s.events.ObserveData(data)
+	if s.events.Subscribers() == 0 && s.settings().HealthAlarms == HealthAlarmsIgnore {
+		return
+	}
+
+	alarms, err := s.polledAlarms(data)
+	if err != nil {
+		return
+	}
+	s.events.ObserveAlarms(alarms.ActiveAlarms())
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// wsTestClient is a minimal WebSocket client speaking to a test server
+type wsTestClient struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// dialWebSocket performs the opening handshake from a page of the server and returns the response status line
+func dialWebSocket(t *testing.T, serverURL, token string) (*wsTestClient, string) {
+	t.Helper()
+	return dialWebSocketFrom(t, serverURL, token, "http://test")
+}
+
+// dialWebSocketFrom performs the handshake with the Origin header a browser page would send
+func dialWebSocketFrom(t *testing.T, serverURL, token, origin string) (*wsTestClient, string) {
+	t.Helper()
+	return dialWebSocketPath(t, serverURL, "/ws", token, origin)
+}
+
+// dialWebSocketPath performs the handshake for path, which may carry a query
+func dialWebSocketPath(t *testing.T, serverURL, path, token, origin string) (*wsTestClient, string) {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(serverURL, "http://"))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	request := "GET " + path + " HTTP/1.1\r\nHost: test\r\nUpgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n" +
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n"
+	if token != "" {
+		request += "Authorization: Bearer " + token + "\r\n"
+	}
+	if origin != "" {
+		request += "Origin: " + origin + "\r\n"
+	}
+	fmt.Fprint(conn, request+"\r\n")
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("handshake: %v", err)
+	}
+	if resp.StatusCode == http.StatusSwitchingProtocols && resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("got Sec-WebSocket-Accept %q", resp.Header.Get("Sec-WebSocket-Accept"))
+	}
+	return &wsTestClient{t: t, conn: conn, reader: reader}, resp.Status
+}
+
+// send writes a masked text frame
+func (c *wsTestClient) send(message string) {
+	c.t.Helper()
+	frame := []byte{0x80 | wsText}
+	if len(message) < 126 {
+		frame = append(frame, 0x80|byte(len(message)))
+	} else {
+		frame = binary.BigEndian.AppendUint16(append(frame, 0x80|126), uint16(len(message)))
+	}
+	mask := []byte{1, 2, 3, 4}
+	frame = append(frame, mask...)
+	for i := 0; i < len(message); i++ {
+		frame = append(frame, message[i]^mask[i%4])
+	}
+	if _, err := c.conn.Write(frame); err != nil {
+		c.t.Fatalf("send: %v", err)
+	}
+}
+
+// receive reads the next unmasked server frame as JSON into v
+func (c *wsTestClient) receive(v interface{}) {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		c.t.Fatalf("receive: %v", err)
+	}
+	length := int(header[1] & 0x7F)
+	if length == 126 {
+		var ext [2]byte
+		io.ReadFull(c.reader, ext[:])
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		c.t.Fatalf("receive: %v", err)
+	}
+	if err := json.Unmarshal(payload, v); err != nil {
+		c.t.Fatalf("receive %q: %v", payload, err)
+	}
+}
+
+// TestWebSocketCommands tests acknowledgements and events pushed to other clients
+func TestWebSocketCommands(t *testing.T) {
+	device := &fakeDevice{values: map[string]string{"H10714": "50", "H10715": "1"}}
+	mock := httptest.NewServer(device)
+	defer mock.Close()
+	server := newTestServer(t, mock.URL)
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	data, _ := server.fetchDeviceData()
+	server.events.ObserveData(data)
+
+	panel, status := dialWebSocket(t, ts.URL, "")
+	if !strings.HasPrefix(status, "101") {
+		t.Fatalf("got %s, want 101", status)
+	}
+	var snapshot Event
+	panel.receive(&snapshot)
+	if snapshot.Type != EventSnapshot || snapshot.Values["H10714"] != "50" {
+		t.Errorf("got snapshot %+v", snapshot)
+	}
+	watcher, _ := dialWebSocket(t, ts.URL, "")
+	watcher.receive(&snapshot)
+
+	tests := []struct {
+		command string
+		success bool
+		code    string
+	}{
+		{`{"id": "1", "command": "set_parameter", "parameter": "H10714", "value": 80}`, true, ""},
+		{`{"id": "2", "command": "set_parameter", "parameter": "I10215", "value": "200"}`, false, CodeReadOnly},
+		{`{"id": "3", "command": "set_mode", "mode": "defrosting"}`, false, CodeOutOfRange},
+		{`{"id": "3b", "command": "set_parameter", "parameter": "C10005", "value": "1"}`, false, CodeCommandNotAllowed},
+		{`{"id": "4", "command": "refresh"}`, true, ""},
+		{`{"id": "5", "command": "reboot"}`, false, CodeInvalidRequest},
+		{`{"id": "6", "command": `, false, CodeInvalidRequest},
+	}
+	for _, tt := range tests {
+		panel.send(tt.command)
+		// The panel also receives the events its own commands cause
+		var ack ControlAck
+		for ack.Type != "ack" {
+			panel.receive(&ack)
+		}
+		if ack.Type != "ack" || ack.Success != tt.success || ack.Code != tt.code {
+			t.Errorf("%s: got %+v, want success=%v code=%q", tt.command, ack, tt.success, tt.code)
+		}
+		if ack.ID == "1" && (len(ack.Results) != 1 || ack.Results[0].Actual != "80" || !ack.Results[0].Applied) {
+			t.Errorf("set_parameter: got results %+v, want verified value 80", ack.Results)
+		}
+	}
+
+	var event Event
+	watcher.receive(&event)
+	if event.Type != EventParameter || event.Parameter != "H10714" || event.Value != "80" || event.Previous != "50" {
+		t.Errorf("got event %+v, want H10714 changed from 50 to 80", event)
+	}
+}
+
+// TestWebSocketAuth tests that /ws requires the REST API token
+func TestWebSocketAuth(t *testing.T) {
+	server := newTestServer(t, "http://127.0.0.1:1")
+	server.config.AuthTokens = map[string]string{"s3cret": "panel"}
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	if _, status := dialWebSocket(t, ts.URL, ""); !strings.HasPrefix(status, "401") {
+		t.Errorf("without token: got %s, want 401", status)
+	}
+	if _, status := dialWebSocket(t, ts.URL, "s3cret"); !strings.HasPrefix(status, "101") {
+		t.Errorf("with token: got %s, want 101", status)
+	}
+	if _, status := dialWebSocketFrom(t, ts.URL, "s3cret", ""); !strings.HasPrefix(status, "101") {
+		t.Errorf("with token and no origin: got %s, want 101", status)
+	}
+	if _, status := dialWebSocketPath(t, ts.URL, "/ws?access_token=s3cret", "", "http://test"); !strings.HasPrefix(status, "101") {
+		t.Errorf("with query token: got %s, want 101", status)
+	}
+	if _, status := dialWebSocketPath(t, ts.URL, "/ws?access_token=s3cret", "", ""); !strings.HasPrefix(status, "403") {
+		t.Errorf("with query token and no origin: got %s, want 403", status)
+	}
+	if _, status := dialWebSocketPath(t, ts.URL, "/ws?access_token=wrong", "", "http://test"); !strings.HasPrefix(status, "401") {
+		t.Errorf("with wrong query token: got %s, want 401", status)
+	}
+
+	resp, err := http.Get(ts.URL + "/ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("plain GET: got %d, want 401", resp.StatusCode)
+	}
+}
+
+// TestWebSocketOrigin tests that browsers may only upgrade from the server's own origin
+func TestWebSocketOrigin(t *testing.T) {
+	server := newTestServer(t, "http://127.0.0.1:1")
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	for origin, want := range map[string]string{
+		"http://test":          "101",
+		"https://evil.example": "403",
+		"null":                 "403",
+		"":                     "403",
+	} {
+		if _, status := dialWebSocketFrom(t, ts.URL, "", origin); !strings.HasPrefix(status, want) {
+			t.Errorf("origin %s: got %s, want %s", origin, status, want)
+		}
+	}
+}
+
+// TestEventHubChanges tests that only differences after the first snapshot are published
+func TestEventHubChanges(t *testing.T) {
+	hub := NewEventHub()
+	events, unsubscribe := hub.Subscribe()
+	defer unsubscribe()
+
+	hub.ObserveData(&DeviceData{Items: map[string]string{"I10215": "200", "H10714": "50"}})
+	hub.ObserveAlarms([]int{55})
+	hub.ObserveData(&DeviceData{Items: map[string]string{"I10215": "201", "H10714": "50"}})
+	hub.ObserveAlarms([]int{66})
+
+	var got []string
+	for len(events) > 0 {
+		e := <-events
+		got = append(got, fmt.Sprintf("%s %s%d %s", e.Type, e.Parameter, e.Alarm, e.Value+e.State))
+	}
+	want := "[parameter I102150 201 alarm 66 active alarm 55 cleared]"
+	if fmt.Sprint(got) != want {
+		t.Errorf("got %v, want %s", got, want)
+	}
+
+	hub.Close()
+	if _, ok := <-events; ok {
+		t.Error("channel still open after Close")
+	}
+}